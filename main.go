@@ -3,15 +3,86 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	. "github.com/piex/govaluate-tool/parser"
+	syntax "github.com/piex/govaluate-tool/parser/ast"
+	"github.com/piex/govaluate-tool/parser/optimize"
 )
 
+// 为 true 时先折叠常量子表达式，如 2 * 60 输出为 120
+var fold = flag.Bool("fold", false, "fold constant subexpressions before generating code")
+
+// 输出代码的缩进：每一级缩进的宽度，以及是否使用制表符缩进
+var indentWidth = flag.Int("indent-width", 0, "spaces (or tabs, with -tabs) per level of indentation; 0 for 2 spaces or 1 tab")
+var useTabs = flag.Bool("tabs", false, "indent with tabs instead of spaces")
+
+// 输出代码每行的最大宽度，放不下一行的逻辑运算与函数调用才换行
+var maxWidth = flag.Int("max-width", 100, "width within which lines are fitted; negative to never break lines which can be joined")
+
+// 为 true 时输出为紧凑的一行，不保留注释与多余的括号和空白
+var minify = flag.Bool("minify", false, "write the expression on one line with as few characters as possible")
+
+// 为 true 时比较运算符与算术运算符两侧、函数参数的逗号之后不加空格，如 a>=5 与 f( a,b )
+var compactOperators = flag.Bool("compact-operators", false, "write comparators and arithmetic operators without spaces around them, as in a>=5")
+var compactCommas = flag.Bool("compact-commas", false, "write no space after the commas between the arguments of a call")
+
+// 括号的输出：preserve 保持书写时的括号，minimal 去掉多余的括号，explicit 给混合优先级的运算都加上括号
+var parens = flag.String("parens", "preserve", "parentheses to write: preserve, minimal or explicit")
+
+var parenthesesStyles = map[string]ParenthesesStyle{
+	"preserve": PARENTHESES_AS_WRITTEN,
+	"minimal":  PARENTHESES_MINIMAL,
+	"explicit": PARENTHESES_EXPLICIT,
+}
+
+// 示例表达式中调用的函数
+var demoFunctions = map[string]ExpressionFunction{
+	"mapGet": {
+		Name:       "mapGet",
+		Parameters: []string{},
+		ReturnType: "",
+	},
+	"isNil": {
+		Name:       "isNil",
+		Parameters: []string{},
+		ReturnType: "",
+	},
+	"getValue": {
+		Name:       "getValue",
+		Parameters: []string{},
+		ReturnType: "",
+	},
+	"StrLen": {
+		Name:       "StrLen",
+		Parameters: []string{},
+		ReturnType: "",
+	},
+	"getAbUidStr": {
+		Name:       "getAbUidStr",
+		Parameters: []string{},
+		ReturnType: "",
+	},
+	"getAbUidInt64": {
+		Name:       "getAbUidInt64",
+		Parameters: []string{},
+		ReturnType: "",
+	},
+	"JSONUnmarshal": {
+		Name:       "JSONUnmarshal",
+		Parameters: []string{},
+		ReturnType: "",
+	},
+}
+
 func main() {
+	flag.Parse()
+
 	// 创建一个日志文件
 	file, err := os.OpenFile("app.log", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
@@ -20,6 +91,16 @@ func main() {
 	defer file.Close()
 	log.SetOutput(file)
 
+	// diff 子命令比较两个文件中的表达式，如 go run . diff old.txt new.txt
+	if flag.Arg(0) == "diff" {
+		if flag.NArg() != 3 {
+			fmt.Println("Usage: diff <old file> <new file>")
+			return
+		}
+		runDiff(flag.Arg(1), flag.Arg(2))
+		return
+	}
+
 	// runDemo("01")
 	// runDemo("02")
 	// runDemo("03")
@@ -44,43 +125,7 @@ func runDemo(path string) {
 		return
 	}
 
-	tokens, _ := ParseTokens(string(expression), map[string]ExpressionFunction{
-		"mapGet": {
-			Name:       "mapGet",
-			Parameters: []string{},
-			ReturnType: "",
-		},
-		"isNil": {
-			Name:       "isNil",
-			Parameters: []string{},
-			ReturnType: "",
-		},
-		"getValue": {
-			Name:       "getValue",
-			Parameters: []string{},
-			ReturnType: "",
-		},
-		"StrLen": {
-			Name:       "StrLen",
-			Parameters: []string{},
-			ReturnType: "",
-		},
-		"getAbUidStr": {
-			Name:       "getAbUidStr",
-			Parameters: []string{},
-			ReturnType: "",
-		},
-		"getAbUidInt64": {
-			Name:       "getAbUidInt64",
-			Parameters: []string{},
-			ReturnType: "",
-		},
-		"JSONUnmarshal": {
-			Name:       "JSONUnmarshal",
-			Parameters: []string{},
-			ReturnType: "",
-		},
-	})
+	tokens, _ := ParseTokens(string(expression), demoFunctions)
 
 	jsonStr, _ := json.MarshalIndent(tokens, "", "  ")
 	jsonStr = bytes.ReplaceAll(jsonStr, []byte(`\u0026`), []byte(`&`))
@@ -108,7 +153,30 @@ func runDemo(path string) {
 		return
 	}
 
-	code := ast.Generate()
+	if *fold {
+		folded, err := optimize.Fold(syntax.FromParser(ast), optimize.FoldOptions{})
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		ast = syntax.ToParser(folded)
+	}
+
+	formatter := Formatter{IndentWidth: *indentWidth, UseTabs: *useTabs, MaxWidth: *maxWidth}
+	formatter.Minify = *minify
+	if *compactOperators {
+		formatter.OperatorSpacing = SPACING_COMPACT
+	}
+	if *compactCommas {
+		formatter.CommaSpacing = SPACING_COMPACT
+	}
+	parenthesesStyle, ok := parenthesesStyles[*parens]
+	if !ok {
+		fmt.Println("Error: unknown -parens", *parens)
+		return
+	}
+	formatter.Parentheses = parenthesesStyle
+	code := formatter.Format(ast)
 	err = os.WriteFile(outputFile, []byte(code), 0644)
 	if err != nil {
 		fmt.Println("Error writing to file:", err)
@@ -116,3 +184,52 @@ func runDemo(path string) {
 	}
 
 }
+
+// 输出两个文件中表达式的语法树差异，重新排版或改写等价写法不产生差异
+func runDiff(oldFile, newFile string) {
+	oldExpression, err := os.ReadFile(oldFile)
+	if err != nil {
+		fmt.Println("Error reading file:", err)
+		return
+	}
+	newExpression, err := os.ReadFile(newFile)
+	if err != nil {
+		fmt.Println("Error reading file:", err)
+		return
+	}
+
+	options := ParserOptions{Functions: demoFunctions}
+	oldAST, err := syntax.Parse(string(oldExpression), options)
+	if err != nil {
+		fmt.Println("Error:", oldFile, err)
+		return
+	}
+	newAST, err := syntax.Parse(string(newExpression), options)
+	if err != nil {
+		fmt.Println("Error:", newFile, err)
+		return
+	}
+
+	edits := syntax.Diff(oldAST, newAST)
+	if len(edits) == 0 {
+		fmt.Println("No changes")
+		return
+	}
+
+	// 节点的范围不含函数调用的右括号，所以输出生成的代码而不是截取原文，并合并为一行
+	text := func(node syntax.Node) string {
+		return strings.Join(strings.Fields(syntax.ToParser(node).Generate()), " ")
+	}
+
+	for _, edit := range edits {
+		switch edit.Op {
+		case syntax.EDIT_ADD:
+			fmt.Printf("+ %s:%d: %s\n", newFile, edit.New.Pos(), text(edit.New))
+		case syntax.EDIT_REMOVE:
+			fmt.Printf("- %s:%d: %s\n", oldFile, edit.Old.Pos(), text(edit.Old))
+		case syntax.EDIT_CHANGE:
+			fmt.Printf("- %s:%d: %s\n", oldFile, edit.Old.Pos(), text(edit.Old))
+			fmt.Printf("+ %s:%d: %s\n", newFile, edit.New.Pos(), text(edit.New))
+		}
+	}
+}
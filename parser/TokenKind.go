@@ -1,6 +1,9 @@
 package parser
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 /*
 Represents all valid types of tokens that a token can be.
@@ -29,7 +32,41 @@ const (
 	CLAUSE_CLOSE
 
 	TERNARY // 三元运算符
-	ARRAY   // 新增数组类型
+	ARRAY   // 新增数组类型，词法分析时表示数组字面量的 '['，如 [1, 2, 3]
+
+	INDEX       // 下标访问，紧跟在变量或访问器后的 '['，如 items[0]
+	INDEX_CLOSE // 下标访问的 ']'
+
+	NULL_COALESCE // 空值合并运算符 ??
+
+	COMMENT // 注释，// 行注释或 /* */ 块注释
+
+	ARRAY_CLOSE // 数组字面量的 ']'
+
+	MAP       // 映射字面量的 '{'，如 {'a': 1, 'b': 2}
+	MAP_CLOSE // 映射字面量的 '}'
+
+	NULL // 空值字面量 nil 或 null
+
+	INTERPOLATED_STRING // 含 ${} 插值的双引号字符串，如 "${user.Name} is over quota"
+
+	DURATION // 时长字面量，如 5m、2h30m，设置了 QuotedDurations 时也包括 '90s'，值为 time.Duration
+
+	LAMBDA // lambda 箭头 ->，如 filter(items, x -> x.Price > 10)
+
+	PIPELINE // 管道运算符 |>，如 name |> trim |> lower
+
+	NAMED_ARGUMENT // 具名参数，只出现在 AST 中，如 sendAlert(severity: 'high') 中的 severity，唯一的子节点是参数值
+
+	METHOD // 访问器上的方法调用，只出现在 AST 中，如 order.Items.Count() 或 user.HasRole('admin')，子节点是参数
+
+	ELVIS // Elvis 运算符 ?:，如 a ?: b，a 为真值时取 a，否则取 b
+
+	BETWEEN // 区间比较 x between 1 and 10，AST 中的子节点依次是被比较的值、下界和上界
+
+	LIKE // SQL 风格的通配符匹配 name like 'a%'，% 匹配任意多个字符，_ 匹配单个字符
+
+	TRIVIA // 空白与注释，只出现在 token 的 LeadingTrivia 与 TrailingTrivia 中，不会出现在 token 序列里
 )
 
 /*
@@ -74,6 +111,42 @@ func (kind TokenKind) String() string {
 		return "ACCESSOR"
 	case ARRAY:
 		return "ARRAY"
+	case INDEX:
+		return "INDEX"
+	case INDEX_CLOSE:
+		return "INDEX_CLOSE"
+	case NULL_COALESCE:
+		return "NULL_COALESCE"
+	case COMMENT:
+		return "COMMENT"
+	case ARRAY_CLOSE:
+		return "ARRAY_CLOSE"
+	case MAP:
+		return "MAP"
+	case MAP_CLOSE:
+		return "MAP_CLOSE"
+	case NULL:
+		return "NULL"
+	case INTERPOLATED_STRING:
+		return "INTERPOLATED_STRING"
+	case DURATION:
+		return "DURATION"
+	case LAMBDA:
+		return "LAMBDA"
+	case PIPELINE:
+		return "PIPELINE"
+	case NAMED_ARGUMENT:
+		return "NAMED_ARGUMENT"
+	case METHOD:
+		return "METHOD"
+	case ELVIS:
+		return "ELVIS"
+	case BETWEEN:
+		return "BETWEEN"
+	case LIKE:
+		return "LIKE"
+	case TRIVIA:
+		return "TRIVIA"
 	}
 
 	return "UNKNOWN"
@@ -82,3 +155,44 @@ func (kind TokenKind) String() string {
 func (k TokenKind) MarshalJSON() ([]byte, error) {
 	return json.Marshal(k.String())
 }
+
+// 反查表，由 String() 的结果到 TokenKind
+var tokenKindsByName = func() map[string]TokenKind {
+	ret := map[string]TokenKind{}
+	for kind := UNKNOWN; kind <= TRIVIA; kind++ {
+		ret[kind.String()] = kind
+	}
+	return ret
+}()
+
+/*
+ParseTokenKind returns the TokenKind with the given name, as returned by String(), such as "NUMERIC".
+*/
+func ParseTokenKind(name string) (TokenKind, error) {
+
+	kind, found := tokenKindsByName[name]
+	if !found {
+		return UNKNOWN, fmt.Errorf("unknown token kind '%s'", name)
+	}
+	return kind, nil
+}
+
+// UnmarshalJSON 接受 MarshalJSON 输出的名称，也接受旧格式中的整数值
+func (k *TokenKind) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var value int
+		if json.Unmarshal(data, &value) != nil {
+			return err
+		}
+		*k = TokenKind(value)
+		return nil
+	}
+
+	kind, err := ParseTokenKind(name)
+	if err != nil {
+		return err
+	}
+	*k = kind
+	return nil
+}
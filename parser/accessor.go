@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"strings"
+)
+
+/*
+The value of an ACCESSOR token which uses optional chaining, such as foo?.Bar?.Baz.
+Accessors without any '?.' keep using a plain []string of segments.
+
+NilSafe[i] is true when segment i is reached with '?.', meaning that the access should
+short-circuit to nil (rather than fail) when the value before it is nil. NilSafe[0] is always false.
+*/
+type OptionalAccessor struct {
+	Segments []string
+	NilSafe  []bool
+}
+
+/*
+Returns the accessor as written, such as "foo?.Bar.Baz".
+*/
+func (accessor OptionalAccessor) String() string {
+
+	var sb strings.Builder
+
+	for i, segment := range accessor.Segments {
+		if i > 0 {
+			if accessor.NilSafe[i] {
+				sb.WriteString("?.")
+			} else {
+				sb.WriteString(".")
+			}
+		}
+		sb.WriteString(segment)
+	}
+
+	return sb.String()
+}
+
+/*
+Splits an accessor such as "foo?.Bar.Baz" into its segments, along with which of them are nil-safe.
+*/
+func splitAccessor(tokenString string) ([]string, []bool) {
+
+	segments := strings.Split(tokenString, ".")
+	nilSafe := make([]bool, len(segments))
+
+	for i := 0; i < len(segments)-1; i++ {
+		if strings.HasSuffix(segments[i], "?") {
+			segments[i] = strings.TrimSuffix(segments[i], "?")
+			nilSafe[i+1] = true
+		}
+	}
+
+	return segments, nilSafe
+}
+
+/*
+Reports whether the stream is positioned at a '?.' which continues an accessor, as in foo?.Bar.
+The '?.' must be directly followed by a name, so that a ternary such as x?.5:1 is left alone.
+*/
+func isOptionalChain(stream *lexerStream, options ParserOptions) bool {
+
+	position := stream.position
+	if position+2 >= stream.length {
+		return false
+	}
+
+	next := stream.source[position+2]
+	return stream.source[position] == '?' &&
+		stream.source[position+1] == '.' &&
+		(options.isIdentifierRune(next, true) || next == '_')
+}
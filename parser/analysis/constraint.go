@@ -0,0 +1,402 @@
+/*
+Package analysis finds conditions of an expression which can't do what their author meant:
+clauses which are never evaluated or never change the result, and conditions which are always true or always false.
+These are almost always mistakes, or leftovers of rules which have grown over the years.
+
+The analyses reason about comparisons of a variable with constants, such as x > 5, status == 'active' or x in (1, 2, 3),
+as the set of values of the variable for which each is true. Anything else is only compared by structure,
+so that the analyses never report a problem which isn't there, though they may miss some.
+*/
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+A comparison of a variable with constants: the variable compared, and the set of its values for which the comparison is true.
+*/
+type constraint struct {
+
+	// the code of the variable or accessor compared, which identifies it
+	subject string
+
+	// the variable or accessor node
+	node ast.Node
+
+	set valueSet
+}
+
+/*
+A set of values of one type: numbers, as a union of intervals, or strings, as a finite set or everything but a finite set.
+*/
+type valueSet struct {
+	numeric bool
+
+	// for numbers, disjoint intervals in increasing order
+	intervals []interval
+
+	// for strings, the values in the set, or when complement is set, the values not in it
+	values     map[string]bool
+	complement bool
+}
+
+/*
+An interval of numbers, from low to high, each bound being excluded when open; unbounded ends are infinite.
+*/
+type interval struct {
+	low, high         float64
+	lowOpen, highOpen bool
+}
+
+/*
+Returns the constraint a boolean [node] puts on a variable, if it is a comparison of a variable with constants:
+a comparison with ==, !=, >, >=, < or <=, written either way around, x in (...) with a list of constants, or x between a and b.
+*/
+func constraintOf(node ast.Node) (constraint, bool) {
+
+	node = unparenthesized(node)
+	children := node.Children()
+
+	switch node.Kind() {
+	case parser.COMPARATOR:
+		operator := node.Token().Symbol()
+
+		if operator == "in" {
+			subject, ok := subjectOf(children[0])
+			if !ok {
+				return constraint{}, false
+			}
+			set, ok := listSet(children[1])
+			return constraint{subject: subject, node: unparenthesized(children[0]), set: set}, ok
+		}
+
+		subject, ok := subjectOf(children[0])
+		value := children[1]
+		if !ok {
+			// 5 < x is x > 5
+			if subject, ok = subjectOf(children[1]); !ok {
+				return constraint{}, false
+			}
+			value = children[0]
+			operator = mirrored[operator]
+			children = []ast.Node{children[1], children[0]}
+		}
+
+		constant, ok := constantOf(value)
+		if !ok {
+			return constraint{}, false
+		}
+		set, ok := comparisonSet(operator, constant)
+		return constraint{subject: subject, node: unparenthesized(children[0]), set: set}, ok
+
+	case parser.BETWEEN:
+		subject, ok := subjectOf(children[0])
+		if !ok {
+			return constraint{}, false
+		}
+		low, lowOK := constantOf(children[1])
+		high, highOK := constantOf(children[2])
+		lowNumber, lowIsNumber := low.(float64)
+		highNumber, highIsNumber := high.(float64)
+		if !lowOK || !highOK || !lowIsNumber || !highIsNumber {
+			return constraint{}, false
+		}
+		// inclusive of both bounds, as in SQL
+		set := numbers(interval{low: lowNumber, high: highNumber})
+		return constraint{subject: subject, node: unparenthesized(children[0]), set: set}, true
+	}
+
+	return constraint{}, false
+}
+
+// the comparison meaning the same with its operands swapped
+var mirrored = map[string]string{
+	"==": "==",
+	"!=": "!=",
+	">":  "<",
+	">=": "<=",
+	"<":  ">",
+	"<=": ">=",
+}
+
+/*
+Returns the set of values x for which x [operator] [constant] is true.
+Strings are only compared for equality, since how others compare depends on their collation.
+*/
+func comparisonSet(operator string, constant interface{}) (valueSet, bool) {
+
+	switch value := constant.(type) {
+	case float64:
+		switch operator {
+		case "==":
+			return numbers(interval{low: value, high: value}), true
+		case "!=":
+			return numbers(interval{low: math.Inf(-1), high: value, highOpen: true}, interval{low: value, high: math.Inf(1), lowOpen: true}), true
+		case ">":
+			return numbers(interval{low: value, high: math.Inf(1), lowOpen: true}), true
+		case ">=":
+			return numbers(interval{low: value, high: math.Inf(1)}), true
+		case "<":
+			return numbers(interval{low: math.Inf(-1), high: value, highOpen: true}), true
+		case "<=":
+			return numbers(interval{low: math.Inf(-1), high: value}), true
+		}
+
+	case string:
+		switch operator {
+		case "==":
+			return valueSet{values: map[string]bool{value: true}}, true
+		case "!=":
+			return valueSet{values: map[string]bool{value: true}, complement: true}, true
+		}
+	}
+
+	return valueSet{}, false
+}
+
+/*
+Returns the set of the constants of the list on the right of 'in', which must all be numbers or all strings.
+*/
+func listSet(list ast.Node) (valueSet, bool) {
+
+	list = unparenthesized(list)
+
+	elements := []ast.Node{list}
+	if list.Kind() == parser.ARRAY {
+		elements = list.Children()
+	}
+	if len(elements) == 0 {
+		return valueSet{}, false
+	}
+
+	var ret valueSet
+	for i, element := range elements {
+		constant, ok := constantOf(element)
+		if !ok {
+			return valueSet{}, false
+		}
+		set, ok := comparisonSet("==", constant)
+		if !ok || (i > 0 && set.numeric != ret.numeric) {
+			return valueSet{}, false
+		}
+		if i == 0 {
+			ret = set
+		} else {
+			ret = ret.union(set)
+		}
+	}
+	return ret, true
+}
+
+/*
+Returns the code identifying the variable or accessor [node] compares, or false if it isn't one.
+*/
+func subjectOf(node ast.Node) (string, bool) {
+
+	node = unparenthesized(node)
+	switch node.Kind() {
+	case parser.VARIABLE, parser.ACCESSOR:
+		return ast.ToParser(node).Generate(), true
+	}
+	return "", false
+}
+
+/*
+Returns the value of a number or string literal, numbers being float64s whatever type the lexer read them as.
+*/
+func constantOf(node ast.Node) (interface{}, bool) {
+
+	node = unparenthesized(node)
+
+	switch node.Kind() {
+	case parser.STRING:
+		value, ok := node.Token().Value.(string)
+		return value, ok
+
+	case parser.NUMERIC:
+		switch value := node.Token().Value.(type) {
+		case float64:
+			return value, !math.IsNaN(value)
+		case int64:
+			return float64(value), true
+		}
+
+	case parser.PREFIX:
+		if node.Token().Symbol() != "-" {
+			break
+		}
+		if value, ok := constantOf(node.Children()[0]); ok {
+			if number, isNumber := value.(float64); isNumber {
+				return -number, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func numbers(intervals ...interval) valueSet {
+	return valueSet{numeric: true, intervals: normalize(intervals)}
+}
+
+/*
+Reports whether [a] and [b] are sets of values of the same type, and so can be compared.
+*/
+func sameType(a, b valueSet) bool {
+	return a.numeric == b.numeric
+}
+
+func (set valueSet) isEmpty() bool {
+
+	if set.numeric {
+		return len(set.intervals) == 0
+	}
+	return !set.complement && len(set.values) == 0
+}
+
+/*
+Reports whether the set holds every value of its type.
+*/
+func (set valueSet) isFull() bool {
+	return set.complementOf().isEmpty()
+}
+
+func (set valueSet) complementOf() valueSet {
+
+	if !set.numeric {
+		return valueSet{values: set.values, complement: !set.complement}
+	}
+
+	var ret []interval
+	low, lowOpen := math.Inf(-1), false
+	for _, current := range set.intervals {
+		ret = append(ret, interval{low: low, lowOpen: lowOpen, high: current.low, highOpen: !current.lowOpen})
+		low, lowOpen = current.high, !current.highOpen
+	}
+	ret = append(ret, interval{low: low, lowOpen: lowOpen, high: math.Inf(1)})
+	return numbers(ret...)
+}
+
+func (set valueSet) intersect(other valueSet) valueSet {
+
+	if !set.numeric {
+		switch {
+		case set.complement && other.complement:
+			return valueSet{values: unite(set.values, other.values), complement: true}
+		case set.complement:
+			return valueSet{values: subtract(other.values, set.values)}
+		case other.complement:
+			return valueSet{values: subtract(set.values, other.values)}
+		}
+		return valueSet{values: common(set.values, other.values)}
+	}
+
+	var ret []interval
+	for _, a := range set.intervals {
+		for _, b := range other.intervals {
+			current := a
+			if b.low > current.low || (b.low == current.low && b.lowOpen) {
+				current.low, current.lowOpen = b.low, b.lowOpen
+			}
+			if b.high < current.high || (b.high == current.high && b.highOpen) {
+				current.high, current.highOpen = b.high, b.highOpen
+			}
+			ret = append(ret, current)
+		}
+	}
+	return numbers(ret...)
+}
+
+func (set valueSet) union(other valueSet) valueSet {
+	return set.complementOf().intersect(other.complementOf()).complementOf()
+}
+
+/*
+Reports whether every value in the set is also in [other].
+*/
+func (set valueSet) subsetOf(other valueSet) bool {
+	return set.intersect(other.complementOf()).isEmpty()
+}
+
+/*
+Sorts [intervals], dropping empty ones and merging those which overlap or touch.
+*/
+func normalize(intervals []interval) []interval {
+
+	var kept []interval
+	for _, current := range intervals {
+		if current.low < current.high || (current.low == current.high && !current.lowOpen && !current.highOpen) {
+			kept = append(kept, current)
+		}
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].low != kept[j].low {
+			return kept[i].low < kept[j].low
+		}
+		return !kept[i].lowOpen && kept[j].lowOpen
+	})
+
+	var ret []interval
+	for _, current := range kept {
+		if len(ret) > 0 {
+			last := &ret[len(ret)-1]
+			// overlapping, or touching with the shared bound in one of them, as with (1, 2] and (2, 3)
+			if current.low < last.high || (current.low == last.high && (!current.lowOpen || !last.highOpen)) {
+				if current.high > last.high || (current.high == last.high && !current.highOpen) {
+					last.high, last.highOpen = current.high, current.highOpen
+				}
+				continue
+			}
+		}
+		ret = append(ret, current)
+	}
+	return ret
+}
+
+func unite(a, b map[string]bool) map[string]bool {
+
+	ret := make(map[string]bool, len(a)+len(b))
+	for value := range a {
+		ret[value] = true
+	}
+	for value := range b {
+		ret[value] = true
+	}
+	return ret
+}
+
+func subtract(a, b map[string]bool) map[string]bool {
+
+	ret := map[string]bool{}
+	for value := range a {
+		if !b[value] {
+			ret[value] = true
+		}
+	}
+	return ret
+}
+
+func common(a, b map[string]bool) map[string]bool {
+
+	ret := map[string]bool{}
+	for value := range a {
+		if b[value] {
+			ret[value] = true
+		}
+	}
+	return ret
+}
+
+func unparenthesized(node ast.Node) ast.Node {
+
+	for node.Kind() == parser.CLAUSE && len(node.Children()) == 1 {
+		node = node.Children()[0]
+	}
+	return node
+}
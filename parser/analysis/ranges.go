@@ -0,0 +1,343 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+An interval of numbers from Low to High; an unbounded end is infinite.
+*/
+type Interval struct {
+	Low           float64
+	High          float64
+	LowInclusive  bool
+	HighInclusive bool
+}
+
+/*
+Returns the interval in mathematical notation, such as [1, 10) or (5, +Inf).
+*/
+func (i Interval) String() string {
+
+	ret := "("
+	if i.LowInclusive {
+		ret = "["
+	}
+	ret += formatBound(i.Low) + ", " + formatBound(i.High)
+	if i.HighInclusive {
+		return ret + "]"
+	}
+	return ret + ")"
+}
+
+func formatBound(value float64) string {
+
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+/*
+The numbers a variable must be for an expression to be true.
+*/
+type Range struct {
+
+	// the variable or accessor, as its code, such as "order.Total"
+	Subject string
+
+	// the first node of the expression referring to it
+	Node ast.Node
+
+	// the numbers it may be, as disjoint intervals in increasing order; none if the expression can't be true
+	Intervals []Interval
+}
+
+/*
+Ranges returns the numbers each variable must be for [node] to be true, as implied by its comparisons with constants:
+x > 10 && x < 20 && y >= 0 gives (10, 20) for x and [0, +Inf) for y. The comparisons are those of the chain of &&
+at the root of the tree, each of which may itself combine comparisons of one variable with && and ||, as in x < 1 || x > 9.
+Variables which aren't compared with numbers there, and so may be any number, aren't listed.
+Ranges are in the order their variables are first compared.
+*/
+func Ranges(node ast.Node) []Range {
+
+	if node == nil {
+		return nil
+	}
+
+	conditions := []ast.Node{node}
+	if root := unparenthesized(node); root.Kind() == parser.LOGICALOP && root.Token().Symbol() == "&&" {
+		conditions = operands(root, "&&")
+	}
+
+	var ret []Range
+	sets := map[string]valueSet{}
+
+	for _, condition := range conditions {
+		subject, set, ok := summarize(condition)
+		if !ok || !set.numeric {
+			continue
+		}
+		if known, found := sets[subject]; found {
+			set = known.intersect(set)
+		} else {
+			ret = append(ret, Range{Subject: subject, Node: firstReference(condition, subject)})
+		}
+		sets[subject] = set
+	}
+
+	for i := range ret {
+		for _, current := range sets[ret[i].Subject].intervals {
+			ret[i].Intervals = append(ret[i].Intervals, Interval{
+				Low:           current.low,
+				High:          current.high,
+				LowInclusive:  !current.lowOpen && !math.IsInf(current.low, 0),
+				HighInclusive: !current.highOpen && !math.IsInf(current.high, 0),
+			})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Node.Pos() < ret[j].Node.Pos()
+	})
+	return ret
+}
+
+/*
+Returns the first reference to [subject] within [node].
+*/
+func firstReference(node ast.Node, subject string) ast.Node {
+
+	var ret ast.Node
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ret != nil || n == nil {
+			return false
+		}
+		if code, ok := subjectOf(n); ok && code == subject {
+			ret = n
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+/*
+SimplifyBounds rewrites the comparisons of a variable with numbers in each chain of && or || into the fewest which mean the same,
+so that x > 10 && x > 5 becomes x > 10, x >= 1 && x < 20 && x <= 10 becomes x >= 1 && x <= 10,
+and x < 5 || x < 3 becomes x < 5.
+
+Only comparisons which are true for a single interval of numbers (with ==, >, >=, <, <= or between) are combined,
+and only where the result is also a single interval, which replaces the first of them; the bound of a comparison
+kept as written keeps its node. Comparisons which can't all be true, such as x > 5 && x < 3,
+or of which one always is, such as x < 5 || x >= 5, are left as they are, as ConstantConditions reports them.
+*/
+func SimplifyBounds(node ast.Node) (ast.Node, error) {
+
+	if node == nil {
+		return nil, nil
+	}
+
+	tree := simplifyBounds(ast.ToParser(node))
+	ret := ast.FromParser(parser.StandardizePrecedence(tree))
+	return ret, ast.Validate(ret)
+}
+
+func simplifyBounds(tree *parser.ASTNode) *parser.ASTNode {
+
+	for i, child := range tree.Children {
+		wasChain := child.Token.Kind == parser.LOGICALOP
+		child = simplifyBounds(child)
+
+		// the parentheses of a chain which became a single comparison, which StandardizePrecedence adds back if they're still needed
+		if tree.Token.Kind == parser.CLAUSE && len(tree.Children) == 1 && wasChain && child.Token.Kind != parser.LOGICALOP {
+			return child
+		}
+		tree.Children[i] = child
+	}
+
+	if tree.Token.Kind != parser.LOGICALOP {
+		return tree
+	}
+	operator, _ := tree.Token.Value.(string)
+	if operator != "&&" && operator != "||" {
+		return tree
+	}
+
+	chain := treeOperands(tree, operator)
+
+	// the operands which are bounds of each subject, by index in the chain
+	type bound struct {
+		index int
+		set   valueSet
+	}
+	var subjects []string
+	bounds := map[string][]bound{}
+
+	for i, operand := range chain {
+		c, ok := constraintOf(ast.FromParser(operand))
+		if !ok || !c.set.numeric || len(c.set.intervals) != 1 {
+			continue
+		}
+		if _, found := bounds[c.subject]; !found {
+			subjects = append(subjects, c.subject)
+		}
+		bounds[c.subject] = append(bounds[c.subject], bound{index: i, set: c.set})
+	}
+
+	replaced := map[int][]*parser.ASTNode{}
+	for _, subject := range subjects {
+		group := bounds[subject]
+		if len(group) < 2 {
+			continue
+		}
+
+		combined := group[0].set
+		for _, b := range group[1:] {
+			if operator == "&&" {
+				combined = combined.intersect(b.set)
+			} else {
+				combined = combined.union(b.set)
+			}
+		}
+		// a chain which is always true or always false is reported by ConstantConditions instead
+		if len(combined.intervals) != 1 || combined.isFull() {
+			continue
+		}
+
+		// the variable's node, as written in the first comparison
+		c, _ := constraintOf(ast.FromParser(chain[group[0].index]))
+		variable := ast.ToParser(c.node)
+
+		var candidates []*parser.ASTNode
+		for _, b := range group {
+			candidates = append(candidates, chain[b.index])
+			replaced[b.index] = nil
+		}
+		replaced[group[0].index] = boundComparisons(combined.intervals[0], variable, candidates)
+	}
+
+	if len(replaced) == 0 {
+		return tree
+	}
+
+	var kept []*parser.ASTNode
+	for i, operand := range chain {
+		if comparisons, found := replaced[i]; found {
+			kept = append(kept, comparisons...)
+		} else {
+			kept = append(kept, operand)
+		}
+	}
+
+	// rebuild the chain grouping from the left, as the Parser does
+	ret := kept[0]
+	for _, operand := range kept[1:] {
+		token := *tree.Token
+		ret = &parser.ASTNode{Token: &token, Children: []*parser.ASTNode{ret, operand}}
+	}
+	return ret
+}
+
+/*
+Returns the comparisons of [variable] which together mean it is within [bounds]: one with == for a single number,
+and otherwise one for each finite end. A comparison among the [candidates] meaning the same is used as it is.
+*/
+func boundComparisons(bounds interval, variable *parser.ASTNode, candidates []*parser.ASTNode) []*parser.ASTNode {
+
+	var wanted []valueSet
+	var operators []string
+	var values []float64
+
+	switch {
+	case bounds.low == bounds.high:
+		wanted = append(wanted, numbers(bounds))
+		operators, values = append(operators, "=="), append(values, bounds.low)
+
+	default:
+		if !math.IsInf(bounds.low, -1) {
+			operator := ">="
+			if bounds.lowOpen {
+				operator = ">"
+			}
+			wanted = append(wanted, numbers(interval{low: bounds.low, lowOpen: bounds.lowOpen, high: math.Inf(1)}))
+			operators, values = append(operators, operator), append(values, bounds.low)
+		}
+		if !math.IsInf(bounds.high, 1) {
+			operator := "<="
+			if bounds.highOpen {
+				operator = "<"
+			}
+			wanted = append(wanted, numbers(interval{low: math.Inf(-1), high: bounds.high, highOpen: bounds.highOpen}))
+			operators, values = append(operators, operator), append(values, bounds.high)
+		}
+	}
+
+	var ret []*parser.ASTNode
+	for i, set := range wanted {
+		ret = append(ret, matchingComparison(set, candidates, variable, operators[i], values[i]))
+	}
+	return ret
+}
+
+func matchingComparison(set valueSet, candidates []*parser.ASTNode, variable *parser.ASTNode, operator string, value float64) *parser.ASTNode {
+
+	for _, candidate := range candidates {
+		c, ok := constraintOf(ast.FromParser(candidate))
+		if ok && c.set.subsetOf(set) && set.subsetOf(c.set) {
+			return candidate
+		}
+	}
+
+	token := parser.ExpressionToken{Kind: parser.COMPARATOR, Value: operator, Raw: operator}
+	return &parser.ASTNode{Token: &token, Children: []*parser.ASTNode{variable.Clone(), numberLiteral(value)}}
+}
+
+/*
+Returns a literal for [value], with a negative number written as '-' applied to its magnitude, as the lexer reads it back.
+*/
+func numberLiteral(value float64) *parser.ASTNode {
+
+	magnitude := math.Abs(value)
+	raw := strconv.FormatFloat(magnitude, 'f', -1, 64)
+	if magnitude >= 1e21 || (magnitude != 0 && magnitude < 1e-6) {
+		raw = strconv.FormatFloat(magnitude, 'g', -1, 64)
+	}
+
+	literal := &parser.ASTNode{Token: &parser.ExpressionToken{Kind: parser.NUMERIC, Value: magnitude, Raw: raw}, Children: []*parser.ASTNode{}}
+	if value >= 0 {
+		return literal
+	}
+
+	negation := &parser.ASTNode{Token: &parser.ExpressionToken{Kind: parser.PREFIX, Value: "-", Raw: "-"}, Children: []*parser.ASTNode{literal}}
+	return &parser.ASTNode{Token: &parser.ExpressionToken{Kind: parser.CLAUSE, Value: '(', Raw: "("}, Children: []*parser.ASTNode{negation}}
+}
+
+/*
+Returns the operands of the chain of [operator] rooted at [tree], looking through parentheses, as operands does for a Node.
+*/
+func treeOperands(tree *parser.ASTNode, operator string) []*parser.ASTNode {
+
+	var ret []*parser.ASTNode
+	for _, child := range tree.Children {
+		operand := child
+		for operand.Token.Kind == parser.CLAUSE && len(operand.Children) == 1 {
+			operand = operand.Children[0]
+		}
+		if value, _ := operand.Token.Value.(string); operand.Token.Kind == parser.LOGICALOP && value == operator {
+			ret = append(ret, treeOperands(operand, operator)...)
+		} else {
+			ret = append(ret, child)
+		}
+	}
+	return ret
+}
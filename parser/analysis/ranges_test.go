@@ -0,0 +1,92 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+func TestRanges(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       []string // each as "subject: intervals"
+	}{
+		{"[x] > 10 && [x] < 20 && [y] >= 0", []string{"[x]: [(10, 20)]", "[y]: [[0, +Inf)]"}},
+		{"[y] == 1 && order.Total <= 2.5 && [y] != 3", []string{"[y]: [[1, 1]]", "order.Total: [(-Inf, 2.5]]"}},
+		{"([x] < 1 || [x] > 9) && [x] != 20", []string{"[x]: [(-Inf, 1) (9, 20) (20, +Inf)]"}},
+		{"[x] between 1 and 5 && -2 < [x]", []string{"[x]: [[1, 5]]"}},
+		{"[x] in (3, 1, 2)", []string{"[x]: [[1, 1] [2, 2] [3, 3]]"}},
+		{"[x] > 5 && [x] < 3", []string{"[x]: []"}},
+		{"[s] == 'a' && [x] >= -1", []string{"[x]: [[-1, +Inf)]"}},
+
+		// only the chain of && at the root constrains
+		{"[x] > 5 || [y] < 3", nil},
+		{"[x] > [y]", nil},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, r := range Ranges(parse(t, test.expression)) {
+			if r.Subject != ast.ToParser(r.Node).Generate() {
+				t.Errorf("%q: the subject %q isn't the code of its node", test.expression, r.Subject)
+			}
+
+			var intervals []string
+			for _, i := range r.Intervals {
+				intervals = append(intervals, i.String())
+			}
+			got = append(got, r.Subject+": ["+strings.Join(intervals, " ")+"]")
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestSimplifyBounds(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"[x] > 10 && [x] > 5", "[x] > 10"},
+		{"[x] >= 1 && [x] < 20 && [x] <= 10", "[x] >= 1 && [x] <= 10"},
+		{"[x] < 5 || [x] < 3", "[x] < 5"},
+		{"[x] >= 2 && [y] && [x] <= 2", "[x] == 2 && [y]"},
+		{"[x] between 1 and 10 && [x] > 5", "[x] > 5 && [x] <= 10"},
+		{"[x] > -5 && [x] > -10", "[x] > -5"},
+		{"[x] >= -2 && [x] <= -2", "[x] == ( -2 )"},
+		{"[x] between -5 and 5 && [x] < 0", "[x] >= ( -5 ) && [x] < 0"},
+		{"[a] || ([x] > 1 && [x] > 2)", "[a] || [x] > 2"},
+
+		// left as they are
+		{"[x] > 5 && [x] < 3", "[x] > 5 && [x] < 3"},
+		{"[x] < 5 || [x] >= 5", "[x] < 5 || [x] >= 5"},
+		{"[x] < 1 || [x] > 9", "[x] < 1 || [x] > 9"},
+		{"[x] > 1 && [y] > 2", "[x] > 1 && [y] > 2"},
+	}
+
+	for _, test := range tests {
+		simplified, err := SimplifyBounds(parse(t, test.expression))
+		if err != nil {
+			t.Errorf("SimplifyBounds(%q): %v", test.expression, err)
+			continue
+		}
+
+		got := parser.Formatter{MaxWidth: -1}.Format(ast.ToParser(simplified))
+		if got != test.want {
+			t.Errorf("SimplifyBounds(%q) gives %q, want %q", test.expression, got, test.want)
+		}
+		if _, err := ast.Parse(got, parser.ParserOptions{}); err != nil {
+			t.Errorf("SimplifyBounds(%q) gives %q, which doesn't parse: %v", test.expression, got, err)
+		}
+	}
+
+	if simplified, err := SimplifyBounds(nil); simplified != nil || err != nil {
+		t.Error("SimplifyBounds(nil) should give nil")
+	}
+}
@@ -0,0 +1,253 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+A subexpression which is never evaluated, because what is evaluated before it always decides the result without it.
+*/
+type Unreachable struct {
+
+	// the subexpression never evaluated, such as x in false && x
+	Node ast.Node
+
+	// what decides the result before it: the false of false && x, or the constant condition of a ternary
+	Guard ast.Node
+}
+
+/*
+A condition whose value is always the same wherever it is evaluated, given what was evaluated before it.
+*/
+type Redundant struct {
+
+	// the condition, such as x > 3 in x > 5 && x > 3
+	Node ast.Node
+
+	// its value wherever it is evaluated
+	Value bool
+
+	// the condition evaluated before it which decides its value, such as x > 5 in x > 5 && x > 3
+	Guard ast.Node
+}
+
+/*
+Reachability finds the parts of the tree rooted at [node] which can never make a difference, given how && and || short-circuit:
+
+  - the operands which are never evaluated, such as x in false && x, every operand of && after one which is always false,
+    the branch a ternary never takes when its condition is always true or always false, and the right of ?? whose left is a literal other than nil
+  - the conditions which are always true or always false wherever they're evaluated, because of a condition evaluated before them:
+    x > 3 in x > 5 && x > 3 is always true, and so changes nothing; x > 10 in x > 5 || x > 10 is always false,
+    since it's only evaluated when x <= 5
+
+A condition evaluated before another is any operand before it in the same chain of && or ||, any operand on the left of
+an && or || it is on the right of, or the condition of a ternary it is a branch of.
+Both lists are in source order; a redundant condition which is always false for && (or true for ||)
+also makes the rest of the chain unreachable, with it as their Guard, and nothing is reported within a part which is itself unreachable.
+*/
+func Reachability(node ast.Node) ([]Unreachable, []Redundant) {
+
+	if node == nil {
+		return nil, nil
+	}
+
+	r := &reachability{}
+	r.walk(node, nil)
+
+	sort.SliceStable(r.unreachable, func(i, j int) bool {
+		return r.unreachable[i].Node.Pos() < r.unreachable[j].Node.Pos()
+	})
+	sort.SliceStable(r.redundant, func(i, j int) bool {
+		return r.redundant[i].Node.Pos() < r.redundant[j].Node.Pos()
+	})
+	return r.unreachable, r.redundant
+}
+
+type reachability struct {
+	unreachable []Unreachable
+	redundant   []Redundant
+}
+
+/*
+A condition known to have [value] where a node is evaluated.
+*/
+type fact struct {
+	node  ast.Node
+	value bool
+}
+
+/*
+Walks [node], where the [facts] hold.
+*/
+func (r *reachability) walk(node ast.Node, facts []fact) {
+
+	node = unparenthesized(node)
+	children := node.Children()
+
+	switch node.Kind() {
+
+	case parser.LOGICALOP:
+		operator := node.Token().Symbol()
+		if operator != "&&" && operator != "||" {
+			break
+		}
+		r.chain(operands(node, operator), operator == "&&", facts)
+		return
+
+	case parser.TERNARY:
+		condition := children[0]
+
+		if value, ok := r.decide(condition, facts); ok {
+			taken, dead := children[1], children[2]
+			if !value {
+				taken, dead = dead, taken
+			}
+			r.unreachable = append(r.unreachable, Unreachable{Node: dead, Guard: condition})
+			r.walk(taken, facts)
+			return
+		}
+
+		r.walk(condition, facts)
+
+		r.walk(children[1], with(facts, fact{node: condition, value: true}))
+		r.walk(children[2], with(facts, fact{node: condition, value: false}))
+		return
+
+	case parser.NULL_COALESCE:
+		left := unparenthesized(children[0])
+		if isLiteral(left) && left.Kind() != parser.NULL {
+			r.unreachable = append(r.unreachable, Unreachable{Node: children[1], Guard: children[0]})
+			r.walk(children[0], facts)
+			return
+		}
+	}
+
+	for _, child := range children {
+		r.walk(child, facts)
+	}
+}
+
+/*
+Walks the [operands] of a chain of && (when [and] is set) or ||, where the [facts] hold.
+Each operand is only evaluated while those before it are true for &&, or false for ||.
+*/
+func (r *reachability) chain(operands []ast.Node, and bool, facts []fact) {
+
+	for i, operand := range operands {
+
+		value, decided := r.decide(operand, facts)
+		if !decided {
+			r.walk(operand, facts)
+			facts = with(facts, fact{node: operand, value: and})
+			continue
+		}
+
+		// false && ..., true || ...: nothing after the operand is evaluated
+		if value != and {
+			for _, dead := range operands[i+1:] {
+				r.unreachable = append(r.unreachable, Unreachable{Node: dead, Guard: operand})
+			}
+			return
+		}
+	}
+}
+
+/*
+Returns the value [condition] always has where the [facts] hold, if it's a constant or is implied by one of them,
+in which case it is reported as redundant.
+*/
+func (r *reachability) decide(condition ast.Node, facts []fact) (bool, bool) {
+
+	if value, ok := constantBool(condition); ok {
+		return value, true
+	}
+
+	value, guard, decided := implied(condition, facts)
+	if decided {
+		r.redundant = append(r.redundant, Redundant{Node: condition, Value: value, Guard: guard})
+	}
+	return value, decided
+}
+
+/*
+Returns the value [condition] always has where the [facts] hold, and the fact which decides it, or false if it may have either.
+*/
+func implied(condition ast.Node, facts []fact) (bool, ast.Node, bool) {
+
+	target, isConstraint := constraintOf(condition)
+
+	for i := len(facts) - 1; i >= 0; i-- {
+		known := facts[i]
+
+		if parser.Equal(ast.ToParser(unparenthesized(known.node)), ast.ToParser(unparenthesized(condition))) {
+			return known.value, known.node, true
+		}
+
+		if !isConstraint {
+			continue
+		}
+		source, ok := constraintOf(known.node)
+		if !ok || source.subject != target.subject || !sameType(source.set, target.set) {
+			continue
+		}
+
+		// the values the subject may have where the fact holds
+		possible := source.set
+		if !known.value {
+			possible = possible.complementOf()
+		}
+
+		switch {
+		case possible.subsetOf(target.set):
+			return true, known.node, true
+		case possible.intersect(target.set).isEmpty():
+			return false, known.node, true
+		}
+	}
+
+	return false, nil, false
+}
+
+/*
+Returns the operands of the chain of [operator] rooted at [node], looking through parentheses, so that a && (b && c) has three.
+*/
+func operands(node ast.Node, operator string) []ast.Node {
+
+	var ret []ast.Node
+	for _, child := range node.Children() {
+		operand := unparenthesized(child)
+		if operand.Kind() == parser.LOGICALOP && operand.Token().Symbol() == operator {
+			ret = append(ret, operands(operand, operator)...)
+		} else {
+			ret = append(ret, child)
+		}
+	}
+	return ret
+}
+
+func with(facts []fact, known fact) []fact {
+	return append(append([]fact(nil), facts...), known)
+}
+
+func constantBool(node ast.Node) (bool, bool) {
+
+	node = unparenthesized(node)
+	if node.Kind() != parser.BOOLEAN {
+		return false, false
+	}
+	value, ok := node.Token().Value.(bool)
+	return value, ok
+}
+
+func isLiteral(node ast.Node) bool {
+
+	switch node.Kind() {
+	case parser.NUMERIC, parser.STRING, parser.BOOLEAN, parser.NULL:
+		return true
+	}
+	_, ok := constantOf(node)
+	return ok
+}
@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+func parse(t *testing.T, expression string) ast.Node {
+	t.Helper()
+
+	root, err := ast.Parse(expression, parser.ParserOptions{})
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expression, err)
+	}
+	return root
+}
+
+/*
+Returns the source text [node] spans within [expression], which leaves out a closing bracket at its end.
+*/
+func text(expression string, node ast.Node) string {
+
+	if node == nil {
+		return ""
+	}
+	return expression[node.Pos():node.End()]
+}
+
+func TestReachability(t *testing.T) {
+
+	tests := []struct {
+		expression  string
+		unreachable []string // each as "node <- guard"
+		redundant   []string // each as "node = value <- guard"
+	}{
+		{"false && [x]", []string{"[x] <- false"}, nil},
+		{"true || [x] || [y]", []string{"[x] <- true", "[y] <- true"}, nil},
+		{"[a] && false && [x]", []string{"[x] <- false"}, nil},
+		{"true ? [a] : [b]", []string{"[b] <- true"}, nil},
+		{"false ? [a] : [b]", []string{"[a] <- false"}, nil},
+		{"1 ?? [x]", []string{"[x] <- 1"}, nil},
+		{"null ?? [x]", nil, nil},
+
+		{"[x] > 5 && [x] > 3", nil, []string{"[x] > 3 = true <- [x] > 5"}},
+		{"[x] > 5 || [x] > 10", nil, []string{"[x] > 10 = false <- [x] > 5"}},
+		{"[x] > 5 && [x] < 3 && [y]", []string{"[y] <- [x] < 3"}, []string{"[x] < 3 = false <- [x] > 5"}},
+		{"[a] && ([b] || [a])", nil, []string{"[a] = true <- [a]"}},
+		{"[s] == 'a' ? [s] != 'a' && [u] : [t]", []string{"[u] <- [s] != 'a'"}, []string{"[s] != 'a' = false <- [s] == 'a'"}},
+		{"[x] in (1, 2) && [x] < 5", nil, []string{"[x] < 5 = true <- [x] in (1, 2"}},
+
+		// nothing is reported within a part never evaluated
+		{"true ? [a] : [x] > 5 && [x] > 3", []string{"[x] > 5 && [x] > 3 <- true"}, nil},
+
+		{"[x] > 5 && [y] > 3", nil, nil},
+		{"[x] > 5 && [x] < 10", nil, nil},
+		{"[s] == 'a' && [x] > 1", nil, nil},
+	}
+
+	for _, test := range tests {
+		unreachable, redundant := Reachability(parse(t, test.expression))
+
+		var gotUnreachable, gotRedundant []string
+		for _, u := range unreachable {
+			gotUnreachable = append(gotUnreachable, text(test.expression, u.Node)+" <- "+text(test.expression, u.Guard))
+		}
+		for _, r := range redundant {
+			value := "false"
+			if r.Value {
+				value = "true"
+			}
+			gotRedundant = append(gotRedundant, text(test.expression, r.Node)+" = "+value+" <- "+text(test.expression, r.Guard))
+		}
+
+		if !reflect.DeepEqual(gotUnreachable, test.unreachable) {
+			t.Errorf("%q: unreachable %q, want %q", test.expression, gotUnreachable, test.unreachable)
+		}
+		if !reflect.DeepEqual(gotRedundant, test.redundant) {
+			t.Errorf("%q: redundant %q, want %q", test.expression, gotRedundant, test.redundant)
+		}
+	}
+
+	if unreachable, redundant := Reachability(nil); unreachable != nil || redundant != nil {
+		t.Error("Reachability(nil) should find nothing")
+	}
+}
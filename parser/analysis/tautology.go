@@ -0,0 +1,206 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+A condition which has the same value whatever the values of its variables.
+*/
+type ConstantCondition struct {
+
+	// the condition, which is a chain of && or || or a comparison
+	Node ast.Node
+
+	// true for a tautology, false for a contradiction
+	Value bool
+}
+
+/*
+ConstantConditions finds the conditions within the tree rooted at [node] which are always true or always false,
+such as x > 5 && x < 3, status == 'a' || status != 'a', a && !a, or x != x, which are almost always mistakes.
+
+It is a lightweight check rather than a full satisfiability solver: the operands of each chain of && or || are combined
+for each variable they compare with constants, so that x > 5 && y && x < 3 is found, as is x > 5 && !(x > 1),
+but not conditions which only become constant through a mix of && and || over different variables.
+Comparisons of a variable with itself are only constant for values which equal themselves, which every value but NaN does.
+The conditions are in source order; those within a condition reported aren't reported again.
+*/
+func ConstantConditions(node ast.Node) []ConstantCondition {
+
+	if node == nil {
+		return nil
+	}
+
+	var ret []ConstantCondition
+
+	var walk func(node ast.Node)
+	walk = func(node ast.Node) {
+
+		node = unparenthesized(node)
+
+		switch node.Kind() {
+		case parser.LOGICALOP:
+			operator := node.Token().Symbol()
+			if operator != "&&" && operator != "||" {
+				break
+			}
+
+			chain := operands(node, operator)
+			if value, constant := constantChain(chain, operator == "&&"); constant {
+				ret = append(ret, ConstantCondition{Node: node, Value: value})
+				return
+			}
+			for _, operand := range chain {
+				walk(operand)
+			}
+			return
+
+		case parser.COMPARATOR:
+			if value, constant := selfComparison(node); constant {
+				ret = append(ret, ConstantCondition{Node: node, Value: value})
+				return
+			}
+		}
+
+		for _, child := range node.Children() {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Node.Pos() < ret[j].Node.Pos()
+	})
+	return ret
+}
+
+/*
+Reports whether the chain of [operands] of && (when [and] is set) or || is always false, for &&, or always true, for ||.
+*/
+func constantChain(operands []ast.Node, and bool) (bool, bool) {
+
+	// the values each variable may have for the chain to be true (for &&) or false (for ||), keyed by subject and type
+	type key struct {
+		subject string
+		numeric bool
+	}
+	sets := map[key]valueSet{}
+
+	for i, operand := range operands {
+
+		// a && !a, a || !a
+		for _, other := range operands[:i] {
+			if isNegationOf(operand, other) || isNegationOf(other, operand) {
+				return !and, true
+			}
+		}
+
+		subject, set, ok := summarize(operand)
+		if !ok {
+			continue
+		}
+		if !and {
+			// || is false when each operand is
+			set = set.complementOf()
+		}
+
+		k := key{subject: subject, numeric: set.numeric}
+		if known, found := sets[k]; found {
+			set = known.intersect(set)
+		}
+		sets[k] = set
+
+		if set.isEmpty() {
+			return !and, true
+		}
+	}
+
+	return false, false
+}
+
+/*
+Returns the set of values of a single variable for which [node] is true, if it only compares that variable with constants,
+combining comparisons joined by && and || and negated with !.
+*/
+func summarize(node ast.Node) (string, valueSet, bool) {
+
+	if c, ok := constraintOf(node); ok {
+		return c.subject, c.set, true
+	}
+
+	node = unparenthesized(node)
+
+	switch node.Kind() {
+	case parser.PREFIX:
+		if node.Token().Symbol() != "!" {
+			break
+		}
+		subject, set, ok := summarize(node.Children()[0])
+		return subject, set.complementOf(), ok
+
+	case parser.LOGICALOP:
+		operator := node.Token().Symbol()
+		if operator != "&&" && operator != "||" {
+			break
+		}
+
+		var subject string
+		var ret valueSet
+		for i, operand := range operands(node, operator) {
+			operandSubject, set, ok := summarize(operand)
+			if !ok || (i > 0 && (operandSubject != subject || !sameType(set, ret))) {
+				return "", valueSet{}, false
+			}
+			switch {
+			case i == 0:
+				subject, ret = operandSubject, set
+			case operator == "&&":
+				ret = ret.intersect(set)
+			default:
+				ret = ret.union(set)
+			}
+		}
+		return subject, ret, true
+	}
+
+	return "", valueSet{}, false
+}
+
+/*
+Reports whether [node] is written as the negation of [other], as !a is of a.
+*/
+func isNegationOf(node ast.Node, other ast.Node) bool {
+
+	node = unparenthesized(node)
+	if node.Kind() != parser.PREFIX || node.Token().Symbol() != "!" {
+		return false
+	}
+	return parser.Equal(ast.ToParser(unparenthesized(node.Children()[0])), ast.ToParser(unparenthesized(other)))
+}
+
+/*
+Returns the value of a comparison of a variable with itself, such as x == x or x < x.
+*/
+func selfComparison(node ast.Node) (bool, bool) {
+
+	children := node.Children()
+	left, isVariable := subjectOf(children[0])
+	if !isVariable {
+		return false, false
+	}
+	if right, _ := subjectOf(children[1]); right != left {
+		return false, false
+	}
+
+	switch node.Token().Symbol() {
+	case "==", ">=", "<=":
+		return true, true
+	case "!=", ">", "<":
+		return false, true
+	}
+	return false, false
+}
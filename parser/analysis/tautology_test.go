@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConstantConditions(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       []string // each as "node = value"
+	}{
+		{"[x] > 5 && [x] < 3", []string{"[x] > 5 && [x] < 3 = false"}},
+		{"[status] == 'a' || [status] != 'a'", []string{"[status] == 'a' || [status] != 'a' = true"}},
+		{"[a] && ![a]", []string{"[a] && ![a] = false"}},
+		{"![a] || [a]", []string{"![a] || [a] = true"}},
+		{"[x] != [x]", []string{"[x] != [x] = false"}},
+		{"[x] >= [x]", []string{"[x] >= [x] = true"}},
+		{"[x] > 5 && [y] && [x] < 3", []string{"[x] > 5 && [y] && [x] < 3 = false"}},
+		{"!([x] > 1) && [x] > 5", []string{"!([x] > 1) && [x] > 5 = false"}},
+		{"[x] in (1, 2) && [x] == 3", []string{"[x] in (1, 2) && [x] == 3 = false"}},
+		{"[x] between 1 and 5 && [x] > 5", []string{"[x] between 1 and 5 && [x] > 5 = false"}},
+		{"[x] < 5 || [x] >= 5", []string{"[x] < 5 || [x] >= 5 = true"}},
+		{"5 < [x] && [x] < 5", []string{"5 < [x] && [x] < 5 = false"}},
+
+		// each constant condition, in source order, but not those within one
+		{"[b] || [x] > 5 && [x] < 3 || [y] == [y]", []string{"[x] > 5 && [x] < 3 = false", "[y] == [y] = true"}},
+		{"[a] && ![a] && [x] != [x]", []string{"[a] && ![a] && [x] != [x] = false"}},
+
+		{"[x] > 5 && [x] < 10", nil},
+		{"[x] > 5 && [y] < 3", nil},
+		{"[x] == 1 && [x] == '1'", nil},
+		{"[s] < 'b' && [s] > 'c'", nil},
+		{"[x] > 5 && [y] || [x] < 3", nil},
+		{"[x] == [y]", nil},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, condition := range ConstantConditions(parse(t, test.expression)) {
+			value := "false"
+			if condition.Value {
+				value = "true"
+			}
+			got = append(got, text(test.expression, condition.Node)+" = "+value)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.expression, got, test.want)
+		}
+	}
+
+	if ConstantConditions(nil) != nil {
+		t.Error("ConstantConditions(nil) should find nothing")
+	}
+}
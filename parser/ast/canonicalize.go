@@ -0,0 +1,151 @@
+package ast
+
+import (
+	"sort"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+Canonicalize returns a copy of the tree rooted at [node] in a canonical form, so that expressions which differ only in
+the order of commutative operands, their grouping or their spelling have the same form, and so generate the same code:
+
+  - the operands of && and ||, and of + and * where both are numbers, are put in a fixed order,
+    flattening chains of the same operator, so that c && (b && a) becomes a && b && c
+  - the two operands of == and != are put in the same fixed order
+  - textual logical operators are written as symbols, so not a and b becomes !a && b
+  - parentheses are kept only where the grouping needs them
+
+Numbers are told apart from strings, whose + doesn't commute, by parser.InferType;
+a + b where the type of either operand is unknown is left as it is.
+
+The canonical form is for comparing expressions, such as to find duplicates, rather than for evaluating them:
+reordering the operands of && and || changes which of them short-circuits the others.
+*/
+func Canonicalize(node Node) Node {
+
+	if node == nil {
+		return nil
+	}
+
+	tree := canonicalize(ToParser(node))
+	return FromParser(parser.StandardizePrecedence(tree))
+}
+
+// the textual spelling of each logical operator's symbol
+var logicalSymbols = map[string]string{
+	"and": "&&",
+	"AND": "&&",
+	"or":  "||",
+	"OR":  "||",
+	"not": "!",
+	"NOT": "!",
+}
+
+func canonicalize(tree *parser.ASTNode) *parser.ASTNode {
+
+	for i, child := range tree.Children {
+		child = canonicalize(child)
+
+		// StandardizePrecedence puts back the parentheses which are needed, but those of a list, as in x in (1), are part of it
+		if !(i == 1 && isInComparison(tree)) {
+			child = withoutParentheses(child)
+		}
+		tree.Children[i] = child
+	}
+
+	if symbol, found := logicalSymbols[tree.Token.Raw]; found && (tree.Token.Kind == parser.LOGICALOP || tree.Token.Kind == parser.PREFIX) {
+		tree.Token.Raw = symbol
+	}
+
+	if !commutes(tree) {
+		return tree
+	}
+
+	operands := flatten(tree, tree.Token.Symbol(), nil)
+	sortOperands(operands)
+
+	// rebuild the chain grouping from the left, as the Parser does
+	ret := operands[0]
+	for _, operand := range operands[1:] {
+		token := *tree.Token
+		ret = &parser.ASTNode{Token: &token, Children: []*parser.ASTNode{ret, operand}}
+	}
+	return ret
+}
+
+/*
+Reports whether the operands of [tree] may be reordered.
+*/
+func commutes(tree *parser.ASTNode) bool {
+
+	if len(tree.Children) != 2 {
+		return false
+	}
+
+	switch tree.Token.Kind {
+	case parser.LOGICALOP:
+		symbol := tree.Token.Symbol()
+		return symbol == "&&" || symbol == "||"
+
+	case parser.COMPARATOR:
+		symbol := tree.Token.Symbol()
+		return symbol == "==" || symbol == "!="
+
+	case parser.MODIFIER:
+		symbol := tree.Token.Symbol()
+		if symbol != "+" && symbol != "*" {
+			return false
+		}
+		for _, child := range tree.Children {
+			if kind, err := parser.InferType(child, nil); err != nil || kind != "number" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+/*
+Collects the operands of a chain of the associative [symbol], such as the a, b and c of a && (b && c).
+Comparisons aren't associative, so their two operands are their own chain.
+*/
+func flatten(tree *parser.ASTNode, symbol string, operands []*parser.ASTNode) []*parser.ASTNode {
+
+	for _, child := range tree.Children {
+		if tree.Token.Kind != parser.COMPARATOR && child.Token.Kind == tree.Token.Kind && child.Token.Symbol() == symbol && commutes(child) {
+			operands = flatten(child, symbol, operands)
+		} else {
+			operands = append(operands, child)
+		}
+	}
+	return operands
+}
+
+/*
+Sorts [operands] by the code they generate, with the parentheses they need so that different operands never compare equal.
+*/
+func sortOperands(operands []*parser.ASTNode) {
+
+	keys := make(map[*parser.ASTNode]string, len(operands))
+	for _, operand := range operands {
+		keys[operand] = parser.StandardizePrecedence(operand).Generate()
+	}
+
+	sort.SliceStable(operands, func(i, j int) bool {
+		return keys[operands[i]] < keys[operands[j]]
+	})
+}
+
+func withoutParentheses(tree *parser.ASTNode) *parser.ASTNode {
+
+	for tree.Token.Kind == parser.CLAUSE && len(tree.Children) == 1 {
+		tree = tree.Children[0]
+	}
+	return tree
+}
+
+func isInComparison(tree *parser.ASTNode) bool {
+	return tree.Token.Kind == parser.COMPARATOR && tree.Token.Symbol() == "in"
+}
@@ -0,0 +1,73 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func canonical(t *testing.T, expression string) string {
+	t.Helper()
+
+	root, err := Parse(expression, parser.ParserOptions{})
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expression, err)
+	}
+	canonicalized := Canonicalize(root)
+	if err := Validate(canonicalized); err != nil {
+		t.Fatalf("Canonicalize(%q): %v", expression, err)
+	}
+	return parser.Formatter{MaxWidth: -1}.Format(ToParser(canonicalized))
+}
+
+func TestCanonicalize(t *testing.T) {
+
+	same := [][]string{
+		{"[c] && ([b] && [a])", "[a] && [b] && [c]", "([b] && [c]) && [a]"},
+		{"[x] == 1", "1 == [x]", "(([x])) == 1"},
+		{"not [a] and [b]", "![a] && [b]", "[b] && !([a])"},
+		{"2 * 3 + 1", "1 + 3 * 2", "(3 * 2) + 1"},
+		{"[a] || [b] && [c]", "[c] && [b] || [a]"},
+	}
+	for _, expressions := range same {
+		want := canonical(t, expressions[0])
+		for _, expression := range expressions[1:] {
+			if got := canonical(t, expression); got != want {
+				t.Errorf("%q canonicalizes into %q, but %q into %q", expressions[0], want, expression, got)
+			}
+		}
+	}
+
+	different := [][]string{
+		// + of strings, or of operands of unknown type, doesn't commute
+		{"'a' + 'b'", "'b' + 'a'"},
+		{"[a] + [b]", "[b] + [a]"},
+		{"[a] - [b]", "[b] - [a]"},
+		{"[a] && ([b] || [c])", "([a] && [b]) || [c]"},
+		{"[a] < [b]", "[b] < [a]"},
+	}
+	for _, expressions := range different {
+		if canonical(t, expressions[0]) == canonical(t, expressions[1]) {
+			t.Errorf("%q and %q canonicalize into the same form", expressions[0], expressions[1])
+		}
+	}
+}
+
+func TestCanonicalizeKeepsOriginal(t *testing.T) {
+
+	root, err := Parse("[x] in (1) || [c] && [b]", parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := parser.Formatter{MaxWidth: -1}.Format(ToParser(Canonicalize(root)))
+	if want := "[b] && [c] || [x] in ( 1 )"; got != want {
+		t.Errorf("Canonicalize gives %q, want %q", got, want)
+	}
+	if generated := (parser.Formatter{MaxWidth: -1}).Format(ToParser(root)); generated != "[x] in ( 1 ) || [c] && [b]" {
+		t.Errorf("Canonicalize changed the original tree into %q", generated)
+	}
+	if Canonicalize(nil) != nil {
+		t.Error("Canonicalize(nil) should be nil")
+	}
+}
@@ -0,0 +1,171 @@
+package ast
+
+import (
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/internal/lcs"
+)
+
+/*
+Represents the kind of change an Edit describes.
+*/
+type EditOp int
+
+const (
+	EDIT_ADD EditOp = iota
+	EDIT_REMOVE
+	EDIT_CHANGE
+)
+
+func (op EditOp) String() string {
+
+	switch op {
+	case EDIT_ADD:
+		return "ADD"
+	case EDIT_REMOVE:
+		return "REMOVE"
+	case EDIT_CHANGE:
+		return "CHANGE"
+	}
+
+	return "UNKNOWN"
+}
+
+/*
+Represents a single step in the edit script between two trees.
+Old is the node of the first tree, set for EDIT_REMOVE and EDIT_CHANGE,
+New is the node of the second tree, set for EDIT_ADD and EDIT_CHANGE;
+their Pos and End give the span of the change in each source.
+*/
+type Edit struct {
+	Op  EditOp
+	Old Node
+	New Node
+}
+
+/*
+Diff returns the edit script turning the tree [a] into [b], in source order.
+
+Trees are compared as parser.Equal does, so that reformatting, the spelling of an operator (and for &&)
+and parentheses which don't change the grouping make no edits.
+Where two nodes have the same token, their children are aligned using the longest common subsequence,
+so that an argument added to a call is a single EDIT_ADD rather than a change of the whole call,
+and the operands of a chain of && or || are aligned as a whole, so that adding one to its end is a single EDIT_ADD too;
+otherwise the node is reported as changed as a whole. A child removed and another added at the same place
+are compared in turn, so that changing a > 1 to a >= 1 within a long chain of && is reported as just that.
+Operands are otherwise compared in order, so to ignore a == b becoming b == a, Canonicalize both trees first.
+*/
+func Diff(a, b Node) []Edit {
+
+	var ret []Edit
+
+	switch {
+	case a == nil && b == nil:
+	case a == nil:
+		ret = append(ret, Edit{Op: EDIT_ADD, New: b})
+	case b == nil:
+		ret = append(ret, Edit{Op: EDIT_REMOVE, Old: a})
+	default:
+		diffNodes(unparenthesizedNode(a), unparenthesizedNode(b), &ret)
+	}
+	return ret
+}
+
+func diffNodes(a, b Node, edits *[]Edit) {
+
+	if parser.Equal(a.source(), b.source()) {
+		return
+	}
+
+	if !sameToken(a, b) {
+		*edits = append(*edits, Edit{Op: EDIT_CHANGE, Old: a, New: b})
+		return
+	}
+
+	diffChildren(operands(a), operands(b), edits)
+}
+
+/*
+Returns the children of [node] to align, which for a chain of && or || are all of its operands,
+so that a && b && c has the same three operands however it is grouped.
+*/
+func operands(node Node) []Node {
+
+	symbol := node.Token().Value
+	if node.Kind() != parser.LOGICALOP || (symbol != "&&" && symbol != "||") {
+		return node.Children()
+	}
+
+	var ret []Node
+	for _, child := range node.Children() {
+		operand := unparenthesizedNode(child)
+		if operand.Kind() == parser.LOGICALOP && operand.Token().Value == symbol {
+			ret = append(ret, operands(operand)...)
+		} else {
+			ret = append(ret, child)
+		}
+	}
+	return ret
+}
+
+/*
+Aligns the children [a] and [b] of two nodes with the same token, as parser.DiffTokens does for tokens.
+*/
+func diffChildren(a, b []Node, edits *[]Edit) {
+
+	equal := func(i, j int) bool {
+		return parser.Equal(unparenthesizedNode(a[i]).source(), unparenthesizedNode(b[j]).source())
+	}
+
+	// the children removed and added since the last one both trees share
+	var removed, added []Node
+
+	flush := func() {
+		for len(removed) > 0 && len(added) > 0 {
+			diffNodes(unparenthesizedNode(removed[0]), unparenthesizedNode(added[0]), edits)
+			removed, added = removed[1:], added[1:]
+		}
+		for _, child := range removed {
+			*edits = append(*edits, Edit{Op: EDIT_REMOVE, Old: child})
+		}
+		for _, child := range added {
+			*edits = append(*edits, Edit{Op: EDIT_ADD, New: child})
+		}
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for _, op := range lcs.Align(len(a), len(b), equal) {
+
+		switch op {
+		case lcs.EQUAL:
+			flush()
+			i++
+			j++
+		case lcs.DELETE:
+			removed = append(removed, a[i])
+			i++
+		case lcs.INSERT:
+			added = append(added, b[j])
+			j++
+		}
+	}
+
+	flush()
+}
+
+/*
+Reports whether two nodes have the same token, leaving aside their children.
+*/
+func sameToken(a, b Node) bool {
+
+	tokenA, tokenB := a.Token(), b.Token()
+	return parser.Equal(&parser.ASTNode{Token: &tokenA}, &parser.ASTNode{Token: &tokenB})
+}
+
+func unparenthesizedNode(node Node) Node {
+
+	for node.Kind() == parser.CLAUSE && len(node.Children()) == 1 {
+		node = node.Children()[0]
+	}
+	return node
+}
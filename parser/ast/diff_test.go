@@ -0,0 +1,53 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func TestDiff(t *testing.T) {
+
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"[a] > 1 && [b] && [c]", "[a] > 1 && [b]  &&  [c]", ""},
+		{"[a] && [b] && [c]", "[a] && [b] && [c] && [d]", "ADD [d]"},
+		{"[a] && [b] && [c]", "[a] && [c]", "REMOVE [b]"},
+		{"[a] && [x] > 1 && [c]", "[a] && [x] >= 1 && [c]", "CHANGE [x] > 1 -> [x] >= 1"},
+		{"f(1, 3)", "f(1, 2, 3)", "ADD 2"},
+	}
+
+	options := parser.ParserOptions{
+		Functions: map[string]parser.ExpressionFunction{"f": {Name: "f"}},
+	}
+
+	for _, test := range tests {
+		a, err := Parse(test.a, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(test.b, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var edits []string
+		for _, edit := range Diff(a, b) {
+			switch edit.Op {
+			case EDIT_ADD:
+				edits = append(edits, "ADD "+test.b[edit.New.Pos():edit.New.End()])
+			case EDIT_REMOVE:
+				edits = append(edits, "REMOVE "+test.a[edit.Old.Pos():edit.Old.End()])
+			case EDIT_CHANGE:
+				edits = append(edits, "CHANGE "+test.a[edit.Old.Pos():edit.Old.End()]+" -> "+test.b[edit.New.Pos():edit.New.End()])
+			}
+		}
+
+		if got := strings.Join(edits, "; "); got != test.want {
+			t.Errorf("Diff(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package ast
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+HashOptions controls what Hash leaves out of the hash of a tree.
+*/
+type HashOptions struct {
+
+	// Hash variables by the order they're first referenced in rather than by name,
+	// so that a > 1 && b < a has the same hash as x > 1 && y < x, though not as x > 1 && x < y.
+	// The parameters of lambdas are renamed in the same way.
+	IgnoreVariableNames bool
+}
+
+/*
+Hash returns a hex-encoded SHA-256 hash of the tree rooted at [node], for finding duplicate expressions
+and as a key for caching what is computed from them.
+
+Trees which are equal as parser.Equal compares them have the same hash, however they were formatted:
+whitespace, the spelling of operators (and for &&) and source positions make no difference,
+and neither does writing a call as a pipeline. Parentheses do, as they're part of the tree;
+Canonicalize the tree first to hash a + b and (b + a) the same.
+*/
+func Hash(node Node, options HashOptions) string {
+
+	hasher := &treeHasher{hash: sha256.New(), options: options, names: map[string]int{}}
+	if node != nil {
+		hasher.node(node.source())
+	}
+	return hex.EncodeToString(hasher.hash.Sum(nil))
+}
+
+type treeHasher struct {
+	hash    hash.Hash
+	options HashOptions
+
+	// the order each variable was first referenced in, when IgnoreVariableNames is set
+	names map[string]int
+}
+
+func (h *treeHasher) node(tree *parser.ASTNode) {
+
+	if tree.Token == nil {
+		h.field("")
+		return
+	}
+
+	h.field(tree.Token.Kind.String())
+	if tree.Token.Value == nil {
+		h.field(h.name(tree.Token.Kind, tree.Token.Raw))
+	} else {
+		h.value(tree.Token.Kind, tree.Token.Value)
+	}
+
+	h.field(strconv.Itoa(len(tree.Children)))
+	for _, child := range tree.Children {
+		h.node(child)
+	}
+}
+
+func (h *treeHasher) value(kind parser.TokenKind, value interface{}) {
+
+	switch v := value.(type) {
+	case string:
+		h.field("string", h.name(kind, v))
+	case bool:
+		h.field("bool", strconv.FormatBool(v))
+	case int64:
+		h.field("int64", strconv.FormatInt(v, 10))
+	case float64:
+		h.field("float64", strconv.FormatFloat(v, 'g', -1, 64))
+	case *big.Int:
+		h.field("big.Int", v.String())
+	case *big.Rat:
+		h.field("big.Rat", v.String())
+	case time.Time:
+		h.field("time", v.UTC().Format(time.RFC3339Nano))
+	case time.Duration:
+		h.field("duration", strconv.FormatInt(int64(v), 10))
+	case *regexp.Regexp:
+		h.field("regexp", v.String())
+	case parser.ExpressionFunction:
+		h.field("function", v.Name)
+	case []string:
+		h.field("segments", strconv.Itoa(len(v)))
+		h.segments(kind, v)
+	case parser.OptionalAccessor:
+		h.field("accessor", strconv.Itoa(len(v.Segments)))
+		h.segments(kind, v.Segments)
+		for _, nilSafe := range v.NilSafe {
+			h.field(strconv.FormatBool(nilSafe))
+		}
+	case parser.InterpolatedString:
+		// the embedded expressions are the node's children
+		h.field("interpolated", strconv.Itoa(len(v.Segments)))
+		h.field(v.Segments...)
+	default:
+		h.field(fmt.Sprintf("%T", v), fmt.Sprint(v))
+	}
+}
+
+/*
+Hashes the [segments] of an accessor, the first of which names a variable, or the parameters of a lambda.
+*/
+func (h *treeHasher) segments(kind parser.TokenKind, segments []string) {
+
+	for i, segment := range segments {
+		if i == 0 || kind == parser.LAMBDA {
+			segment = h.name(parser.VARIABLE, segment)
+		}
+		h.field(segment)
+	}
+}
+
+/*
+Returns what to hash for [text] of a token of the given [kind], which is its place in order of first reference
+if it names a variable and variable names are ignored.
+*/
+func (h *treeHasher) name(kind parser.TokenKind, text string) string {
+
+	if !h.options.IgnoreVariableNames || kind != parser.VARIABLE {
+		return text
+	}
+
+	i, found := h.names[text]
+	if !found {
+		i = len(h.names)
+		h.names[text] = i
+	}
+	return "$" + strconv.Itoa(i)
+}
+
+/*
+Writes each of [fields] prefixed with its length, so that no two different sequences of fields hash the same.
+*/
+func (h *treeHasher) field(fields ...string) {
+
+	for _, field := range fields {
+		fmt.Fprintf(h.hash, "%d:%s", len(field), field)
+	}
+}
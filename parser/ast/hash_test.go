@@ -0,0 +1,55 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func hashOf(t *testing.T, expression string, options HashOptions) string {
+	t.Helper()
+
+	root, err := Parse(expression, parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{"f": {Name: "f"}}})
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expression, err)
+	}
+	return Hash(root, options)
+}
+
+func TestHash(t *testing.T) {
+
+	tests := []struct {
+		a, b    string
+		options HashOptions
+		same    bool
+	}{
+		{"[a] > 1 && [b]", "[a]>1   and\n[b]", HashOptions{}, true},
+		{"f([xs])", "[xs] |> f()", HashOptions{}, true},
+		{"[a] + [b]", "[b] + [a]", HashOptions{}, false},
+		{"[a] + [b]", "([a] + [b])", HashOptions{}, false},
+		{"[a] == 1", "[a] == '1'", HashOptions{}, false},
+		{"[a] == 1", "[a] == 2", HashOptions{}, false},
+		{"[ab] == [c]", "[a] == [bc]", HashOptions{}, false},
+
+		{"[a] > 1 && [b] < [a]", "[x] > 1 && [y] < [x]", HashOptions{IgnoreVariableNames: true}, true},
+		{"[a] > 1 && [b] < [a]", "[x] > 1 && [x] < [y]", HashOptions{IgnoreVariableNames: true}, false},
+		{"a.Total > 1", "b.Total > 1", HashOptions{IgnoreVariableNames: true}, true},
+		{"a.Total > 1", "a.Count > 1", HashOptions{IgnoreVariableNames: true}, false},
+		{"[a] == 'a'", "[b] == 'b'", HashOptions{IgnoreVariableNames: true}, false},
+		{"[a] > 1", "[x] > 1", HashOptions{}, false},
+	}
+
+	for _, test := range tests {
+		a, b := hashOf(t, test.a, test.options), hashOf(t, test.b, test.options)
+		if (a == b) != test.same {
+			t.Errorf("%q and %q with %+v: same hash is %v, want %v", test.a, test.b, test.options, a == b, test.same)
+		}
+	}
+
+	if len(hashOf(t, "[a]", HashOptions{})) != 64 {
+		t.Error("Hash should give a hex-encoded SHA-256")
+	}
+	if Hash(nil, HashOptions{}) == hashOf(t, "[a]", HashOptions{}) {
+		t.Error("Hash(nil) should differ from the hash of any tree")
+	}
+}
@@ -0,0 +1,34 @@
+package ast
+
+import (
+	"encoding/json"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+MarshalJSON encodes the tree rooted at the node as parser.ASTNode does, so that Nodes can be passed to json.Marshal.
+*/
+func (n *node) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.tree)
+}
+
+/*
+Decode decodes a tree encoded by json.Marshal, from either a Node or a *parser.ASTNode,
+returning an error if it doesn't satisfy the invariants checked by Validate.
+*/
+func Decode(data []byte) (Node, error) {
+
+	var tree parser.ASTNode
+
+	err := json.Unmarshal(data, &tree)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := wrap(&tree, nil, nil)
+	if err := Validate(ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,76 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+
+	tests := []string{
+		"[a] > 1.5 && [s] == 'x'",
+		"[b] ? f([c], 2) : null",
+		"[x] in (1, 2, 3) || !([y] =~ 'a.*')",
+		"m.Key ?? -[n]",
+	}
+	options := parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{"f": {Name: "f"}}}
+
+	for _, expression := range tests {
+		root, err := Parse(expression, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := json.Marshal(root)
+		if err != nil {
+			t.Fatalf("%q: %v", expression, err)
+		}
+
+		// a Node encodes as the parser's tree does
+		tree, err := json.Marshal(ToParser(root))
+		if err != nil {
+			t.Fatalf("%q: %v", expression, err)
+		}
+		if !bytes.Equal(data, tree) {
+			t.Errorf("%q encodes as\n%s\nwhere the parser's tree encodes as\n%s", expression, data, tree)
+		}
+
+		decoded, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%q: %v", expression, err)
+		}
+		if !parser.Equal(ToParser(decoded), ToParser(root)) {
+			t.Errorf("%q decodes into a different tree", expression)
+		}
+		if decoded.Pos() != root.Pos() || decoded.End() != root.End() {
+			t.Errorf("%q decodes with the span [%d, %d), want [%d, %d)", expression, decoded.Pos(), decoded.End(), root.Pos(), root.End())
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+
+	root, err := Parse("[a] + 1", parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a '+' with a single operand
+	tree := ToParser(root)
+	tree.Children = tree.Children[:1]
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decode(data); err == nil || !strings.Contains(err.Error(), "has 1 children, expected 2") {
+		t.Errorf("decoding a '+' with one operand: got %v", err)
+	}
+	if _, err := Decode([]byte("{")); err == nil {
+		t.Error("decoding malformed JSON should fail")
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Package ast is the public syntax tree of an expression, for tools built on top of the parser
+(linters, transpilers, refactorings) which need a stable API rather than the parser's own *parser.ASTNode.
+
+A tree is read through the Node interface: each node has a kind, the token it was built from,
+its children in source order, its parent, and the span of source it covers.
+Trees are built either from the parser's output, with Parse or FromParser, or by hand with New,
+and turned back into a *parser.ASTNode with ToParser, e.g. for generating code.
+
+Nodes are immutable once built, so a tree may be shared between goroutines.
+*/
+package ast
+
+import (
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+Node is a node of the syntax tree.
+
+Every Node in a tree satisfies the invariants checked by Validate: it has as many children as its kind takes,
+and each of its children has it as their Parent.
+*/
+type Node interface {
+
+	// the kind of the node's token, such as parser.COMPARATOR or parser.FUNCTION
+	Kind() parser.TokenKind
+
+	// a copy of the token the node was built from
+	Token() parser.ExpressionToken
+
+	// the node's children in source order; the slice is a copy
+	Children() []Node
+
+	// the node this one is a child of, or nil for the root of a tree
+	Parent() Node
+
+	// the innermost scope the node is within; that of a LAMBDA node is the one binding its parameters
+	Scope() *Scope
+
+	// Pos and End are the character offsets of the start and end of the source covered by the node and its children;
+	// both are 0 for a tree built from tokens without positions.
+	Pos() int
+	End() int
+
+	// whether a FUNCTION node was written as a pipeline, a |> f, whose first child is the piped value
+	Piped() bool
+
+	// the comments attached before and after the node, when it was parsed from tokens keeping them; the slice is a copy
+	Comments() []parser.Comment
+
+	source() *parser.ASTNode
+}
+
+type node struct {
+	tree     *parser.ASTNode
+	parent   *node
+	children []*node
+	scope    *Scope
+
+	pos int
+	end int
+}
+
+/*
+Parse tokenizes and parses [expression] with the given [options], returning the root of its syntax tree.
+*/
+func Parse(expression string, options parser.ParserOptions) (Node, error) {
+
+	tokens, err := parser.ParseTokensWithOptions(expression, options)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return FromParser(tree), nil
+}
+
+/*
+FromParser returns a Node for the tree rooted at [tree], as returned by parser.Parser.Parse.
+The tree is copied, so later changes to it don't show through the returned Node.
+Returns nil if [tree] is nil.
+*/
+func FromParser(tree *parser.ASTNode) Node {
+
+	if tree == nil {
+		return nil
+	}
+	return wrap(tree.Clone(), nil, nil)
+}
+
+/*
+New returns a node for [token] with the given [children], after checking that the token's kind takes that many children.
+A child which already belongs to another tree is copied, so that building a new tree never changes an existing one.
+*/
+func New(token parser.ExpressionToken, children ...Node) (Node, error) {
+
+	tree := &parser.ASTNode{Token: &token, Children: make([]*parser.ASTNode, 0, len(children))}
+	for _, child := range children {
+		if child == nil {
+			return nil, invariantError(tree, "has a nil child")
+		}
+		tree.Children = append(tree.Children, child.source().Clone())
+	}
+
+	if err := checkArity(tree); err != nil {
+		return nil, err
+	}
+	return wrap(tree, nil, nil), nil
+}
+
+/*
+ToParser returns a copy of the tree rooted at [n] as a *parser.ASTNode, which can then be passed to Generate or InferType.
+Returns nil if [n] is nil.
+*/
+func ToParser(n Node) *parser.ASTNode {
+
+	if n == nil {
+		return nil
+	}
+	return n.source().Clone()
+}
+
+func wrap(tree *parser.ASTNode, parent *node, scope *Scope) *node {
+
+	ret := &node{tree: tree, parent: parent, children: make([]*node, 0, len(tree.Children))}
+	ret.scope = scopeFor(ret, scope)
+
+	if tree.Token != nil && tree.Token.End > tree.Token.Start {
+		ret.pos, ret.end = tree.Token.Start, tree.Token.End
+	}
+
+	for _, child := range tree.Children {
+		if child == nil {
+			continue
+		}
+		wrapped := wrap(child, ret, ret.scope)
+		ret.children = append(ret.children, wrapped)
+		ret.cover(wrapped)
+	}
+	return ret
+}
+
+/*
+Widens the span of the node to cover that of [child]. Synthesized tokens, such as the ARRAY of a list
+written in parentheses, have no width and so no position of their own.
+*/
+func (n *node) cover(child *node) {
+
+	if child.end <= child.pos {
+		return
+	}
+	if n.end <= n.pos {
+		n.pos, n.end = child.pos, child.end
+		return
+	}
+	if child.pos < n.pos {
+		n.pos = child.pos
+	}
+	if child.end > n.end {
+		n.end = child.end
+	}
+}
+
+func (n *node) Kind() parser.TokenKind {
+
+	if n.tree.Token == nil {
+		return parser.UNKNOWN
+	}
+	return n.tree.Token.Kind
+}
+
+func (n *node) Token() parser.ExpressionToken {
+
+	if n.tree.Token == nil {
+		return parser.ExpressionToken{}
+	}
+	return *n.tree.Token
+}
+
+func (n *node) Children() []Node {
+
+	ret := make([]Node, len(n.children))
+	for i, child := range n.children {
+		ret[i] = child
+	}
+	return ret
+}
+
+func (n *node) Parent() Node {
+
+	// a nil *node must not be returned as a non-nil Node
+	if n.parent == nil {
+		return nil
+	}
+	return n.parent
+}
+
+func (n *node) Scope() *Scope {
+	return n.scope
+}
+
+func (n *node) Pos() int {
+	return n.pos
+}
+
+func (n *node) End() int {
+	return n.end
+}
+
+func (n *node) Piped() bool {
+	return n.tree.Piped
+}
+
+func (n *node) Comments() []parser.Comment {
+	return append([]parser.Comment(nil), n.tree.Comments...)
+}
+
+func (n *node) source() *parser.ASTNode {
+	return n.tree
+}
@@ -0,0 +1,109 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func TestParse(t *testing.T) {
+
+	expression := "[a] > 1 && f([b], 'x') == 2"
+	root, err := Parse(expression, parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{"f": {Name: "f"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if root.Kind() != parser.LOGICALOP || root.Parent() != nil || root.Pos() != 0 || root.End() != len(expression) {
+		t.Errorf("root is %v at [%d, %d) with parent %v, want the && over the whole expression", root.Kind(), root.Pos(), root.End(), root.Parent())
+	}
+
+	children := root.Children()
+	if len(children) != 2 {
+		t.Fatalf("&& has %d children, want 2", len(children))
+	}
+	for i, want := range []string{"[a] > 1", "f([b], 'x') == 2"} {
+		child := children[i]
+		if got := expression[child.Pos():child.End()]; got != want {
+			t.Errorf("child %d spans %q, want %q", i, got, want)
+		}
+		if child.Parent() != root {
+			t.Errorf("child %d isn't linked to the root", i)
+		}
+	}
+
+	call := children[1].Children()[0]
+	if call.Kind() != parser.FUNCTION || len(call.Children()) != 2 || call.Children()[1].Token().Value != "x" {
+		t.Errorf("f([b], 'x') is %v with %d children", call.Kind(), len(call.Children()))
+	}
+}
+
+func TestNew(t *testing.T) {
+
+	a, _ := New(parser.ExpressionToken{Kind: parser.VARIABLE, Raw: "a", Value: "a"})
+	one, _ := New(parser.ExpressionToken{Kind: parser.NUMERIC, Raw: "1", Value: 1.0})
+
+	sum, err := New(parser.ExpressionToken{Kind: parser.MODIFIER, Raw: "+", Value: "+"}, a, one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(sum); err != nil {
+		t.Fatal(err)
+	}
+	if generated := (parser.Formatter{MaxWidth: -1}).Format(ToParser(sum)); generated != "[a] + 1" {
+		t.Errorf("New gives %q, want [a] + 1", generated)
+	}
+
+	// a child from another tree is copied rather than moved
+	if a.Parent() != nil || sum.Children()[0].Parent() != sum {
+		t.Error("New linked the child into both trees")
+	}
+
+	tests := []struct {
+		token    parser.ExpressionToken
+		children []Node
+		err      string
+	}{
+		{parser.ExpressionToken{Kind: parser.MODIFIER, Raw: "+"}, []Node{a}, "has 1 children, expected 2"},
+		{parser.ExpressionToken{Kind: parser.NUMERIC, Raw: "1"}, []Node{a}, "has 1 children, expected 0"},
+		{parser.ExpressionToken{Kind: parser.PREFIX, Raw: "-"}, []Node{nil}, "has a nil child"},
+		{parser.ExpressionToken{Kind: parser.SEPARATOR, Raw: ","}, nil, "cannot appear in a syntax tree"},
+	}
+	for _, test := range tests {
+		if _, err := New(test.token, test.children...); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("New(%v '%s'): got %v, want an error that it %s", test.token.Kind, test.token.Raw, err, test.err)
+		}
+	}
+}
+
+func TestFromParserCopies(t *testing.T) {
+
+	tokens, err := parser.ParseTokens("[a] + 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := FromParser(tree)
+	tree.Children[0].Token.Raw = "changed"
+	if raw := root.Children()[0].Token().Raw; raw != "a" {
+		t.Errorf("changing the parser's tree changed the Node into %q", raw)
+	}
+
+	back := ToParser(root)
+	back.Token.Raw = "-"
+	if raw := root.Token().Raw; raw != "+" {
+		t.Errorf("changing the tree from ToParser changed the Node into %q", raw)
+	}
+
+	if FromParser(nil) != nil || ToParser(nil) != nil {
+		t.Error("FromParser(nil) and ToParser(nil) should be nil")
+	}
+}
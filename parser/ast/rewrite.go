@@ -0,0 +1,173 @@
+package ast
+
+import (
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+Rewrite returns a copy of the tree rooted at [node] with nodes replaced as [f] decides.
+f is called for each node in depth-first order, parents before children: if it returns (replacement, true),
+the node and its subtree are replaced with [replacement], which isn't walked itself;
+if it returns false, the node is kept and its children are rewritten in turn.
+The original tree is left unchanged.
+
+For example, to replace the calls of a deprecated function:
+
+	rewritten, err := ast.Rewrite(root, func(n ast.Node) (ast.Node, bool) {
+		if n.Kind() != parser.FUNCTION || n.Token().Raw != "strlen" {
+			return n, false
+		}
+		token := n.Token()
+		token.Raw = "len"
+		replacement, _ := ast.New(token, n.Children()...)
+		return replacement, true
+	})
+
+Spans are kept consistent: a replacement which lies within the span of the node it replaces, such as one of the node's
+own children, keeps its positions; any other replacement, whether built with New or taken from another expression,
+has the positions of all of its tokens set to the span of the node it replaces.
+The comments attached to a replaced node are moved to its replacement, unless the replacement already holds them.
+Returns an error if [f] replaces a node with nil.
+*/
+func Rewrite(node Node, f func(Node) (Node, bool)) (Node, error) {
+
+	if node == nil {
+		return nil, nil
+	}
+
+	tree, err := rewrite(node, f)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(tree, nil, nil), nil
+}
+
+func rewrite(n Node, f func(Node) (Node, bool)) (*parser.ASTNode, error) {
+
+	if replacement, replaced := f(n); replaced {
+
+		if replacement == nil {
+			return nil, invariantError(n.source(), "was replaced with nil")
+		}
+
+		tree := replacement.source().Clone()
+		if !within(replacement, n) {
+			relocate(tree, n.source())
+		}
+		keepComments(tree, n.source())
+		return tree, nil
+	}
+
+	tree := &parser.ASTNode{Piped: n.Piped(), Comments: n.Comments(), Children: []*parser.ASTNode{}}
+	if token := n.source().Token; token != nil {
+		copied := *token
+		tree.Token = &copied
+	}
+
+	for _, child := range n.Children() {
+		rewritten, err := rewrite(child, f)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = append(tree.Children, rewritten)
+	}
+	return tree, nil
+}
+
+/*
+Reports whether the [replacement] lies within the span of [original]. A replacement without a position never does,
+unless the original hasn't one either.
+*/
+func within(replacement Node, original Node) bool {
+
+	if replacement.End() <= replacement.Pos() {
+		return original.End() <= original.Pos()
+	}
+	return replacement.Pos() >= original.Pos() && replacement.End() <= original.End()
+}
+
+/*
+Sets the position of every token in [tree] to the span of the [original] subtree,
+running from the start of its first token to the end of its last.
+*/
+func relocate(tree *parser.ASTNode, original *parser.ASTNode) {
+
+	first, last := spanTokens(original, nil, nil)
+
+	var span parser.ExpressionToken
+	if first != nil {
+		span.Start, span.Line, span.Column = first.Start, first.Line, first.Column
+		span.StartByte, span.StartUTF16 = first.StartByte, first.StartUTF16
+		span.End, span.EndByte, span.EndUTF16 = last.End, last.EndByte, last.EndUTF16
+	}
+
+	setSpan(tree, span)
+}
+
+func spanTokens(tree *parser.ASTNode, first *parser.ExpressionToken, last *parser.ExpressionToken) (*parser.ExpressionToken, *parser.ExpressionToken) {
+
+	if token := tree.Token; token != nil && token.End > token.Start {
+		if first == nil || token.Start < first.Start {
+			first = token
+		}
+		if last == nil || token.End > last.End {
+			last = token
+		}
+	}
+
+	for _, child := range tree.Children {
+		first, last = spanTokens(child, first, last)
+	}
+	return first, last
+}
+
+/*
+Attaches the comments of the [original] node which [tree] doesn't already hold to the root of [tree]:
+its leading comments before those of [tree], and its trailing ones after.
+*/
+func keepComments(tree *parser.ASTNode, original *parser.ASTNode) {
+
+	if len(original.Comments) == 0 {
+		return
+	}
+
+	held := map[int]bool{}
+	var collect func(tree *parser.ASTNode)
+	collect = func(tree *parser.ASTNode) {
+		for _, comment := range tree.Comments {
+			held[comment.Start] = true
+		}
+		for _, child := range tree.Children {
+			collect(child)
+		}
+	}
+	collect(tree)
+
+	var leading, trailing []parser.Comment
+	for _, comment := range original.Comments {
+		switch {
+		case held[comment.Start]:
+		case comment.Trailing:
+			trailing = append(trailing, comment)
+		default:
+			leading = append(leading, comment)
+		}
+	}
+
+	comments := append(leading, tree.Comments...)
+	tree.Comments = append(comments, trailing...)
+}
+
+func setSpan(tree *parser.ASTNode, span parser.ExpressionToken) {
+
+	if token := tree.Token; token != nil {
+		token.Start, token.End = span.Start, span.End
+		token.Line, token.Column = span.Line, span.Column
+		token.StartByte, token.EndByte = span.StartByte, span.EndByte
+		token.StartUTF16, token.EndUTF16 = span.StartUTF16, span.EndUTF16
+	}
+
+	for _, child := range tree.Children {
+		setSpan(child, span)
+	}
+}
@@ -0,0 +1,140 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func TestRewrite(t *testing.T) {
+
+	expression := "strlen([s]) > 1 && [a] * 1 == [b]"
+	root, err := Parse(expression, parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{"strlen": {Name: "strlen"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewritten, err := Rewrite(root, func(n Node) (Node, bool) {
+
+		switch {
+		case n.Kind() == parser.FUNCTION && n.Token().Raw == "strlen":
+			token := n.Token()
+			token.Raw = "len"
+			replacement, _ := New(token, n.Children()...)
+			return replacement, true
+
+		// [a] * 1 becomes [a]
+		case n.Kind() == parser.MODIFIER && n.Token().Raw == "*" && n.Children()[1].Token().Raw == "1":
+			return n.Children()[0], true
+		}
+		return n, false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(rewritten); err != nil {
+		t.Fatal(err)
+	}
+
+	if generated := (parser.Formatter{MaxWidth: -1}).Format(ToParser(rewritten)); generated != "len( [s] ) > 1 && [a] == [b]" {
+		t.Errorf("Rewrite gives %q", generated)
+	}
+	if generated := (parser.Formatter{MaxWidth: -1}).Format(ToParser(root)); generated != "strlen( [s] ) > 1 && [a] * 1 == [b]" {
+		t.Errorf("Rewrite changed the original tree into %q", generated)
+	}
+
+	// a child of the node it replaces keeps its position
+	a := rewritten.Children()[1].Children()[0]
+	if got := expression[a.Pos():a.End()]; got != "[a]" {
+		t.Errorf("[a] moved to %q", got)
+	}
+}
+
+func TestRewriteRelocates(t *testing.T) {
+
+	expression := "[x] + [y]"
+	root, err := Parse(expression, parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Parse("[long_name] - 100", parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a replacement from another expression takes the span of the node it replaces
+	rewritten, err := Rewrite(root, func(n Node) (Node, bool) {
+		if n.Kind() == parser.VARIABLE && n.Token().Raw == "y" {
+			return other, true
+		}
+		return n, false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(rewritten); err != nil {
+		t.Fatal(err)
+	}
+
+	replaced := rewritten.Children()[1]
+	Inspect(replaced, func(n Node) bool {
+		if n != nil && expression[n.Pos():n.End()] != "[y]" {
+			t.Errorf("'%s' spans %q, want the [y] it replaced", n.Token().Raw, expression[n.Pos():n.End()])
+		}
+		return true
+	})
+	if other.Children()[1].Pos() != len("[long_name] - ") {
+		t.Error("Rewrite moved the tokens of the replacement's own tree")
+	}
+}
+
+func TestRewriteKeepsComments(t *testing.T) {
+
+	root, err := Parse("[a] && /* always */ true", parser.ParserOptions{KeepComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the comment isn't lost with the node which held it
+	rewritten, err := Rewrite(root, func(n Node) (Node, bool) {
+		if n.Kind() == parser.LOGICALOP {
+			return n.Children()[0], true
+		}
+		return n, false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var comments []string
+	Inspect(rewritten, func(n Node) bool {
+		if n != nil {
+			for _, comment := range n.Comments() {
+				comments = append(comments, comment.Text)
+			}
+		}
+		return true
+	})
+	if len(comments) != 1 || comments[0] != "/* always */" {
+		t.Errorf("the rewritten tree has the comments %q, want /* always */", comments)
+	}
+}
+
+func TestRewriteNil(t *testing.T) {
+
+	root, err := Parse("[a] + 1", parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Rewrite(root, func(n Node) (Node, bool) {
+		return nil, n.Kind() == parser.NUMERIC
+	})
+	if err == nil || !strings.Contains(err.Error(), "was replaced with nil") {
+		t.Errorf("replacing a node with nil: got %v", err)
+	}
+
+	if rewritten, err := Rewrite(nil, nil); rewritten != nil || err != nil {
+		t.Errorf("Rewrite(nil) gives %v, %v", rewritten, err)
+	}
+}
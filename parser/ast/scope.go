@@ -0,0 +1,112 @@
+package ast
+
+import (
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+A Scope is a region of a tree in which a set of names is bound: that of the whole tree, which binds nothing,
+and that of each lambda, which binds its parameters within its body.
+Scopes are built along with the tree, so that asking whether a name is bound doesn't walk the tree again.
+*/
+type Scope struct {
+	node   Node
+	parent *Scope
+	names  []string
+}
+
+/*
+Returns the node opening the scope: the LAMBDA whose parameters it binds, or the root of the tree for the outermost scope.
+*/
+func (s *Scope) Node() Node {
+	return s.node
+}
+
+/*
+Returns the scope enclosing this one, or nil for the outermost scope.
+*/
+func (s *Scope) Parent() *Scope {
+	return s.parent
+}
+
+/*
+Returns the names bound by the scope itself, in the order the lambda declares them; the slice is a copy.
+*/
+func (s *Scope) Names() []string {
+	return append([]string(nil), s.names...)
+}
+
+/*
+Lookup returns the innermost scope, from this one outwards, which binds [name], or nil if [name] is free here.
+*/
+func (s *Scope) Lookup(name string) *Scope {
+
+	for current := s; current != nil; current = current.parent {
+		for _, bound := range current.names {
+			if bound == name {
+				return current
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Returns the scope a LAMBDA [n] opens within [enclosing], or [enclosing] for any other node;
+the root of a tree, whose [enclosing] is nil, opens the outermost scope.
+*/
+func scopeFor(n *node, enclosing *Scope) *Scope {
+
+	if enclosing == nil {
+		enclosing = &Scope{node: n}
+	}
+	if n.tree.Token == nil || n.tree.Token.Kind != parser.LAMBDA {
+		return enclosing
+	}
+
+	parameters, _ := n.tree.Token.Value.([]string)
+	return &Scope{node: n, parent: enclosing, names: append([]string(nil), parameters...)}
+}
+
+/*
+IsFree reports whether [node] is a VARIABLE, ACCESSOR or METHOD node referring to a variable of the expression,
+rather than to the parameter of an enclosing lambda.
+*/
+func IsFree(node Node) bool {
+
+	switch node.Kind() {
+	case parser.VARIABLE, parser.ACCESSOR, parser.METHOD:
+	default:
+		return false
+	}
+
+	name, ok := parser.RootName(node.Token())
+	return ok && node.Scope().Lookup(name) == nil
+}
+
+/*
+Enclosing returns the nearest ancestor of [node] of one of the given [kinds], or nil if there is none;
+with no kinds, it is node.Parent(). The node itself is never returned.
+*/
+func Enclosing(node Node, kinds ...parser.TokenKind) Node {
+
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if len(kinds) == 0 {
+			return parent
+		}
+		for _, kind := range kinds {
+			if parent.Kind() == kind {
+				return parent
+			}
+		}
+	}
+	return nil
+}
+
+/*
+EnclosingClause returns the innermost parenthesized clause containing [node], or nil if it isn't within parentheses,
+as an editor's "select enclosing clause" would. A list written in parentheses, as on the right of 'in', isn't a clause.
+*/
+func EnclosingClause(node Node) Node {
+	return Enclosing(node, parser.CLAUSE)
+}
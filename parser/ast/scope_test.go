@@ -0,0 +1,95 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func TestScope(t *testing.T) {
+
+	expression := "filter([xs], x -> any(x.Items, y -> y.Price > x.Limit && [z])) || ([y] && ([x] in (1, 2)))"
+	root, err := Parse(expression, parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{
+		"filter": {Name: "filter"},
+		"any":    {Name: "any"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the nodes of each reference, by the text they span
+	references := map[string][]Node{}
+	Inspect(root, func(n Node) bool {
+		if n != nil {
+			switch n.Kind() {
+			case parser.VARIABLE, parser.ACCESSOR, parser.LAMBDA:
+				text := expression[n.Pos():n.End()]
+				references[text] = append(references[text], n)
+			}
+		}
+		return true
+	})
+	find := func(text string) Node {
+		t.Helper()
+		if len(references[text]) != 1 {
+			t.Fatalf("%d references span %q", len(references[text]), text)
+		}
+		return references[text][0]
+	}
+
+	outer := root.Scope()
+	if outer.Node() != root || outer.Parent() != nil || len(outer.Names()) != 0 {
+		t.Errorf("the outermost scope is opened by %v with parent %v, binding %v", outer.Node(), outer.Parent(), outer.Names())
+	}
+
+	price := find("y.Price")
+	inner := price.Scope()
+	if !reflect.DeepEqual(inner.Names(), []string{"y"}) || inner.Node().Kind() != parser.LAMBDA {
+		t.Errorf("y.Price is in a scope opened by %v, binding %v", inner.Node().Kind(), inner.Names())
+	}
+	middle := inner.Parent()
+	if !reflect.DeepEqual(middle.Names(), []string{"x"}) || middle.Parent() != outer {
+		t.Errorf("the scope around y's binds %v", middle.Names())
+	}
+	if inner.Lookup("x") != middle || inner.Lookup("y") != inner || inner.Lookup("z") != nil || outer.Lookup("x") != nil {
+		t.Error("Lookup finds the wrong scopes")
+	}
+
+	// Names is a copy
+	inner.Names()[0] = "changed"
+	if inner.Lookup("y") != inner {
+		t.Error("changing the result of Names changed the scope")
+	}
+
+	for text, free := range map[string]bool{
+		"x.Items": false,
+		"y.Price": false,
+		"x.Limit": false,
+		"[z]":     true,
+		"[xs]":    true,
+		"[y]":     true,
+		"[x]":     true,
+	} {
+		if IsFree(find(text)) != free {
+			t.Errorf("%q is free: %v, want %v", text, !free, free)
+		}
+	}
+	if IsFree(root) {
+		t.Error("the || isn't a variable, and so isn't free")
+	}
+
+	x := find("[x]")
+	if clause := EnclosingClause(x); clause == nil || expression[clause.Pos():clause.End()] != "([x] in (1, 2" {
+		t.Errorf("[x] is within the clause %v", clause)
+	}
+	if clause := EnclosingClause(find("[z]")); clause != nil {
+		t.Errorf("[z] isn't within parentheses, but EnclosingClause gives %v", clause)
+	}
+	if lambda := Enclosing(price, parser.LAMBDA, parser.FUNCTION); lambda != inner.Node() {
+		t.Errorf("Enclosing(y.Price) gives %v, want its lambda", lambda)
+	}
+	if Enclosing(price) != price.Parent() || Enclosing(root) != nil {
+		t.Error("Enclosing with no kinds should be Parent")
+	}
+}
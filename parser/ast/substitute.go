@@ -0,0 +1,43 @@
+package ast
+
+import (
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+Substitute returns a copy of the tree rooted at [node] with each variable named in [substitutions] replaced by its expression,
+so that a rule shared between others can be inlined into them. With isAdult = age >= 18,
+
+	isAdult && country == 'FR'
+
+becomes age >= 18 && country == 'FR', and parentheses are added where an expression needs them to keep its grouping,
+so that x * 2 with x = a + b becomes (a + b) * 2.
+
+Only whole variables are replaced: the root of an accessor such as user.Name isn't, since an expression can't be accessed into,
+and neither is a variable which is the parameter of an enclosing lambda. The substituted expressions aren't searched themselves,
+so a substitution which refers to another variable being substituted keeps that variable.
+The substituted nodes have the span of the variables they replace, as with Rewrite.
+Returns an error if a substitution is nil.
+*/
+func Substitute(node Node, substitutions map[string]Node) (Node, error) {
+
+	if node == nil {
+		return nil, nil
+	}
+
+	ret, err := Rewrite(node, func(node Node) (Node, bool) {
+
+		if node.Kind() != parser.VARIABLE || !IsFree(node) {
+			return node, false
+		}
+
+		replacement, found := substitutions[node.Token().Raw]
+		return replacement, found
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret = FromParser(parser.StandardizePrecedence(ToParser(ret)))
+	return ret, Validate(ret)
+}
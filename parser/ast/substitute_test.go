@@ -0,0 +1,74 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func TestSubstitute(t *testing.T) {
+
+	options := parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{"filter": {Name: "filter"}}}
+	parse := func(expression string) Node {
+		t.Helper()
+		root, err := Parse(expression, options)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", expression, err)
+		}
+		return root
+	}
+
+	substitutions := map[string]Node{
+		"isAdult": parse("[age] >= 18"),
+		"x":       parse("[a] + [b]"),
+		"y":       parse("[x] * 3"),
+		"user":    parse("[someone]"),
+	}
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"[isAdult] && [country] == 'FR'", "[age] >= 18 && [country] == 'FR'"},
+		{"[x] * 2", "( [a] + [b] ) * 2"},
+		{"2 + [x]", "2 + ( [a] + [b] )"},
+		{"[x] + 2", "[a] + [b] + 2"},
+		{"[y] > [x]", "[x] * 3 > [a] + [b]"},
+		{"user.Name == [user]", "user.Name == [someone]"},
+		{"filter([xs], x -> [x] > 1 && [isAdult]) || [x] > 0", "filter( [xs], x -> [x] > 1 && [age] >= 18 ) || [a] + [b] > 0"},
+		{"[z]", "[z]"},
+	}
+
+	for _, test := range tests {
+		root := parse(test.expression)
+		substituted, err := Substitute(root, substitutions)
+		if err != nil {
+			t.Errorf("Substitute(%q): %v", test.expression, err)
+			continue
+		}
+
+		if got := (parser.Formatter{MaxWidth: -1}).Format(ToParser(substituted)); got != test.want {
+			t.Errorf("Substitute(%q) gives %q, want %q", test.expression, got, test.want)
+		}
+		if got := (parser.Formatter{MaxWidth: -1}).Format(ToParser(root)); got != (parser.Formatter{MaxWidth: -1}).Format(ToParser(parse(test.expression))) {
+			t.Errorf("Substitute changed the original tree into %q", got)
+		}
+	}
+
+	root := parse("[isAdult] || [z]")
+	substituted, err := Substitute(root, substitutions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Inspect(substituted.Children()[0], func(n Node) bool {
+		if n != nil && (n.Pos() != 0 || n.End() != len("[isAdult]")) {
+			t.Errorf("'%s' spans [%d, %d), want the [isAdult] it replaced", n.Token().Raw, n.Pos(), n.End())
+		}
+		return true
+	})
+
+	if _, err := Substitute(root, map[string]Node{"z": nil}); err == nil || !strings.Contains(err.Error(), "was replaced with nil") {
+		t.Errorf("substituting nil: got %v", err)
+	}
+}
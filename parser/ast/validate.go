@@ -0,0 +1,120 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+Validate checks the invariants of the tree rooted at [n], returning an error describing the first node which breaks one:
+
+  - every node has a token, of a kind which can appear in a syntax tree (not a closing bracket, separator or comment)
+  - binary operators, INDEX and ELVIS have two children; TERNARY and BETWEEN three;
+    PREFIX, NAMED_ARGUMENT and LAMBDA one; literals, variables and accessors none
+  - MAP has a key and a value child for each entry, and INTERPOLATED_STRING one child for each ${} expression
+  - each child has the node as its Parent, and lies within the node's span
+
+Trees built by Parse, FromParser and New from a successfully parsed expression always pass.
+*/
+func Validate(n Node) error {
+
+	if n == nil {
+		return fmt.Errorf("ast: nil node")
+	}
+
+	if err := checkArity(n.source()); err != nil {
+		return err
+	}
+
+	for _, child := range n.Children() {
+
+		if child.Parent() != n {
+			return invariantError(child.source(), "is not linked to its parent")
+		}
+		if child.End() > child.Pos() && (child.Pos() < n.Pos() || child.End() > n.End()) {
+			return invariantError(child.source(), "lies outside the span of its parent")
+		}
+
+		if err := Validate(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Checks that the [tree] node has a token, and as many children as the kind of the token takes.
+*/
+func checkArity(tree *parser.ASTNode) error {
+
+	if tree.Token == nil {
+		return invariantError(tree, "has no token")
+	}
+
+	count := len(tree.Children)
+
+	switch tree.Token.Kind {
+
+	case parser.NUMERIC, parser.BOOLEAN, parser.STRING, parser.PATTERN, parser.TIME, parser.DURATION,
+		parser.NULL, parser.VARIABLE, parser.ACCESSOR:
+		return expectChildren(tree, 0)
+
+	case parser.PREFIX, parser.NAMED_ARGUMENT, parser.LAMBDA:
+		return expectChildren(tree, 1)
+
+	case parser.COMPARATOR, parser.LOGICALOP, parser.MODIFIER, parser.NULL_COALESCE, parser.ELVIS, parser.LIKE,
+		parser.INDEX:
+		return expectChildren(tree, 2)
+
+	case parser.TERNARY, parser.BETWEEN:
+		return expectChildren(tree, 3)
+
+	case parser.MAP:
+		if count%2 != 0 {
+			return invariantError(tree, fmt.Sprintf("has %d children, expected a key and a value for each entry", count))
+		}
+
+	case parser.INTERPOLATED_STRING:
+		value, ok := tree.Token.Value.(parser.InterpolatedString)
+		if !ok {
+			return invariantError(tree, "has no interpolated string value")
+		}
+		return expectChildren(tree, len(value.Expressions))
+
+	case parser.FUNCTION, parser.METHOD, parser.ARRAY, parser.CLAUSE:
+		// any number of arguments or elements
+
+	default:
+		return invariantError(tree, "cannot appear in a syntax tree")
+	}
+
+	for _, child := range tree.Children {
+		if child == nil {
+			return invariantError(tree, "has a nil child")
+		}
+	}
+	return nil
+}
+
+func expectChildren(tree *parser.ASTNode, expected int) error {
+
+	if len(tree.Children) != expected {
+		return invariantError(tree, fmt.Sprintf("has %d children, expected %d", len(tree.Children), expected))
+	}
+
+	for _, child := range tree.Children {
+		if child == nil {
+			return invariantError(tree, "has a nil child")
+		}
+	}
+	return nil
+}
+
+func invariantError(tree *parser.ASTNode, msg string) error {
+
+	if tree.Token == nil {
+		return fmt.Errorf("ast: node %s", msg)
+	}
+	return fmt.Errorf("ast: %v node '%s' at offset %d %s", tree.Token.Kind, tree.Token.Raw, tree.Token.Start, msg)
+}
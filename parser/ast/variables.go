@@ -0,0 +1,57 @@
+package ast
+
+import (
+	"sort"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+A variable referenced within a tree, along with the nodes of every reference to it.
+Name is the root of the reference, as given by parser.RootName.
+*/
+type Variable struct {
+	Name string
+
+	// the VARIABLE, ACCESSOR and METHOD nodes referring to the variable, in source order
+	References []Node
+}
+
+/*
+Variables returns the distinct variables referenced within the tree rooted at [node], in the order they are first referenced,
+leaving out the parameters of a lambda within its body. It is parser.Variables for a Node, giving the positions of
+the references as nodes rather than tokens.
+*/
+func Variables(node Node) []Variable {
+
+	var ret []Variable
+	index := map[string]int{}
+
+	if node != nil {
+		Inspect(node, func(node Node) bool {
+			if node == nil || !IsFree(node) {
+				return true
+			}
+			name, _ := parser.RootName(node.Token())
+			i, found := index[name]
+			if !found {
+				i = len(ret)
+				index[name] = i
+				ret = append(ret, Variable{Name: name})
+			}
+			ret[i].References = append(ret[i].References, node)
+			return true
+		})
+	}
+
+	for _, variable := range ret {
+		references := variable.References
+		sort.SliceStable(references, func(i, j int) bool {
+			return references[i].Pos() < references[j].Pos()
+		})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].References[0].Pos() < ret[j].References[0].Pos()
+	})
+	return ret
+}
@@ -0,0 +1,52 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+func TestVariables(t *testing.T) {
+
+	expression := "order.Total > [a] && filter([items], x -> x.Price > [a]) && [b] == x"
+	root, err := Parse(expression, parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{"filter": {Name: "filter"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := Variables(root)
+
+	var names []string
+	references := map[string][]string{}
+	for _, variable := range variables {
+		names = append(names, variable.Name)
+		for _, reference := range variable.References {
+			references[variable.Name] = append(references[variable.Name], expression[reference.Pos():reference.End()])
+		}
+	}
+
+	// the x outside of the lambda is free, and the x.Price within it isn't
+	if want := []string{"order", "a", "items", "b", "x"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Variables gives %v, want %v", names, want)
+	}
+	want := map[string][]string{
+		"order": {"order.Total"},
+		"a":     {"[a]", "[a]"},
+		"items": {"[items]"},
+		"b":     {"[b]"},
+		"x":     {"x"},
+	}
+	if !reflect.DeepEqual(references, want) {
+		t.Errorf("Variables gives the references %v, want %v", references, want)
+	}
+
+	second := variables[1].References[1]
+	if second.Pos() != len("order.Total > [a] && filter([items], x -> x.Price > ") {
+		t.Errorf("the second reference to [a] is at %d", second.Pos())
+	}
+
+	if Variables(nil) != nil {
+		t.Error("Variables(nil) should be empty")
+	}
+}
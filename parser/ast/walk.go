@@ -0,0 +1,56 @@
+package ast
+
+/*
+A Visitor's Visit method is called by Walk for each node it encounters.
+If the returned visitor w is not nil, Walk visits each of the node's children with w, followed by a call of w.Visit(nil).
+*/
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+/*
+Walk traverses the tree rooted at [node] in depth-first order, as go/ast.Walk does:
+it starts by calling v.Visit(node), and unless that returns nil, walks each of the node's children
+in source order with the returned visitor, then calls Visit(nil) on it.
+*/
+func Walk(v Visitor, node Node) {
+
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range node.Children() {
+		Walk(v, child)
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+/*
+Inspect traverses the tree rooted at [node] in depth-first order, calling f(node) for each node
+and skipping the children of any node for which it returns false.
+Once the children of a node have been inspected, f is called with nil.
+
+For example, to collect the names of all the variables in an expression:
+
+	var names []string
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n != nil && n.Kind() == parser.VARIABLE {
+			names = append(names, n.Token().Raw)
+		}
+		return true
+	})
+*/
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,96 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+)
+
+/*
+Records the raw text of each node visited, and ")" for each call of Visit(nil),
+skipping the children of the nodes whose text is [skip].
+*/
+type recorder struct {
+	visited *[]string
+	skip    string
+}
+
+func (r recorder) Visit(node Node) Visitor {
+
+	if node == nil {
+		*r.visited = append(*r.visited, ")")
+		return nil
+	}
+
+	*r.visited = append(*r.visited, node.Token().Raw)
+	if node.Token().Raw == r.skip {
+		return nil
+	}
+	return r
+}
+
+func TestWalk(t *testing.T) {
+
+	root, err := Parse("[a] + [b] * 2 > -[c]", parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		skip string
+		want []string
+	}{
+		{"", []string{">", "+", "a", ")", "*", "b", ")", "2", ")", ")", ")", "-", "c", ")", ")", ")"}},
+		{"+", []string{">", "+", "-", "c", ")", ")", ")"}},
+		{">", []string{">"}},
+	}
+
+	for _, test := range tests {
+		var visited []string
+		Walk(recorder{visited: &visited, skip: test.skip}, root)
+		if !reflect.DeepEqual(visited, test.want) {
+			t.Errorf("Walk skipping %q visits %v, want %v", test.skip, visited, test.want)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+
+	root, err := Parse("f([a], [b]) && ([c] || g([d]))", parser.ParserOptions{
+		Functions: map[string]parser.ExpressionFunction{"f": {Name: "f"}, "g": {Name: "g"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the variables outside of calls to g
+	var names []string
+	nils := 0
+	Inspect(root, func(n Node) bool {
+		if n == nil {
+			nils++
+			return true
+		}
+		if n.Kind() == parser.VARIABLE {
+			names = append(names, n.Token().Raw)
+		}
+		return n.Kind() != parser.FUNCTION || n.Token().Raw != "g"
+	})
+
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Inspect finds %v, want %v", names, want)
+	}
+
+	// every node walked into is followed by a nil, so all but g and its argument
+	count := 0
+	Inspect(root, func(n Node) bool {
+		if n != nil {
+			count++
+		}
+		return true
+	})
+	if nils != count-2 {
+		t.Errorf("Inspect called f(nil) %d times for %d nodes, want one for each node but g([d]) and [d]", nils, count)
+	}
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+/*
+The JSON form of an ASTNode. Children, Piped and Comments are left out when empty, so that a leaf is just its token.
+*/
+type astJSON struct {
+	Token    *ExpressionToken
+	Children []*ASTNode `json:",omitempty"`
+	Piped    bool       `json:",omitempty"`
+	Comments []Comment  `json:",omitempty"`
+}
+
+/*
+MarshalJSON encodes the node as an object holding its Token, as encoded by ExpressionToken.MarshalJSON,
+and its Children in order. Piped is only written for FUNCTION nodes rewritten from a pipeline,
+and Comments for nodes with comments attached.
+
+The encoding is stable: UnmarshalJSON decodes it back into an equal tree, with the same token kinds,
+raw text, values and positions, which can then be passed to Generate.
+*/
+func (ast *ASTNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(astJSON{Token: ast.Token, Children: ast.Children, Piped: ast.Piped, Comments: ast.Comments})
+}
+
+/*
+UnmarshalJSON decodes a node written by MarshalJSON.
+*/
+func (ast *ASTNode) UnmarshalJSON(data []byte) error {
+
+	var decoded astJSON
+
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range decoded.Children {
+		if child == nil {
+			return errors.New("AST node has a null child")
+		}
+	}
+
+	// as built by the Parser, a leaf has an empty list of children rather than none
+	if decoded.Children == nil {
+		decoded.Children = []*ASTNode{}
+	}
+
+	*ast = ASTNode{Token: decoded.Token, Children: decoded.Children, Piped: decoded.Piped, Comments: decoded.Comments}
+	return nil
+}
@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"math/big"
+	"regexp"
+	"time"
+)
+
+/*
+Clone returns a deep copy of the node, its token and all of its children,
+so that the copy can be transformed without affecting the original tree.
+
+Token values that are mutable are copied as well: the segments (and nil-safe flags) of an ACCESSOR,
+the Parameters of a FUNCTION's ExpressionFunction, *big.Int and *big.Rat values and the
+segments and embedded tokens of an InterpolatedString are duplicated.
+All other values (numbers, strings, booleans, runes, times, compiled patterns) are immutable and shared as-is.
+*/
+func (ast *ASTNode) Clone() *ASTNode {
+	if ast == nil {
+		return nil
+	}
+
+	ret := &ASTNode{Children: make([]*ASTNode, 0, len(ast.Children)), Piped: ast.Piped}
+	if len(ast.Comments) > 0 {
+		ret.Comments = append([]Comment(nil), ast.Comments...)
+	}
+
+	if ast.Token != nil {
+		token := *ast.Token
+		token.Value = cloneTokenValue(token.Value)
+		ret.Token = &token
+	}
+
+	for _, child := range ast.Children {
+		ret.Children = append(ret.Children, child.Clone())
+	}
+
+	return ret
+}
+
+func cloneTokenValue(value interface{}) interface{} {
+
+	switch v := value.(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case ExpressionFunction:
+		v.Parameters = append([]string(nil), v.Parameters...)
+		return v
+	case *big.Int:
+		return new(big.Int).Set(v)
+	case *big.Rat:
+		return new(big.Rat).Set(v)
+	case InterpolatedString:
+		return cloneInterpolatedString(v)
+	case OptionalAccessor:
+		return OptionalAccessor{
+			Segments: append([]string(nil), v.Segments...),
+			NilSafe:  append([]bool(nil), v.NilSafe...),
+		}
+	}
+
+	return value
+}
+
+/*
+Equal reports whether two trees are structurally identical: same kinds, same token values,
+and pairwise equal children. Source positions and Raw text are ignored, except for tokens
+that carry no value (such as synthesized ARRAY nodes), whose Raw text is compared instead.
+NUMERIC values are compared exactly, since the same literal always parses to the same value;
+TIME values are compared with time.Time.Equal. A call written as a pipeline (a |> f) equals the same call written as f(a).
+Comments are ignored.
+*/
+func Equal(a, b *ASTNode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if !tokensEqual(a.Token, b.Token) {
+		return false
+	}
+
+	if len(a.Children) != len(b.Children) {
+		return false
+	}
+
+	for i := range a.Children {
+		if !Equal(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+Reports whether two trees are equal, as by Equal, once each has lost the parentheses its grouping doesn't need,
+so that (a * b) + c equals a * b + c but (a + b) * c doesn't equal a + b * c.
+*/
+func equalIgnoringParentheses(a, b *ASTNode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return Equal(withoutRedundantParentheses(a.Clone(), false), withoutRedundantParentheses(b.Clone(), false))
+}
+
+func tokensEqual(a, b *ExpressionToken) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.Kind != b.Kind {
+		return false
+	}
+
+	if a.Value == nil && b.Value == nil {
+		return a.Raw == b.Raw
+	}
+
+	return tokenValuesEqual(a.Value, b.Value)
+}
+
+func tokenValuesEqual(a, b interface{}) bool {
+
+	switch av := a.(type) {
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	case []string:
+		bv, ok := b.([]string)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if av[i] != bv[i] {
+				return false
+			}
+		}
+		return true
+	case ExpressionFunction:
+		bv, ok := b.(ExpressionFunction)
+		return ok && av.Name == bv.Name
+	case *big.Int:
+		bv, ok := b.(*big.Int)
+		return ok && av.Cmp(bv) == 0
+	case *big.Rat:
+		bv, ok := b.(*big.Rat)
+		return ok && av.Cmp(bv) == 0
+	case *regexp.Regexp:
+		bv, ok := b.(*regexp.Regexp)
+		return ok && av.String() == bv.String()
+	case InterpolatedString:
+		bv, ok := b.(InterpolatedString)
+		return ok && interpolatedStringsEqual(av, bv)
+	case OptionalAccessor:
+		bv, ok := b.(OptionalAccessor)
+		return ok && av.String() == bv.String()
+	}
+
+	return a == b
+}
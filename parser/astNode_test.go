@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		options    ParserOptions
+	}{
+		{"f([a], b.C) && [d] > 0xFFFFFFFFFFFFFFFF // why", ParserOptions{PreserveIntegers: true, KeepComments: true}},
+		{"a?.B.C == 0.1 ? \"x${[y] + 1}z\" : 'n'", ParserOptions{DecimalLiterals: true}},
+	}
+
+	options := func(options ParserOptions) ParserOptions {
+		options.Functions = map[string]ExpressionFunction{
+			"f": {Name: "f", Parameters: []string{"x", "y"}},
+		}
+		return options
+	}
+
+	for _, test := range tests {
+		original, err := parseAST(test.expression, options(test.options))
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+		want, _ := parseAST(test.expression, options(test.options))
+		generated := original.Generate()
+
+		clone := original.Clone()
+		if !Equal(clone, original) {
+			t.Fatalf("%q: the clone differs from the original", test.expression)
+		}
+		mutate(clone)
+
+		if !reflect.DeepEqual(original, want) || original.Generate() != generated {
+			t.Errorf("%q: changing the clone changed the original into %q", test.expression, original.Generate())
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"[a] + 1 > 2", "[a] + 1 > 2", true},
+		{"[a]+1>2", "[a] + 1 > 2 // comment", true},
+		{"f(1, 'x')", "f( 1, \"x\" )", true},
+		{"[t] > '2024-01-02T00:00:00Z'", "[t] > '2024-01-02'", true},
+		{"[t] > '2024-01-02T02:00:00+02:00'", "[t] > '2024-01-02'", true},
+		{"[xs] |> f()", "f([xs])", true},
+		{"0.1 + 0.2", "0.1 + 0.2", true},
+
+		// a different literal
+		{"[a] + 1 > 2", "[a] + 1 > 3", false},
+		{"'x' == [a]", "'y' == [a]", false},
+		{"[t] > '2024-01-02'", "[t] > '2024-01-03'", false},
+		{"0.1 + 0.2", "0.3", false},
+
+		// a different operator or structure
+		{"[a] + 1 > 2", "[a] - 1 > 2", false},
+		{"[a] + 1 > 2", "[a] + (1 > 2)", false},
+		{"([a] + [b]) * [c]", "[a] + [b] * [c]", false},
+		{"f(1, 2)", "f(1)", false},
+		{"[a] && [b]", "[b] && [a]", false},
+	}
+
+	options := ParserOptions{KeepComments: true, Functions: map[string]ExpressionFunction{"f": {Name: "f"}}}
+	for _, test := range tests {
+		a, err := parseAST(test.a, options)
+		if err != nil {
+			t.Fatalf("%q: %v", test.a, err)
+		}
+		b, err := parseAST(test.b, options)
+		if err != nil {
+			t.Fatalf("%q: %v", test.b, err)
+		}
+		if equal := Equal(a, b); equal != test.equal {
+			t.Errorf("Equal(%q, %q) = %v, want %v", test.a, test.b, equal, test.equal)
+		}
+		if equal := Equal(b, a); equal != test.equal {
+			t.Errorf("Equal(%q, %q) = %v, want %v", test.b, test.a, equal, test.equal)
+		}
+	}
+
+	if !Equal(nil, nil) {
+		t.Error("Equal(nil, nil) = false, want true")
+	}
+	if tree, _ := parseAST("[a]", options); Equal(tree, nil) {
+		t.Error("Equal(tree, nil) = true, want false")
+	}
+}
+
+/*
+Changes everything that Clone copies: the token and its value, the comments and the children of every node.
+*/
+func mutate(node *ASTNode) {
+
+	for _, child := range node.Children {
+		mutate(child)
+	}
+	node.Children = append(node.Children[:0], nil)
+	node.Piped = !node.Piped
+	for i := range node.Comments {
+		node.Comments[i].Text = "changed"
+	}
+
+	token := node.Token
+	token.Raw = "changed"
+	token.Start = -1
+
+	switch value := token.Value.(type) {
+	case []string:
+		value[0] = "changed"
+	case OptionalAccessor:
+		value.Segments[0] = "changed"
+		value.NilSafe[0] = !value.NilSafe[0]
+	case ExpressionFunction:
+		value.Parameters[0] = "changed"
+	case *big.Int:
+		value.SetInt64(-1)
+	case *big.Rat:
+		value.SetInt64(-1)
+	case InterpolatedString:
+		value.Segments[0] = "changed"
+		value.Expressions[0][0].Raw = "changed"
+	}
+}
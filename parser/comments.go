@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+)
+
+/*
+A comment of the expression, attached to the node of the syntax tree it is next to.
+Comments are only kept when the tokens are parsed with ParserOptions.KeepTrivia or KeepComments,
+and take no part in the meaning of a tree: Equal ignores them.
+*/
+type Comment struct {
+
+	// the comment as written, with its '//' or '/* */'
+	Text string
+
+	// whether the comment follows the node, rather than preceding it
+	Trailing bool
+
+	// offsets in characters (runes) of the comment in the expression
+	Start int
+	End   int
+}
+
+/*
+Reports whether the comment runs to the end of its line, as a '//' comment does,
+so that nothing may follow it on the same line.
+*/
+func (comment Comment) IsLineComment() bool {
+	return strings.HasPrefix(comment.Text, "//")
+}
+
+/*
+Attaches the comments among [tokens] to the nodes of [tree] they are next to: a comment on a line of its own
+leads the outermost node starting with the token after it, so that a comment above a clause stays with it,
+and a comment following a token on the same line trails the outermost node ending just before it.
+A leading comment before a token which starts no node, such as an operator or a closing parenthesis,
+trails the node before it instead. Comments are read from COMMENT tokens and from the trivia of the tokens.
+*/
+func attachComments(tree *ASTNode, tokens []ExpressionToken) {
+
+	if tree == nil || !hasComments(tokens) {
+		return
+	}
+
+	var spans []nodeSpan
+	collectSpans(tree, newBrackets(tokens), &spans)
+
+	var previous *ExpressionToken
+	for i := range tokens {
+		token := &tokens[i]
+
+		if token.Kind == COMMENT {
+			trailing := previous != nil && previous.Line == token.Line
+			attachComment(spans, commentOf(*token, trailing), nextToken(tokens, i))
+			continue
+		}
+
+		for _, trivia := range token.LeadingTrivia {
+			if isComment(trivia) {
+				attachComment(spans, commentOf(trivia, false), token)
+			}
+		}
+		for _, trivia := range token.TrailingTrivia {
+			if isComment(trivia) {
+				attachComment(spans, commentOf(trivia, true), nil)
+			}
+		}
+		previous = token
+	}
+}
+
+/*
+The span of source covered by a node and its children, from the start of its first token to the end of its last,
+including the brackets which close it.
+*/
+type nodeSpan struct {
+	node       *ASTNode
+	start, end int
+}
+
+/*
+The tokens of an expression which aren't comments, along with where the bracket closed by each closing one opens,
+so that the span of a node can run up to its closing parenthesis, which has no node of its own.
+*/
+type brackets struct {
+	tokens []ExpressionToken
+
+	// the start of the opening bracket of each closing one, by the closing one's start
+	openers map[int]int
+}
+
+func newBrackets(tokens []ExpressionToken) brackets {
+
+	ret := brackets{openers: map[int]int{}}
+	var open []int
+
+	for _, token := range tokens {
+		switch token.Kind {
+		case COMMENT:
+			continue
+		case CLAUSE, ARRAY, MAP, INDEX:
+			open = append(open, token.Start)
+		case CLAUSE_CLOSE, ARRAY_CLOSE, MAP_CLOSE, INDEX_CLOSE:
+			if len(open) > 0 {
+				ret.openers[token.Start] = open[len(open)-1]
+				open = open[:len(open)-1]
+			}
+		}
+		ret.tokens = append(ret.tokens, token)
+	}
+	return ret
+}
+
+/*
+Returns [end] moved past the closing brackets following it whose opening bracket is within a span starting at [start].
+*/
+func (b brackets) extend(start int, end int) int {
+
+	i := sort.Search(len(b.tokens), func(i int) bool {
+		return b.tokens[i].Start >= end
+	})
+
+	for ; i < len(b.tokens); i++ {
+		opener, isCloser := b.openers[b.tokens[i].Start]
+		if !isCloser || opener < start {
+			break
+		}
+		end = b.tokens[i].End
+	}
+	return end
+}
+
+/*
+Adds the span of [tree] and of each node within it to [spans], parents before their children; returns the span of [tree].
+Nodes without a position, such as the ARRAY of a list written in parentheses, take that of their children.
+*/
+func collectSpans(tree *ASTNode, b brackets, spans *[]nodeSpan) nodeSpan {
+
+	index := len(*spans)
+	*spans = append(*spans, nodeSpan{node: tree, start: -1, end: -1})
+
+	ret := nodeSpan{node: tree, start: -1, end: -1}
+	cover := func(start int, end int) {
+		if end <= start {
+			return
+		}
+		if ret.start < 0 || start < ret.start {
+			ret.start = start
+		}
+		if end > ret.end {
+			ret.end = end
+		}
+	}
+
+	if tree.Token != nil {
+		cover(tree.Token.Start, tree.Token.End)
+	}
+	for _, child := range tree.Children {
+		if child != nil {
+			span := collectSpans(child, b, spans)
+			cover(span.start, span.end)
+		}
+	}
+	if ret.start >= 0 {
+		ret.end = b.extend(ret.start, ret.end)
+	}
+
+	(*spans)[index] = ret
+	return ret
+}
+
+/*
+Attaches [comment] to the outermost node starting with [next] if it leads it, and otherwise as trailing
+the outermost node ending nearest before it.
+*/
+func attachComment(spans []nodeSpan, comment Comment, next *ExpressionToken) {
+
+	if !comment.Trailing && next != nil {
+		for _, span := range spans {
+			if span.start == next.Start {
+				span.node.Comments = append(span.node.Comments, comment)
+				return
+			}
+		}
+	}
+
+	var before *ASTNode
+	end := -1
+	for _, span := range spans {
+		if span.end >= 0 && span.end <= comment.Start && span.end > end {
+			before, end = span.node, span.end
+		}
+	}
+
+	// nothing ends before the comment, which then leads the whole expression
+	if before == nil {
+		comment.Trailing = false
+		spans[0].node.Comments = append(spans[0].node.Comments, comment)
+		return
+	}
+
+	comment.Trailing = true
+	before.Comments = append(before.Comments, comment)
+}
+
+func hasComments(tokens []ExpressionToken) bool {
+
+	for _, token := range tokens {
+		if token.Kind == COMMENT {
+			return true
+		}
+		for _, trivia := range token.LeadingTrivia {
+			if isComment(trivia) {
+				return true
+			}
+		}
+		for _, trivia := range token.TrailingTrivia {
+			if isComment(trivia) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func nextToken(tokens []ExpressionToken, i int) *ExpressionToken {
+
+	for i++; i < len(tokens); i++ {
+		if tokens[i].Kind != COMMENT {
+			return &tokens[i]
+		}
+	}
+	return nil
+}
+
+func commentOf(token ExpressionToken, trailing bool) Comment {
+	return Comment{Text: strings.TrimRight(token.Raw, "\r\n"), Trailing: trailing, Start: token.Start, End: token.End}
+}
+
+func isComment(trivia ExpressionToken) bool {
+	return strings.HasPrefix(trivia.Raw, "//") || strings.HasPrefix(trivia.Raw, "/*")
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+Lists the comments attached within [ast], parents before children, each as the flat code of its node without comments,
+then "<-" and the comment for one leading it, or "->" for one trailing it.
+*/
+func attachedComments(ast *ASTNode) []string {
+
+	var ret []string
+	var walk func(node *ASTNode)
+	walk = func(node *ASTNode) {
+		for _, comment := range node.Comments {
+			arrow := " <- "
+			if comment.Trailing {
+				arrow = " -> "
+			}
+			ret = append(ret, withoutComments(node.Clone()).GenerateWithOptions(GenerateOptions{flat: true, maxWidth: -1})+arrow+comment.Text)
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(ast)
+	return ret
+}
+
+func TestAttachComments(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       []string
+	}{
+		{"[a] > 1 // why", []string{"[a] > 1 -> // why"}},
+		{"// first\n[a] > 1", []string{"[a] > 1 <- // first"}},
+		{"[a] > 1 &&\n// the second clause\n[b] < 2", []string{"[b] < 2 <- // the second clause"}},
+		{"[a] > 1 && // first\n[b] < 2 // second", []string{"[a] > 1 && [b] < 2 -> // second", "[a] > 1 -> // first"}},
+		{"[a] /* left */ + [b]", []string{"[a] -> /* left */"}},
+		{"/* the sum */ ([a] + [b]) * 2", []string{"( [a] + [b] ) * 2 <- /* the sum */"}},
+		{"([a] + [b] // inner\n) * 2", []string{"[a] + [b] -> // inner"}},
+		{"f(\n  // the value\n  [x],\n  1 /* the low */\n)", []string{"[x] <- // the value", "1 -> /* the low */"}},
+
+		{"f([y],\n// the value\n[x])", []string{"[x] <- // the value"}},
+		{"[a] +\n// the increment\n[b]", []string{"[b] <- // the increment"}},
+		{"[a] ? // the flag\n[b] :\n// otherwise\n[c]", []string{"[a] -> // the flag", "[c] <- // otherwise"}},
+
+		// before an operator, which starts no node
+		{"[a]\n// or\n|| [b]", []string{"[a] -> // or"}},
+	}
+
+	for _, test := range tests {
+		for _, options := range []ParserOptions{{KeepComments: true}, {KeepTrivia: true}} {
+			options.Functions = map[string]ExpressionFunction{"f": {Name: "f"}}
+
+			ast, err := parseAST(test.expression, options)
+			if err != nil {
+				t.Fatalf("%q: %v", test.expression, err)
+			}
+			if got := attachedComments(ast); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%q with KeepTrivia %v: got %q, want %q", test.expression, options.KeepTrivia, got, test.want)
+			}
+
+			// formatting keeps each comment next to its node
+			formatted := ast.Generate()
+			reparsed, err := parseAST(formatted, options)
+			if err != nil {
+				t.Fatalf("%q formats into %q: %v", test.expression, formatted, err)
+			}
+			if got := attachedComments(reparsed); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%q formats into %q, with the comments %q", test.expression, formatted, got)
+			}
+
+			// comments take no part in the meaning of the tree
+			plain, err := parseAST(test.expression, ParserOptions{Functions: options.Functions})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !Equal(ast, plain) || len(attachedComments(plain)) != 0 {
+				t.Errorf("%q: the comments change the tree", test.expression)
+			}
+		}
+	}
+}
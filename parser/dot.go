@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GenerateDOT 将 AST 输出为 Graphviz DOT 格式，用于调试解析结果
+// 每个节点以 TokenKind 和内容为标签，节点 ID 按遍历顺序编号，因此相同的值也不会冲突
+func GenerateDOT(node *ASTNode) string {
+	var sb strings.Builder
+	id := 0
+
+	sb.WriteString("digraph AST {\n")
+	sb.WriteString("  node [shape=box];\n")
+	if node != nil {
+		writeDOTNode(&sb, node, &id)
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+func writeDOTNode(sb *strings.Builder, node *ASTNode, id *int) int {
+	current := *id
+	*id++
+
+	sb.WriteString(fmt.Sprintf("  n%d [label=%s];\n", current, strconv.Quote(dotLabel(node))))
+
+	for _, child := range node.Children {
+		childID := writeDOTNode(sb, child, id)
+		sb.WriteString(fmt.Sprintf("  n%d -> n%d;\n", current, childID))
+	}
+
+	return current
+}
+
+func dotLabel(node *ASTNode) string {
+	if node.Token == nil {
+		return "<nil>"
+	}
+
+	content := node.Token.Raw
+	switch value := node.Token.Value.(type) {
+	case []string:
+		content = strings.Join(value, ".")
+		if node.Token.Kind == LAMBDA {
+			content = "(" + strings.Join(value, ", ") + ") ->"
+		}
+	case OptionalAccessor:
+		content = value.String()
+	case ExpressionFunction:
+		content = value.Name
+	}
+
+	if content == "" {
+		return node.Token.Kind.String()
+	}
+	return node.Token.Kind.String() + "\n" + content
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDOT(t *testing.T) {
+
+	tree, err := parseAST("[a] + 1", ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "digraph AST {\n" +
+		"  node [shape=box];\n" +
+		"  n0 [label=\"MODIFIER\\n+\"];\n" +
+		"  n1 [label=\"VARIABLE\\na\"];\n" +
+		"  n0 -> n1;\n" +
+		"  n2 [label=\"NUMERIC\\n1\"];\n" +
+		"  n0 -> n2;\n" +
+		"}\n"
+	if dot := GenerateDOT(tree); dot != want {
+		t.Errorf("GenerateDOT('[a] + 1') = %q, want %q", dot, want)
+	}
+
+	if dot := GenerateDOT(nil); dot != "digraph AST {\n  node [shape=box];\n}\n" {
+		t.Errorf("GenerateDOT(nil) = %q, want an empty graph", dot)
+	}
+
+	// repeated values still get nodes of their own, and calls and lists an edge to each of their elements
+	expression := "f(a, [a]) > 1 && [xs] in (1, 1)"
+	tree, err = parseAST(expression, ParserOptions{Functions: map[string]ExpressionFunction{"f": {Name: "f"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := GenerateDOT(tree)
+
+	nodes := regexp.MustCompile(`(?m)^  (n\d+) \[label="([^"]*)"\];$`).FindAllStringSubmatch(dot, -1)
+	edges := regexp.MustCompile(`(?m)^  n\d+ -> n\d+;$`).FindAllString(dot, -1)
+	if len(nodes) != 11 || len(edges) != 10 {
+		t.Errorf("%q: got %d nodes and %d edges, want 11 and 10:\n%s", expression, len(nodes), len(edges), dot)
+	}
+
+	ids := map[string]bool{}
+	var labels []string
+	for _, node := range nodes {
+		if ids[node[1]] {
+			t.Errorf("%q: node %s is declared twice", expression, node[1])
+		}
+		ids[node[1]] = true
+		labels = append(labels, node[2])
+	}
+	wantLabels := []string{
+		`LOGICALOP\n&&`, `COMPARATOR\n>`, `FUNCTION\nf`, `VARIABLE\na`, `VARIABLE\na`, `NUMERIC\n1`,
+		`COMPARATOR\nin`, `VARIABLE\nxs`, `ARRAY`, `NUMERIC\n1`, `NUMERIC\n1`,
+	}
+	if strings.Join(labels, "|") != strings.Join(wantLabels, "|") {
+		t.Errorf("%q: got labels %q, want %q", expression, labels, wantLabels)
+	}
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+Reads a quoted string literal, starting just after its opening quote and stopping before its closing quote,
+decoding escape sequences as it goes. Returns false if the string was never closed.
+*/
+func readStringLiteral(stream *lexerStream) (string, bool, error) {
+
+	var sb strings.Builder
+
+	for stream.canRead() {
+
+		character := stream.readCharacter()
+
+		if !isNotQuote(character) {
+			stream.rewind(1)
+			return sb.String(), true, nil
+		}
+
+		if character == '\\' {
+			decoded, err := readEscapeSequence(stream)
+			if err != nil {
+				return "", false, err
+			}
+			character = decoded
+		}
+
+		sb.WriteRune(character)
+	}
+
+	return sb.String(), false, nil
+}
+
+/*
+Decodes the escape sequence following a backslash which has just been read from the [stream].
+Supported are the single-character escapes \n \t \r \b \f \v \0, an escaped backslash, quote or '$',
+and the numeric escapes \xHH, \uHHHH and \UHHHHHHHH.
+*/
+func readEscapeSequence(stream *lexerStream) (rune, error) {
+
+	start := stream.position - 1
+
+	if !stream.canRead() {
+		return 0, &ParseError{Msg: "Unterminated escape sequence", Start: start, End: stream.position}
+	}
+
+	character := stream.readCharacter()
+
+	switch character {
+	case '\\', '\'', '"', '$':
+		return character, nil
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'v':
+		return '\v', nil
+	case '0':
+		return 0, nil
+	case 'x':
+		return readHexEscape(stream, start, 2)
+	case 'u':
+		return readHexEscape(stream, start, 4)
+	case 'U':
+		return readHexEscape(stream, start, 8)
+	}
+
+	errorMsg := fmt.Sprintf("Invalid escape sequence '\\%c'", character)
+	return 0, &ParseError{Msg: errorMsg, Start: start, End: stream.position}
+}
+
+func readHexEscape(stream *lexerStream, start int, digits int) (rune, error) {
+
+	end := stream.position
+	for end < stream.length && end-stream.position < digits && isHexDigit(stream.source[end]) {
+		end++
+	}
+
+	hex := string(stream.source[stream.position:end])
+	stream.position = end
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != digits || err != nil {
+		errorMsg := fmt.Sprintf("Invalid escape sequence '%s': expected %d hex digits", string(stream.source[start:end]), digits)
+		return 0, &ParseError{Msg: errorMsg, Start: start, End: end}
+	}
+
+	if !utf8.ValidRune(rune(value)) {
+		errorMsg := fmt.Sprintf("Invalid escape sequence '%s': not a valid code point", string(stream.source[start:end]))
+		return 0, &ParseError{Msg: errorMsg, Start: start, End: end}
+	}
+
+	return rune(value), nil
+}
+
+/*
+Re-encodes a decoded string literal so that readStringLiteral reads back exactly the same value.
+Backslashes and the given [special] characters are escaped with a backslash,
+control characters use their short escapes, and other unprintable characters use \u or \U.
+*/
+func encodeString(value string, special string) string {
+
+	var sb strings.Builder
+
+	for _, character := range value {
+
+		switch character {
+		case '\\':
+			sb.WriteString("\\\\")
+			continue
+		case '\n':
+			sb.WriteString("\\n")
+			continue
+		case '\t':
+			sb.WriteString("\\t")
+			continue
+		case '\r':
+			sb.WriteString("\\r")
+			continue
+		case '\b':
+			sb.WriteString("\\b")
+			continue
+		case '\f':
+			sb.WriteString("\\f")
+			continue
+		case '\v':
+			sb.WriteString("\\v")
+			continue
+		case 0:
+			sb.WriteString("\\0")
+			continue
+		}
+
+		if strings.ContainsRune(special, character) {
+			sb.WriteRune('\\')
+			sb.WriteRune(character)
+			continue
+		}
+
+		if !unicode.IsPrint(character) && character != ' ' {
+			if character > 0xFFFF {
+				fmt.Fprintf(&sb, "\\U%08X", character)
+			} else {
+				fmt.Fprintf(&sb, "\\u%04X", character)
+			}
+			continue
+		}
+
+		sb.WriteRune(character)
+	}
+
+	return sb.String()
+}
+
+/*
+Escapes a variable name to be written within square brackets, as in [user name], so that the lexer reads it back unchanged.
+Backslashes and closing brackets need escaping there, since a backslash escapes any character that follows it,
+and so does a first character which would otherwise make the lexer read an array literal, as in [0].
+*/
+func encodeVariableName(name string) string {
+
+	var sb strings.Builder
+	leading := true
+
+	for _, character := range name {
+		if character == '\\' || character == ']' || leading && isArrayLiteralStart(character) {
+			sb.WriteRune('\\')
+		}
+		if !unicode.IsSpace(character) {
+			leading = false
+		}
+		sb.WriteRune(character)
+	}
+	return sb.String()
+}
+
+/*
+Escapes a segment of an accessor such as user.Name, so that the lexer reads it back as a single segment:
+characters which can't appear unescaped in a name are preceded by a backslash.
+*/
+func encodeAccessorSegment(segment string) string {
+
+	var sb strings.Builder
+
+	for _, character := range segment {
+		if !(ParserOptions{}).isIdentifierRune(character, false) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(character)
+	}
+	return sb.String()
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden with the current output")
+
+/*
+Formats each testdata/golden/*.input with the zero Formatter and compares the code with the matching .golden file.
+*/
+func TestFormatGolden(t *testing.T) {
+
+	inputs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden inputs in testdata/golden")
+	}
+
+	for _, input := range inputs {
+		expression, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		formatted, err := Formatter{}.FormatExpression(string(expression), ParserOptions{})
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		golden := strings.TrimSuffix(input, ".input") + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, []byte(formatted+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formatted+"\n" != string(want) {
+			t.Errorf("%s formats into\n%s\nwant\n%s", input, formatted, want)
+		}
+	}
+}
+
+/*
+Checks that formatting is stable: formatting an expression twice gives the same code,
+and formatting that code, comments and all, gives it back unchanged.
+*/
+func TestFormatIdempotent(t *testing.T) {
+
+	expressions := readCorpus(t, "harden.txt")
+	for _, pattern := range []string{"*.input", "*.golden"} {
+		files, err := filepath.Glob(filepath.Join("testdata", "golden", pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			expression, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expressions = append(expressions, string(expression))
+		}
+	}
+
+	formatters := []Formatter{{}, {MaxWidth: 30}, {MaxWidth: 20, UseTabs: true}, {MaxWidth: -1}, {IndentWidth: 4, MaxWidth: 40}}
+	for _, parentheses := range []ParenthesesStyle{PARENTHESES_MINIMAL, PARENTHESES_EXPLICIT} {
+		formatter := Formatter{}
+		formatter.Parentheses = parentheses
+		formatters = append(formatters, formatter)
+	}
+	compact := Formatter{MaxWidth: 30}
+	compact.OperatorSpacing, compact.CommaSpacing = SPACING_COMPACT, SPACING_COMPACT
+	formatters = append(formatters, compact)
+
+	for i, formatter := range formatters {
+		for _, expression := range expressions {
+
+			formatted, err := formatter.FormatExpression(expression, ParserOptions{})
+			if err != nil {
+				continue
+			}
+
+			again, _ := formatter.FormatExpression(expression, ParserOptions{})
+			if again != formatted {
+				t.Errorf("formatter %d: formatting %q gives %q, then %q", i, expression, formatted, again)
+				continue
+			}
+
+			reformatted, err := formatter.FormatExpression(formatted, ParserOptions{})
+			if err != nil {
+				t.Errorf("formatter %d: formatted code %q for %q doesn't parse: %v", i, formatted, expression, err)
+				continue
+			}
+			if reformatted != formatted {
+				t.Errorf("formatter %d: formatting %q gives %q, which formats into %q", i, expression, formatted, reformatted)
+			}
+		}
+	}
+}
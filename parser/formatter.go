@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"strings"
+)
+
+/*
+A Formatter generates code for syntax trees in a house style: the options of Generate,
+along with how the code is laid out. The zero Formatter indents with two spaces and fits lines within 100 columns.
+
+Unlike Generate, which puts every operand of && and || on a line of its own, a Formatter only breaks what doesn't fit:
+a chain of && or ||, a parenthesized clause or a call which fits on the rest of its line is written on it, as in a && b;
+a chain which doesn't has each of its operands on a line of its own, and a call each of its arguments.
+A line comment always ends its line, so whatever holds one is broken.
+*/
+type Formatter struct {
+	GenerateOptions
+
+	// the number of spaces per level of indentation, or of tabs when UseTabs is set;
+	// 0 gives the default of two spaces, or one tab
+	IndentWidth int
+
+	// indent with tabs instead of spaces
+	UseTabs bool
+
+	// the width within which lines are fitted, counting a tab as 4 columns; 0 gives the default of 100,
+	// and a negative width puts everything which can be on one line
+	MaxWidth int
+}
+
+/*
+Format generates code for the tree rooted at [ast], keeping the comments attached to its nodes.
+*/
+func (formatter Formatter) Format(ast *ASTNode) string {
+
+	options := formatter.GenerateOptions
+	options.indentUnit = formatter.indentUnit()
+	options.maxWidth = formatter.MaxWidth
+	if options.maxWidth == 0 {
+		options.maxWidth = 100
+	}
+	return ast.GenerateWithOptions(options)
+}
+
+/*
+FormatExpression parses [expression] with the given [options], keeping its comments, and formats it.
+Returns the error from parsing if it doesn't parse.
+*/
+func (formatter Formatter) FormatExpression(expression string, options ParserOptions) (string, error) {
+
+	options.KeepTrivia = true
+	ast, err := parseAST(expression, options)
+	if err != nil {
+		return "", err
+	}
+	return formatter.Format(ast), nil
+}
+
+/*
+Returns the text of one level of indentation.
+*/
+func (formatter Formatter) indentUnit() string {
+
+	character, width := " ", 2
+	if formatter.UseTabs {
+		character, width = "\t", 1
+	}
+	if formatter.IndentWidth > 0 {
+		width = formatter.IndentWidth
+	}
+	return strings.Repeat(character, width)
+}
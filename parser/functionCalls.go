@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"sort"
+)
+
+/*
+A call of a function, or of a method such as user.HasRole('admin'), made by an expression.
+*/
+type FunctionCall struct {
+
+	// the name of the function as written, or the whole accessor of a method, such as "user.HasRole"
+	Name string
+
+	// whether the call is of a method on a variable rather than of a registered function
+	Method bool
+
+	// the token naming the function, giving the position of the call
+	Token ExpressionToken
+
+	// the number of arguments passed, including the value piped into a call written as a |> f
+	Arguments int
+
+	// the names of the arguments passed by name, as in sendAlert(severity: 'high'), in the order they are written
+	NamedArguments []string
+
+	// whether the call was written as a pipeline, a |> f
+	Piped bool
+}
+
+/*
+FunctionCalls parses [expression] and returns every call it makes, in source order,
+so that callers can find which expressions still use a function before removing it.
+*/
+func FunctionCalls(expression string, options ParserOptions) ([]FunctionCall, error) {
+
+	ast, err := parseAST(expression, options)
+	if err != nil {
+		return nil, err
+	}
+	return ast.FunctionCalls(), nil
+}
+
+/*
+FunctionCalls returns every call made within the node, as the FunctionCalls function does for an expression.
+*/
+func (ast *ASTNode) FunctionCalls() []FunctionCall {
+
+	var ret []FunctionCall
+	ast.collectCalls(&ret)
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Token.Start < ret[j].Token.Start
+	})
+	return ret
+}
+
+func (ast *ASTNode) collectCalls(calls *[]FunctionCall) {
+
+	if ast == nil || ast.Token == nil {
+		return
+	}
+
+	if ast.Token.Kind == FUNCTION || ast.Token.Kind == METHOD {
+
+		call := FunctionCall{
+			Name:      ast.Token.Raw,
+			Method:    ast.Token.Kind == METHOD,
+			Token:     *ast.Token,
+			Arguments: len(ast.Children),
+			Piped:     ast.Piped,
+		}
+		for _, child := range ast.Children {
+			if child.Token.Kind == NAMED_ARGUMENT {
+				call.NamedArguments = append(call.NamedArguments, child.Token.Raw)
+			}
+		}
+		*calls = append(*calls, call)
+	}
+
+	for _, child := range ast.Children {
+		child.collectCalls(calls)
+	}
+}
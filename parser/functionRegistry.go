@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"sort"
+	"sync"
+)
+
+/*
+FunctionRegistry holds the functions which may be called from within expressions, keyed by name.
+Unlike a plain map it is safe for concurrent use, so functions can be registered and removed at runtime
+while other goroutines are parsing; each lookup sees the functions registered at that moment.
+
+The zero value is an empty registry, ready to use. A nil *FunctionRegistry reads as empty.
+*/
+type FunctionRegistry struct {
+	mutex     sync.RWMutex
+	functions map[string]ExpressionFunction
+}
+
+/*
+NewFunctionRegistry returns an empty FunctionRegistry.
+*/
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{functions: map[string]ExpressionFunction{}}
+}
+
+/*
+NewFunctionRegistryFromMap returns a FunctionRegistry holding a copy of the [functions] map,
+for callers moving over from the map form taken by ParseTokens and ParserOptions.Functions.
+*/
+func NewFunctionRegistryFromMap(functions map[string]ExpressionFunction) *FunctionRegistry {
+
+	ret := &FunctionRegistry{functions: make(map[string]ExpressionFunction, len(functions))}
+	for name, function := range functions {
+		ret.functions[name] = function
+	}
+	return ret
+}
+
+/*
+Register adds [function] under [name], replacing any function already registered with that name.
+*/
+func (r *FunctionRegistry) Register(name string, function ExpressionFunction) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.functions == nil {
+		r.functions = map[string]ExpressionFunction{}
+	}
+	r.functions[name] = function
+}
+
+/*
+Unregister removes the function registered under [name], if there is one.
+*/
+func (r *FunctionRegistry) Unregister(name string) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.functions, name)
+}
+
+/*
+Lookup returns the function registered under [name], and whether there was one.
+*/
+func (r *FunctionRegistry) Lookup(name string) (ExpressionFunction, bool) {
+
+	if r == nil {
+		return ExpressionFunction{}, false
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	function, found := r.functions[name]
+	return function, found
+}
+
+/*
+Len returns the number of registered functions.
+*/
+func (r *FunctionRegistry) Len() int {
+
+	if r == nil {
+		return 0
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.functions)
+}
+
+/*
+Names returns the names of all registered functions, sorted.
+*/
+func (r *FunctionRegistry) Names() []string {
+	return sortedFunctionNames(r.Map())
+}
+
+/*
+Range calls [f] for each registered function in name order, stopping early if it returns false.
+It iterates over a snapshot, so [f] may register or unregister functions itself.
+*/
+func (r *FunctionRegistry) Range(f func(name string, function ExpressionFunction) bool) {
+
+	functions := r.Map()
+	for _, name := range sortedFunctionNames(functions) {
+		if !f(name, functions[name]) {
+			return
+		}
+	}
+}
+
+/*
+Clone returns a new FunctionRegistry holding the same functions, which can then be changed independently.
+*/
+func (r *FunctionRegistry) Clone() *FunctionRegistry {
+	return NewFunctionRegistryFromMap(r.Map())
+}
+
+/*
+Map returns a copy of the registered functions as a map, for APIs which still take the map form, such as InferType.
+*/
+func (r *FunctionRegistry) Map() map[string]ExpressionFunction {
+
+	if r == nil {
+		return map[string]ExpressionFunction{}
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	ret := make(map[string]ExpressionFunction, len(r.functions))
+	for name, function := range r.functions {
+		ret[name] = function
+	}
+	return ret
+}
+
+/*
+Looks up the function registered under a name equal to [name] regardless of case,
+returning the name it is registered under. A name matching more than one function is an error.
+*/
+func (r *FunctionRegistry) lookupFolded(name string) (string, ExpressionFunction, bool, error) {
+
+	if r == nil {
+		return name, ExpressionFunction{}, false, nil
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	registered, err := foldedName(name, r.functions)
+	if err != nil || registered == "" {
+		return name, ExpressionFunction{}, false, err
+	}
+	return registered, r.functions[registered], true, nil
+}
+
+func sortedFunctionNames(functions map[string]ExpressionFunction) []string {
+
+	ret := make([]string, 0, len(functions))
+	for name := range functions {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -3,26 +3,351 @@ package parser
 import (
 	"fmt"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // ASTNode 表示 AST 的节点
 type ASTNode struct {
 	Token    *ExpressionToken
 	Children []*ASTNode
+
+	// Piped 表示该 FUNCTION 节点由管道 a |> f 改写而来，第一个子节点是管道左侧的值
+	Piped bool
+
+	// Comments 是附着在该节点前后的注释，只有保留了注释的 token 才会解析出注释
+	Comments []Comment
+}
+
+// GenerateOptions 控制代码生成的输出格式
+type GenerateOptions struct {
+	// TimeFormat 是 TIME 节点的输出格式，默认为 time.RFC3339Nano，秒的小数部分只在有时输出
+	TimeFormat string
+
+	// KeepPipelines 为 true 时，由管道改写而来的函数调用仍输出为 a |> f 的形式，否则输出为 f(a)
+	KeepPipelines bool
+
+	// ArgumentStyle 控制函数参数输出为位置参数还是具名参数，默认保持书写时的形式
+	ArgumentStyle ArgumentStyle
+
+	// OperatorStyle 控制逻辑运算符输出为符号（&&、||、!）还是文字（and、or、not），默认保持书写时的形式
+	OperatorStyle OperatorStyle
+
+	// OperatorSpacing 控制比较运算符与算术运算符两侧的空白，默认各加一个空格，如 a >= 5
+	OperatorSpacing SpacingStyle
+
+	// CommaSpacing 控制函数调用的参数之间逗号之后的空白，默认加一个空格，如 f( a, b )
+	CommaSpacing SpacingStyle
+
+	// Parentheses 控制括号的输出：保持书写时的括号、去掉多余的括号，或给混合优先级的运算都加上括号
+	Parentheses ParenthesesStyle
+
+	// Minify 为 true 时输出为紧凑的一行：去掉注释、多余的括号与不必要的空白，用于嵌入 URL、注解或环境变量
+	Minify bool
+
+	// indentUnit 是每一级缩进输出的字符，由 Formatter 设置，默认为两个空格
+	indentUnit string
+
+	// maxWidth 是 Formatter 设置的每行最大宽度，0 表示总是换行输出，小于 0 表示不限宽度
+	maxWidth int
+
+	// flat 为 true 时节点及其子节点都输出在同一行内
+	flat bool
+
+	// column 是节点在行内开始输出的列，0 表示节点位于行首
+	column int
+
+	// breakChain 为 true 时节点所在的逻辑运算链已经换行，同一运算符的节点也要换行
+	breakChain bool
+}
+
+// indentCharacters 是可能出现在缩进中的字符
+const indentCharacters = " \t"
+
+// tabWidth 是计算行宽时一个制表符所占的列数
+const tabWidth = 4
+
+// indentation 返回第 level 级缩进
+func (options GenerateOptions) indentation(level int) string {
+	unit := options.indentUnit
+	if unit == "" {
+		unit = "  "
+	}
+	return strings.Repeat(unit, level)
+}
+
+// OperatorStyle 是逻辑运算符的输出形式
+type OperatorStyle int
+
+const (
+	// OPERATORS_AS_WRITTEN 保持书写时的形式
+	OPERATORS_AS_WRITTEN OperatorStyle = iota
+	// OPERATORS_SYMBOLIC 统一输出为 &&、||、!
+	OPERATORS_SYMBOLIC
+	// OPERATORS_TEXTUAL 统一输出为 and、or、not
+	OPERATORS_TEXTUAL
+)
+
+var textualOperators = map[string]string{
+	"&&": "and",
+	"||": "or",
+	"!":  "not",
 }
 
+// SpacingStyle 是运算符两侧或逗号之后的空白
+type SpacingStyle int
+
+const (
+	// SPACING_SPACED 加一个空格，如 a >= 5 与 f( a, b )
+	SPACING_SPACED SpacingStyle = iota
+	// SPACING_COMPACT 不加空格，如 a>=5 与 f( a,b )；文字形式的运算符，如 in 与 like，两侧仍然加空格
+	SPACING_COMPACT
+)
+
+// ParenthesesStyle 是括号的输出形式
+type ParenthesesStyle int
+
+const (
+	// PARENTHESES_AS_WRITTEN 保持书写时的括号
+	PARENTHESES_AS_WRITTEN ParenthesesStyle = iota
+	// PARENTHESES_MINIMAL 只保留分组需要的括号，如 (a * b) + c 输出为 a * b + c
+	PARENTHESES_MINIMAL
+	// PARENTHESES_EXPLICIT 在书写的括号之外，给与外层优先级不同的逻辑运算与算术运算加上括号，如 a + b * c 输出为 a + (b * c)
+	PARENTHESES_EXPLICIT
+)
+
+// ArgumentStyle 是函数调用参数的输出形式
+type ArgumentStyle int
+
+const (
+	// ARGUMENTS_AS_WRITTEN 保持书写时的形式
+	ARGUMENTS_AS_WRITTEN ArgumentStyle = iota
+	// ARGUMENTS_POSITIONAL 尽量输出为位置参数，跳过了某个参数之后的具名参数仍保持具名
+	ARGUMENTS_POSITIONAL
+	// ARGUMENTS_NAMED 尽量输出为具名参数，需要函数声明了 Parameters
+	ARGUMENTS_NAMED
+)
+
 func (ast *ASTNode) Generate() string {
-	return ast.generateWithIndent(0)
+	return ast.GenerateWithOptions(GenerateOptions{})
+}
+
+// GenerateWithOptions 按照给定的选项生成代码
+func (ast *ASTNode) GenerateWithOptions(options GenerateOptions) string {
+	if options.TimeFormat == "" {
+		options.TimeFormat = time.RFC3339Nano
+	}
+	if options.ArgumentStyle != ARGUMENTS_AS_WRITTEN {
+		ast = withBoundArguments(ast.Clone())
+	}
+	if options.Minify {
+		return ast.minify(options)
+	}
+	switch options.Parentheses {
+	case PARENTHESES_MINIMAL:
+		ast = withoutRedundantParentheses(ast.Clone(), options.KeepPipelines)
+	case PARENTHESES_EXPLICIT:
+		ast = withExplicitParentheses(ast)
+	}
+	// 最后的行注释之后不需要换行
+	return strings.TrimSuffix(ast.generateWithIndent(0, options), "\n")
+}
+
+// generateWithIndent 生成带有缩进和换行的代码，附着在节点上的注释输出在节点的前后
+func (ast *ASTNode) generateWithIndent(indent int, options GenerateOptions) string {
+	code := ast.generateNode(indent, options)
+	if len(ast.Comments) == 0 || code == "" {
+		return code
+	}
+	return withComments(code, ast.Comments, options.indentation(indent))
+}
+
+// withComments 在节点的代码前后加上注释
+// 行注释一直到行尾，所以前置的行注释独占一行，后置的行注释以换行结尾，块注释则与代码写在同一行
+func withComments(code string, comments []Comment, indentation string) string {
+	var sb strings.Builder
+
+	body := strings.TrimLeft(code, indentCharacters)
+	sb.WriteString(code[:len(code)-len(body)])
+
+	for _, comment := range comments {
+		if comment.Trailing {
+			continue
+		}
+		sb.WriteString(comment.Text)
+		if comment.IsLineComment() {
+			sb.WriteString("\n")
+			sb.WriteString(indentation)
+		} else {
+			sb.WriteString(" ")
+		}
+	}
+
+	sb.WriteString(body)
+	trailing := trailingComments(comments, indentation)
+	if trailing != "" && strings.HasSuffix(body, "\n") {
+		trailing = indentation + strings.TrimPrefix(trailing, " ")
+	}
+	sb.WriteString(trailing)
+	return sb.String()
+}
+
+// trailingComments 返回输出在节点之后的注释，行注释之后的注释从下一行的缩进处开始
+func trailingComments(comments []Comment, indentation string) string {
+	var sb strings.Builder
+	for _, comment := range comments {
+		if !comment.Trailing {
+			continue
+		}
+		writeSeparator(&sb, " ", indentation)
+		sb.WriteString(comment.Text)
+		if comment.IsLineComment() {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// textWidth 返回文本在行内所占的列数
+func textWidth(text string) int {
+	return utf8.RuneCountInString(text) + strings.Count(text, "\t")*(tabWidth-1)
+}
+
+// columnAfter 返回节点输出了 prefix 之后所在的列
+func (options GenerateOptions) columnAfter(prefix string) int {
+	if i := strings.LastIndex(prefix, "\n"); i >= 0 {
+		return textWidth(prefix[i+1:])
+	}
+	if options.column > 0 {
+		return options.column + textWidth(strings.TrimLeft(prefix, indentCharacters))
+	}
+	return textWidth(prefix)
+}
+
+// atLineStart 返回在新的一行开始输出子节点时的选项
+func (options GenerateOptions) atLineStart() GenerateOptions {
+	options.column = 0
+	return options
+}
+
+// generateInline 生成紧接在 prefix 之后、输出在同一行内的子节点，子节点自身的缩进会被去掉
+func (ast *ASTNode) generateInline(indent int, options GenerateOptions, prefix string) string {
+	options.column = options.columnAfter(prefix)
+	return strings.TrimLeft(ast.generateWithIndent(indent, options), indentCharacters)
+}
+
+// generateFlat 把节点输出在一行内，返回是否放得下每行的最大宽度
+func (ast *ASTNode) generateFlat(indent int, options GenerateOptions) (string, bool) {
+	options.flat = true
+	code := ast.generateNode(indent, options)
+	// 以行注释结尾的代码仍在一行内
+	line := strings.TrimSuffix(code, "\n")
+	if strings.Contains(line, "\n") {
+		return code, false
+	}
+	return code, options.maxWidth < 0 || options.columnAfter(line) <= options.maxWidth
+}
+
+// isBreakable 判断节点是否可以换行输出：逻辑运算、括号与带参数的函数调用
+func (ast *ASTNode) isBreakable(options GenerateOptions) bool {
+	switch ast.Token.Kind {
+	case LOGICALOP, CLAUSE:
+		return true
+	case FUNCTION:
+		return len(ast.Children) > 0 && !(ast.Piped && options.KeepPipelines)
+	case METHOD:
+		return len(ast.Children) > 0
+	}
+	return false
+}
+
+// isSameChain 判断子节点是否与节点属于同一个逻辑运算链，即运算符相同且没有括号
+func (ast *ASTNode) isSameChain(child *ASTNode) bool {
+	return child.Token != nil && child.Token.Kind == LOGICALOP && child.Token.Symbol() == ast.Token.Symbol()
+}
+
+// writeLine 输出一行代码并换行，以行注释结尾的代码已经换过行了
+func writeLine(sb *strings.Builder, line string) {
+	sb.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n")
+	}
+}
+
+// writeSeparator 输出操作数之间的运算符或分隔符
+// 以行注释结尾的操作数已经换过行了，分隔符从下一行的缩进处开始，去掉开头的空格，这样再次格式化时输出不变
+func writeSeparator(sb *strings.Builder, separator string, indentation string) {
+	if !strings.HasSuffix(sb.String(), "\n") {
+		sb.WriteString(separator)
+		return
+	}
+	sb.WriteString(indentation)
+	sb.WriteString(strings.TrimLeft(separator, " "))
+}
+
+// writeInline 输出接在同一行已有代码之后的子节点
+// 以前置行注释开头的子节点要另起一行，否则再次解析时注释会成为前一个 token 的后置注释，换行前行尾的空格去掉
+func writeInline(sb *strings.Builder, code string, indentation string) {
+	if !strings.HasPrefix(code, "//") || sb.Len() == 0 || strings.HasSuffix(sb.String(), "\n") {
+		sb.WriteString(code)
+		return
+	}
+	line := strings.TrimRight(sb.String(), indentCharacters)
+	sb.Reset()
+	sb.WriteString(line)
+	sb.WriteString("\n")
+	sb.WriteString(indentation)
+	sb.WriteString(code)
 }
 
-// GenerateWithIndent 生成带有缩进和换行的代码
-func (ast *ASTNode) generateWithIndent(indent int) string {
+// writeOperator 输出二元运算符与右侧的操作数，OperatorSpacing 为 SPACING_COMPACT 时运算符两侧不加空格
+// 文字形式的运算符，以及与相邻的符号连在一起会被读成一个运算符的，如 a - -1 中的 - 与 -，仍然加上空格
+func (ast *ASTNode) writeOperator(sb *strings.Builder, operator string, indent int, options GenerateOptions) {
+	indentation := options.indentation(indent)
+	if options.OperatorSpacing != SPACING_COMPACT || unicode.IsLetter(getFirstRune(operator)) {
+		writeSeparator(sb, " "+operator+" ", indentation)
+		writeInline(sb, ast.Children[1].generateInline(indent, options, sb.String()), indentation)
+		return
+	}
+
+	if runTogether(lastRune(sb.String()), getFirstRune(operator)) {
+		operator = " " + operator
+	}
+	writeSeparator(sb, operator, indentation)
+	right := ast.Children[1].generateInline(indent, options, sb.String())
+	if runTogether(lastRune(operator), getFirstRune(right)) {
+		sb.WriteString(" ")
+	}
+	writeInline(sb, right, indentation)
+}
+
+// comma 返回函数调用的参数之间的分隔符
+func (options GenerateOptions) comma() string {
+	if options.CommaSpacing == SPACING_COMPACT {
+		return ","
+	}
+	return ", "
+}
+
+// generateNode 生成节点本身的代码，不包括附着在节点上的注释
+func (ast *ASTNode) generateNode(indent int, options GenerateOptions) string {
 	if ast.Token == nil {
 		return ""
 	}
 
+	breakChain := options.breakChain
+	options.breakChain = false
+
+	// 按宽度换行时，放得下一行的逻辑运算、括号与函数调用不换行
+	if options.maxWidth != 0 && !options.flat && !breakChain && ast.isBreakable(options) {
+		if code, fits := ast.generateFlat(indent, options); fits {
+			return code
+		}
+	}
+
 	var sb strings.Builder
-	indentation := strings.Repeat("  ", indent)
+	indentation := options.indentation(indent)
 
 	switch ast.Token.Kind {
 	case PREFIX:
@@ -31,54 +356,104 @@ func (ast *ASTNode) generateWithIndent(indent int) string {
 		if !isChildrenClause {
 			childIndent = indent + 1
 		}
-		children := ast.Children[0].generateWithIndent(childIndent)
-		multiLine := strings.Contains(children, "&&") || strings.Contains(children, "||") || strings.Contains(children, "!")
+		operator := operatorText(ast.Token, options)
+		childOptions := options
+		childOptions.column = options.columnAfter(indentation + operator + " ")
+		children := ast.Children[0].generateWithIndent(childIndent, childOptions)
+		// 只有子节点本身跨多行时才需要额外的括号包裹
+		multiLine := strings.Contains(children, "\n")
 		sb.WriteString(indentation)
-		sb.WriteString(ast.Token.Raw)
+		sb.WriteString(operator)
+		// 文字形式的 not 与操作数之间需要空格
+		if unicode.IsLetter(getFirstRune(operator)) && !(multiLine && !isChildrenClause) {
+			sb.WriteString(" ")
+		}
 		if multiLine && !isChildrenClause {
-			sb.WriteString("( ")
+			sb.WriteString("(")
 			sb.WriteString("\n")
 			sb.WriteString(children)
 		} else {
-			sb.WriteString(strings.TrimLeft(children, " "))
+			sb.WriteString(strings.TrimLeft(children, indentCharacters))
 		}
 		if multiLine && !isChildrenClause {
-			sb.WriteString("\n")
+			if !strings.HasSuffix(children, "\n") {
+				sb.WriteString("\n")
+			}
 			sb.WriteString(indentation)
 			sb.WriteString(")")
 		}
-	case NUMERIC, BOOLEAN:
+	case NUMERIC, BOOLEAN, NULL:
+		sb.WriteString(indentation)
 		sb.WriteString(ast.Token.Raw)
 	case STRING:
-		sb.WriteString(fmt.Sprintf("'%s'", ast.Token.Raw))
+		sb.WriteString(indentation)
+		sb.WriteString(fmt.Sprintf("'%s'", encodeString(ast.Token.Raw, "'\"")))
+	case INTERPOLATED_STRING:
+		// 插值表达式不参与外层缩进
+		sb.WriteString(indentation)
+		interpolationOptions := options
+		interpolationOptions.flat = options.maxWidth != 0
+		writeInterpolatedString(&sb, ast.Token.Value.(InterpolatedString), func(index int) string {
+			return strings.TrimSpace(ast.Children[index].generateWithIndent(0, interpolationOptions))
+		})
+	case DURATION:
+		sb.WriteString(indentation)
+		sb.WriteString(durationLiteral(ast.Token.Raw))
 	case PATTERN:
+		sb.WriteString(indentation)
+		sb.WriteString(fmt.Sprintf("'%s'", encodeString(ast.Token.Raw, "'\"")))
 	case TIME:
+		sb.WriteString(indentation)
+		sb.WriteString(fmt.Sprintf("'%s'", encodeString(ast.Token.Value.(time.Time).Format(options.TimeFormat), "'\"")))
 	case VARIABLE:
-		sb.WriteString(fmt.Sprintf("[%s]", ast.Token.Raw))
+		sb.WriteString(indentation)
+		sb.WriteString(fmt.Sprintf("[%s]", encodeVariableName(ast.Token.Raw)))
 	case FUNCTION:
+		if ast.Piped && options.KeepPipelines {
+			sb.WriteString(ast.generatePipeline(indent, options))
+			break
+		}
 		sb.WriteString(indentation)
 		sb.WriteString(ast.Token.Raw)
+		if options.maxWidth != 0 && !options.flat && len(ast.Children) > 0 {
+			ast.writeArgumentLines(&sb, 0, indent, options)
+			break
+		}
 		sb.WriteString("( ")
-		for i, child := range ast.Children {
+		for i := range ast.Children {
 			if i > 0 {
-				sb.WriteString(", ")
+				writeSeparator(&sb, options.comma(), indentation)
 			}
-			sb.WriteString(child.generateWithIndent(0))
+			writeInline(&sb, ast.generateArgument(i, 0, options), indentation)
 		}
-		sb.WriteString(" )")
+		writeSeparator(&sb, " )", indentation)
 	case SEPARATOR:
 	case ACCESSOR:
 		sb.WriteString(indentation)
-		sb.WriteString(strings.Join(ast.Token.Value.([]string), "."))
-		if len(ast.Children) > 0 && ast.Children[0].Token.Kind == CLAUSE {
+		sb.WriteString(accessorText(ast.Token.Value))
+	case METHOD:
+		// 方法名与访问器的输出相同，无参数时输出 ()
+		sb.WriteString(indentation)
+		sb.WriteString(accessorText(ast.Token.Value))
+		if len(ast.Children) == 0 {
 			sb.WriteString("()")
+			break
 		}
-	case COMPARATOR:
-		sb.WriteString(ast.Children[0].generateWithIndent(indent))
-		sb.WriteString(" ")
-		sb.WriteString(ast.Token.Value.(string))
-		sb.WriteString(" ")
-		sb.WriteString(ast.Children[1].generateWithIndent(indent))
+		if options.maxWidth != 0 && !options.flat {
+			ast.writeArgumentLines(&sb, 0, indent, options)
+			break
+		}
+		sb.WriteString("( ")
+		for i, child := range ast.Children {
+			if i > 0 {
+				writeSeparator(&sb, options.comma(), indentation)
+			}
+			writeInline(&sb, child.generateInline(0, options, sb.String()), indentation)
+		}
+		writeSeparator(&sb, " )", indentation)
+	case COMPARATOR, LIKE:
+		sb.WriteString(ast.Children[0].generateWithIndent(indent, options))
+		ast.writeOperator(&sb, ast.Token.Value.(string), indent, options)
 	case LOGICALOP:
 		// isLeftLogical := ast.Children[0].Token.Kind == LOGICALOP
 		// isRightLogical := ast.Children[1].Token.Kind == LOGICALOP
@@ -90,20 +465,29 @@ func (ast *ASTNode) generateWithIndent(indent int) string {
 		// if isRightLogical {
 		// 	rightIndent = rightIndent + 1
 		// }
-		left := ast.Children[0].generateWithIndent(leftIndent)
-		right := ast.Children[1].generateWithIndent(rightIndent)
+		if options.flat {
+			sb.WriteString(ast.Children[0].generateWithIndent(indent, options))
+			writeSeparator(&sb, " "+operatorText(ast.Token, options)+" ", indentation)
+			writeInline(&sb, ast.Children[1].generateInline(indent, options, sb.String()), indentation)
+			break
+		}
+		// 逻辑运算链换行时，链上同一运算符的各个运算都要换行，每个操作数一行
+		leftOptions, rightOptions := options, options.atLineStart()
+		leftOptions.breakChain = ast.isSameChain(ast.Children[0])
+		rightOptions.breakChain = ast.isSameChain(ast.Children[1])
+		left := ast.Children[0].generateWithIndent(leftIndent, leftOptions)
+		right := ast.Children[1].generateWithIndent(rightIndent, rightOptions)
 		// sb.WriteString(indentation)
 		// if isLeftLogical {
 		// 	sb.WriteString("(\n")
 		// }
-		sb.WriteString(left)
-		sb.WriteString("\n")
+		writeLine(&sb, left)
 		// if isLeftLogical {
 		// 	sb.WriteString(indentation)
 		// 	sb.WriteString(")\n")
 		// }
 		sb.WriteString(indentation)
-		sb.WriteString(ast.Token.Value.(string))
+		sb.WriteString(operatorText(ast.Token, options))
 		sb.WriteString("\n")
 		// sb.WriteString(indentation)
 		// if isRightLogical {
@@ -116,28 +500,223 @@ func (ast *ASTNode) generateWithIndent(indent int) string {
 		// 	sb.WriteString(")")
 		// }
 	case MODIFIER:
+		// 字符串拼接与数值运算共用 MODIFIER，操作数按原样输出即可
+		sb.WriteString(ast.Children[0].generateWithIndent(indent, options))
+		ast.writeOperator(&sb, ast.Token.Raw, indent, options)
 	case CLAUSE:
+		if options.flat {
+			sb.WriteString(indentation)
+			sb.WriteString("( ")
+			writeInline(&sb, ast.Children[0].generateInline(indent+1, options, sb.String()), options.indentation(indent+1))
+			writeSeparator(&sb, " )", indentation)
+			break
+		}
 		sb.WriteString(indentation)
 		sb.WriteString("(\n")
-		sb.WriteString(ast.Children[0].generateWithIndent(indent + 1))
-		sb.WriteString("\n")
+		writeLine(&sb, ast.Children[0].generateWithIndent(indent+1, options.atLineStart()))
 		sb.WriteString(indentation)
 		sb.WriteString(")")
 	case CLAUSE_CLOSE:
 		sb.WriteString(")")
 	case TERNARY:
+		// 条件、真值与假值依次是三个子节点
+		sb.WriteString(ast.Children[0].generateWithIndent(indent, options))
+		writeSeparator(&sb, " ? ", indentation)
+		writeInline(&sb, ast.Children[1].generateInline(indent, options, sb.String()), indentation)
+		writeSeparator(&sb, " : ", indentation)
+		writeInline(&sb, ast.Children[2].generateInline(indent, options, sb.String()), indentation)
+	case BETWEEN:
+		// 分隔上下界的 and 与 between 的大小写保持一致
+		separator := " and "
+		if ast.Token.Raw == "BETWEEN" {
+			separator = " AND "
+		}
+		sb.WriteString(ast.Children[0].generateWithIndent(indent, options))
+		writeSeparator(&sb, " "+ast.Token.Raw+" ", indentation)
+		writeInline(&sb, ast.Children[1].generateInline(indent, options, sb.String()), indentation)
+		writeSeparator(&sb, separator, indentation)
+		writeInline(&sb, ast.Children[2].generateInline(indent, options, sb.String()), indentation)
+	case NULL_COALESCE, ELVIS:
+		sb.WriteString(ast.Children[0].generateWithIndent(indent, options))
+		writeSeparator(&sb, " "+ast.Token.Raw+" ", indentation)
+		writeInline(&sb, ast.Children[1].generateInline(indent, options, sb.String()), indentation)
 	case ARRAY:
-		sb.WriteString("( ")
+		// 保留数组的原始写法，[1, 2] 或 in 之后的 (1, 2)
+		open, close := "( ", " )"
+		if ast.Token.Raw == "[" && len(ast.Children) == 0 {
+			open, close = "[", "]"
+		} else if ast.Token.Raw == "[" {
+			open, close = "[ ", " ]"
+		} else if len(ast.Children) == 1 {
+			// 只有一个元素的列表需要保留逗号，否则会被当成普通的括号
+			close = ", )"
+		}
+		sb.WriteString(open)
 		for i, child := range ast.Children {
 			if i > 0 {
-				sb.WriteString(", ")
+				writeSeparator(&sb, ", ", indentation)
 			}
-			sb.WriteString(child.generateWithIndent(0))
+			writeInline(&sb, child.generateInline(0, options, sb.String()), indentation)
+		}
+		writeSeparator(&sb, close, indentation)
+	case MAP:
+		if len(ast.Children) == 0 {
+			sb.WriteString("{}")
+			break
 		}
-		sb.WriteString(" )")
+		sb.WriteString("{ ")
+		for i := 0; i+1 < len(ast.Children); i += 2 {
+			if i > 0 {
+				writeSeparator(&sb, ", ", indentation)
+			}
+			writeInline(&sb, ast.Children[i].generateInline(0, options, sb.String()), indentation)
+			writeSeparator(&sb, ": ", indentation)
+			writeInline(&sb, ast.Children[i+1].generateInline(0, options, sb.String()), indentation)
+		}
+		writeSeparator(&sb, " }", indentation)
+	case LAMBDA:
+		// 单个参数省略括号：x -> body，其余情况为 (x, y) -> body
+		// 不能直接书写的参数名与变量一样加上中括号，如 [my var] -> ...
+		parameters := make([]string, len(ast.Token.Value.([]string)))
+		for i, parameter := range ast.Token.Value.([]string) {
+			parameters[i] = parameter
+			if !isBareName(parameter, ParserOptions{}) {
+				parameters[i] = "[" + encodeVariableName(parameter) + "]"
+			}
+		}
+		sb.WriteString(indentation)
+		if len(parameters) == 1 {
+			sb.WriteString(parameters[0])
+		} else {
+			sb.WriteString("(" + strings.Join(parameters, ", ") + ")")
+		}
+		sb.WriteString(" -> ")
+		writeInline(&sb, ast.Children[0].generateInline(indent, options, sb.String()), indentation)
+	case NAMED_ARGUMENT:
+		sb.WriteString(indentation)
+		sb.WriteString(ast.Token.Raw)
+		sb.WriteString(": ")
+		writeInline(&sb, ast.Children[0].generateInline(indent, options, sb.String()), indentation)
+	case INDEX:
+		sb.WriteString(ast.Children[0].generateWithIndent(indent, options))
+		sb.WriteString("[")
+		writeInline(&sb, ast.Children[1].generateInline(0, options, sb.String()), indentation)
+		sb.WriteString("]")
 	default:
 		return ""
 	}
 
 	return sb.String()
 }
+
+// generatePipeline 以管道形式输出函数调用：a |> f，或带其余参数的 a |> f( b )
+func (ast *ASTNode) generatePipeline(indent int, options GenerateOptions) string {
+	var sb strings.Builder
+
+	sb.WriteString(ast.Children[0].generateWithIndent(indent, options))
+	writeSeparator(&sb, " |> ", options.indentation(indent))
+	sb.WriteString(ast.Token.Raw)
+
+	if len(ast.Children) > 1 {
+		sb.WriteString("( ")
+		for i := 1; i < len(ast.Children); i++ {
+			if i > 1 {
+				writeSeparator(&sb, options.comma(), options.indentation(indent))
+			}
+			writeInline(&sb, ast.generateArgument(i, 0, options), options.indentation(indent))
+		}
+		writeSeparator(&sb, " )", options.indentation(indent))
+	}
+
+	return sb.String()
+}
+
+// writeArgumentLines 输出放不下一行的函数调用的参数，从第 first 个参数开始每行一个，比调用多缩进一级
+func (ast *ASTNode) writeArgumentLines(sb *strings.Builder, first int, indent int, options GenerateOptions) {
+	sb.WriteString("(\n")
+	for i := first; i < len(ast.Children); i++ {
+		sb.WriteString(options.indentation(indent + 1))
+		argument := ast.generateArgument(i, indent+1, options.atLineStart())
+		if i < len(ast.Children)-1 {
+			// 逗号写在参数之后的注释之前，以行注释结尾的其他参数之后的逗号只能写在下一行
+			comments := trailingComments(ast.Children[i].Comments, options.indentation(indent+1))
+			switch {
+			case comments != "" && strings.HasSuffix(argument, comments):
+				argument = strings.TrimSuffix(argument, comments) + "," + comments
+			case strings.HasSuffix(argument, "\n"):
+				argument += options.indentation(indent+1) + ","
+			default:
+				argument += ","
+			}
+		}
+		writeLine(sb, argument)
+	}
+	sb.WriteString(options.indentation(indent))
+	sb.WriteString(")")
+}
+
+// generateArgument 按照 ArgumentStyle 输出函数调用的第 i 个参数
+// 参数输出在 indent 级缩进处，不包括开头的缩进；除 ARGUMENTS_AS_WRITTEN 外参数已经按照 Parameters 排好了顺序，只有当参数所在的位置与声明的位置一致时才能省略参数名
+func (ast *ASTNode) generateArgument(i int, indent int, options GenerateOptions) string {
+	child := ast.Children[i]
+	parameters := functionParameters(ast.Token)
+
+	switch options.ArgumentStyle {
+	case ARGUMENTS_POSITIONAL:
+		if child.Token.Kind == NAMED_ARGUMENT && ast.isInPosition(i, parameters) {
+			return strings.TrimLeft(child.Children[0].generateWithIndent(indent, options), indentCharacters)
+		}
+	case ARGUMENTS_NAMED:
+		if child.Token.Kind != NAMED_ARGUMENT && i < len(parameters) && !(ast.Piped && options.KeepPipelines && i == 0) {
+			return parameters[i] + ": " + strings.TrimLeft(child.generateWithIndent(indent, options), indentCharacters)
+		}
+	}
+
+	return strings.TrimLeft(child.generateWithIndent(indent, options), indentCharacters)
+}
+
+// isInPosition 判断前 i+1 个参数是否都恰好位于声明的位置上，即中间没有被跳过的参数
+func (ast *ASTNode) isInPosition(i int, parameters []string) bool {
+	for j := 0; j <= i; j++ {
+		child := ast.Children[j]
+		if child.Token.Kind == NAMED_ARGUMENT && parameterIndex(parameters, child.Token.Raw) != j {
+			return false
+		}
+	}
+	return true
+}
+
+// accessorText 输出访问器，各段中不能直接书写的字符需要转义
+func accessorText(value interface{}) string {
+	switch value := value.(type) {
+	case OptionalAccessor:
+		segments := make([]string, len(value.Segments))
+		for i, segment := range value.Segments {
+			segments[i] = encodeAccessorSegment(segment)
+		}
+		return OptionalAccessor{Segments: segments, NilSafe: value.NilSafe}.String()
+	case []string:
+		segments := make([]string, len(value))
+		for i, segment := range value {
+			segments[i] = encodeAccessorSegment(segment)
+		}
+		return strings.Join(segments, ".")
+	}
+	return ""
+}
+
+// operatorText 按照 OperatorStyle 返回逻辑运算符的输出形式，其他运算符原样输出
+func operatorText(token *ExpressionToken, options GenerateOptions) string {
+	symbol := token.Symbol()
+	if _, found := textualOperators[symbol]; !found {
+		return token.Raw
+	}
+
+	switch options.OperatorStyle {
+	case OPERATORS_SYMBOLIC:
+		return symbol
+	case OPERATORS_TEXTUAL:
+		return textualOperators[symbol]
+	}
+	return token.Raw
+}
@@ -0,0 +1,227 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNamedArgumentOrder(t *testing.T) {
+
+	options := ParserOptions{
+		Functions: map[string]ExpressionFunction{
+			"f": {Name: "f", Parameters: []string{"a", "b", "c"}},
+		},
+	}
+
+	tests := []struct {
+		expression string
+		style      ArgumentStyle
+		want       string
+	}{
+		{"f(b: 1, a: 2)", ARGUMENTS_AS_WRITTEN, "f( b: 1, a: 2 )"},
+		{"f(b: 1, a: 2)", ARGUMENTS_POSITIONAL, "f( 2, 1 )"},
+		{"f(b: 1, a: 2)", ARGUMENTS_NAMED, "f( a: 2, b: 1 )"},
+		{"f(1, c: 3, b: 2)", ARGUMENTS_AS_WRITTEN, "f( 1, c: 3, b: 2 )"},
+		{"f(1, c: 3, b: 2)", ARGUMENTS_POSITIONAL, "f( 1, 2, 3 )"},
+		{"f(c: 3)", ARGUMENTS_POSITIONAL, "f( c: 3 )"},
+	}
+
+	for _, test := range tests {
+		tree, err := parseAST(test.expression, options)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		generate := GenerateOptions{ArgumentStyle: test.style}
+		if generated := tree.GenerateWithOptions(generate); generated != test.want {
+			t.Errorf("%q with ArgumentStyle %d generates %q, want %q", test.expression, test.style, generated, test.want)
+		}
+		if err := CheckRoundTrip(test.expression, options, generate); err != nil {
+			t.Errorf("%q with ArgumentStyle %d: %v", test.expression, test.style, err)
+		}
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		format     string
+		want       string
+	}{
+		{"[t] > '2024-01-02'", time.RFC3339, "[t] > '2024-01-02T00:00:00Z'"},
+		{"[t] > '2024-01-02 15:04'", time.RFC3339, "[t] > '2024-01-02T15:04:00Z'"},
+		{"[t] > '2024-01-02T10:00:00+02:00'", time.RFC3339, "[t] > '2024-01-02T10:00:00+02:00'"},
+
+		// the default keeps fractional seconds, and leaves them out where there are none
+		{"[t] > '2024-01-02T10:00:00.5Z'", "", "[t] > '2024-01-02T10:00:00.5Z'"},
+		{"[t] > '2024-01-02T10:00:00Z'", "", "[t] > '2024-01-02T10:00:00Z'"},
+	}
+
+	for _, test := range tests {
+		tree, err := parseAST(test.expression, ParserOptions{})
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		generate := GenerateOptions{TimeFormat: test.format}
+		generated := tree.GenerateWithOptions(generate)
+		if generated != test.want {
+			t.Errorf("%q with TimeFormat %q generates %q, want %q", test.expression, test.format, generated, test.want)
+		}
+
+		// the generated time parses back to an equal time.Time
+		reparsed, err := parseAST(generated, ParserOptions{})
+		if err != nil {
+			t.Errorf("%q: %v", generated, err)
+			continue
+		}
+		want, got := tree.Children[1].Token.Value.(time.Time), reparsed.Children[1].Token.Value.(time.Time)
+		if !got.Equal(want) {
+			t.Errorf("%q generates %q, which parses into %v, want %v", test.expression, generated, got, want)
+		}
+	}
+}
+
+func TestParenthesesStyle(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		minimal    string
+		explicit   string
+	}{
+		// prefix operators bind tighter than **, and ?? and ternaries group from the right
+		{"(-x) ** 2", "-[x] ** 2", "( -[x] ) ** 2"},
+		{"a ?? (b ? c : d)", "[a] ?? [b] ? [c] : [d]", "[a] ?? ( [b] ? [c] : [d] )"},
+		{"x -> (y -> y)", "x -> y -> [y]", "x -> ( y -> [y] )"},
+		{"a ? b : (c ? d : e)", "[a] ? [b] : [c] ? [d] : [e]", "[a] ? [b] : ( [c] ? [d] : [e] )"},
+		{"(a && b) || c", "[a] && [b] || [c]", "( [a] && [b] ) || [c]"},
+		{"a + b * c - d / e % h", "[a] + [b] * [c] - [d] / [e] % [h]", "[a] + ( [b] * [c] ) - ( [d] / [e] % [h] )"},
+		{"(a + b) * c", "( [a] + [b] ) * [c]", "( [a] + [b] ) * [c]"},
+	}
+
+	for _, test := range tests {
+		tree, err := parseAST(test.expression, ParserOptions{})
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		for style, want := range map[ParenthesesStyle]string{PARENTHESES_MINIMAL: test.minimal, PARENTHESES_EXPLICIT: test.explicit} {
+
+			generate := GenerateOptions{Parentheses: style, flat: true, maxWidth: -1}
+			generated := tree.GenerateWithOptions(generate)
+			if generated != want {
+				t.Errorf("%q with Parentheses %d generates %q, want %q", test.expression, style, generated, want)
+			}
+
+			reparsed, err := parseAST(generated, ParserOptions{})
+			if err != nil {
+				t.Errorf("%q with Parentheses %d generates %q, which doesn't parse: %v", test.expression, style, generated, err)
+				continue
+			}
+			if !equalIgnoringParentheses(tree, reparsed) {
+				t.Errorf("%q with Parentheses %d generates %q, which parses into a different tree", test.expression, style, generated)
+			}
+		}
+	}
+}
+
+func TestEqualIgnoringParentheses(t *testing.T) {
+
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"(a * b) + c", "a * b + c", true},
+		{"((a))", "a", true},
+		{"(a + b) * c", "a + b * c", false},
+		{"(-x) ** 2", "-x ** 2", true},
+		{"-(x ** 2)", "-x ** 2", false},
+		{"a - (b - c)", "a - b - c", false},
+		{"x in (1, 2)", "x in (1, 2)", true},
+	}
+
+	for _, test := range tests {
+		a, err := parseAST(test.a, ParserOptions{})
+		if err != nil {
+			t.Fatalf("%q: %v", test.a, err)
+		}
+		b, err := parseAST(test.b, ParserOptions{})
+		if err != nil {
+			t.Fatalf("%q: %v", test.b, err)
+		}
+		if equal := equalIgnoringParentheses(a, b); equal != test.equal {
+			t.Errorf("equalIgnoringParentheses(%q, %q) = %v, want %v", test.a, test.b, equal, test.equal)
+		}
+	}
+}
+
+func TestPrefixGeneration(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       string
+		flat       string
+	}{
+		{"!x", "![x]", "![x]"},
+		{"-x", "-[x]", "-[x]"},
+		{"!(a && b)", "!(\n  [a]\n  &&\n  [b]\n)", "!( [a] && [b] )"},
+		{"!(!a)", "!(\n  ![a]\n)", "!( ![a] )"},
+		{"-(a + b) * 2", "-(\n  [a] + [b]\n) * 2", "-( [a] + [b] ) * 2"},
+	}
+
+	for _, test := range tests {
+		tree, err := parseAST(test.expression, ParserOptions{})
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		if generated := tree.Generate(); generated != test.want {
+			t.Errorf("%q generates %q, want %q", test.expression, generated, test.want)
+		}
+		if flat := (Formatter{MaxWidth: -1}).Format(tree); flat != test.flat {
+			t.Errorf("%q generates %q on one line, want %q", test.expression, flat, test.flat)
+		}
+		if err := CheckRoundTrip(test.expression, ParserOptions{}, GenerateOptions{}); err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+		}
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"'Hello, ' + name + '!'", "'Hello, ' + [name] + '!'"},
+		{"'a' + b + 'c'", "'a' + [b] + 'c'"},
+		{"'a' + (b + 'c')", "'a' + ( [b] + 'c' )"},
+		{"'it\\'s' + b", "'it\\'s' + [b]"},
+	}
+
+	for _, test := range tests {
+		tree, err := parseAST(test.expression, ParserOptions{})
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		generated := (Formatter{MaxWidth: -1}).Format(tree)
+		if generated != test.want {
+			t.Errorf("%q generates %q, want %q", test.expression, generated, test.want)
+		}
+
+		// generating the code again from what was generated changes nothing
+		reparsed, err := parseAST(generated, ParserOptions{})
+		if err != nil {
+			t.Errorf("%q generates %q, which doesn't parse: %v", test.expression, generated, err)
+			continue
+		}
+		if !Equal(tree, reparsed) {
+			t.Errorf("%q generates %q, which parses into a different tree", test.expression, generated)
+		}
+		if again := (Formatter{MaxWidth: -1}).Format(reparsed); again != generated {
+			t.Errorf("%q generates %q, then %q", test.expression, generated, again)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+Decides which characters may make up a variable, accessor or function name.
+*/
+type IdentifierPolicy int
+
+const (
+	// Any Unicode letter may start a name, and letters, digits and '_' may continue it. This is the default.
+	IDENTIFIERS_UNICODE IdentifierPolicy = iota
+
+	// Only the ASCII letters a-z and A-Z may start a name, and those, 0-9 and '_' may continue it.
+	IDENTIFIERS_ASCII
+
+	// Names are checked with ParserOptions.IdentifierRune.
+	IDENTIFIERS_CUSTOM
+)
+
+/*
+Reports whether [character] may start a name (when [first] is true) or continue one, under the options' IdentifierPolicy.
+*/
+func (options ParserOptions) isIdentifierRune(character rune, first bool) bool {
+
+	switch options.IdentifierPolicy {
+	case IDENTIFIERS_ASCII:
+		if character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z' {
+			return true
+		}
+		return !first && (character >= '0' && character <= '9' || character == '_')
+
+	case IDENTIFIERS_CUSTOM:
+		return options.IdentifierRune != nil && options.IdentifierRune(character, first)
+	}
+
+	if unicode.IsLetter(character) {
+		return true
+	}
+	return !first && (unicode.IsDigit(character) || character == '_')
+}
+
+/*
+Reports whether [character] continues a name, including the '.' between accessor segments.
+*/
+func (options ParserOptions) isVariableName(character rune) bool {
+	return character == '.' || options.isIdentifierRune(character, false)
+}
+
+/*
+Checks that the letters in a bracketed name such as [user name] are allowed under the options' IdentifierPolicy.
+Brackets exist to allow spaces and punctuation in names, so only letters are checked.
+*/
+func (options ParserOptions) checkBracketedName(name string) error {
+
+	for _, character := range name {
+		if unicode.IsLetter(character) && !options.isIdentifierRune(character, false) {
+			return disallowedIdentifierError(character, name)
+		}
+	}
+	return nil
+}
+
+/*
+Rewrites each segment of the (possibly dotted) [name] to its spelling in options.CanonicalNames, if it has one.
+*/
+func (options ParserOptions) canonicalName(name string) string {
+
+	if options.CanonicalNames == nil {
+		return name
+	}
+
+	segments := strings.Split(name, ".")
+	for i, segment := range segments {
+
+		// the '?' of an optional chain stays where it was
+		base := strings.TrimSuffix(segment, "?")
+		segments[i] = options.canonicalSegment(base) + segment[len(base):]
+	}
+	return strings.Join(segments, ".")
+}
+
+func (options ParserOptions) canonicalSegment(name string) string {
+
+	if canonical, found := options.CanonicalNames[strings.ToLower(name)]; found {
+		return canonical
+	}
+	return name
+}
+
+/*
+Looks up the function called [name] regardless of case, for when CanonicalNames is set.
+Returns the name it is registered under, or [name] itself if there is no such function.
+As with an exact lookup, a function in options.Functions hides one in options.FunctionRegistry;
+a name which matches more than one function of either, such as 'max' with both 'Max' and 'MAX', is an error,
+rather than calling whichever the iteration of the map happens to find first.
+*/
+func (options ParserOptions) foldedFunction(name string) (string, ExpressionFunction, bool, error) {
+
+	registered, err := foldedName(name, options.Functions)
+	if err != nil {
+		return name, ExpressionFunction{}, false, err
+	}
+	if registered != "" {
+		return registered, options.Functions[registered], true, nil
+	}
+	return options.FunctionRegistry.lookupFolded(name)
+}
+
+/*
+Returns the one name in [functions] equal to [name] regardless of case, or the empty string if there is none.
+*/
+func foldedName(name string, functions map[string]ExpressionFunction) (string, error) {
+
+	var matches []string
+	for registered := range functions {
+		if strings.EqualFold(registered, name) {
+			matches = append(matches, registered)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", nil
+	case 1:
+		return matches[0], nil
+	}
+
+	sort.Strings(matches)
+	return "", fmt.Errorf("Function name '%s' is ambiguous, matching '%s'", name, strings.Join(matches, "', '"))
+}
+
+func disallowedIdentifierError(character rune, name string) error {
+	return fmt.Errorf("Character '%c' is not allowed in name '%s'", character, name)
+}
+
+/*
+Reports whether an accessor segment refers to an exported field, by the same rule as Go:
+it must start with an upper case letter. Names in scripts without case (such as '名前') are not exported.
+*/
+func isExportedName(name string) bool {
+	return unicode.IsUpper(getFirstRune(name))
+}
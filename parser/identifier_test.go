@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestFoldedFunctionLookup(t *testing.T) {
+
+	ambiguous := map[string]ExpressionFunction{
+		"Max": {Name: "Max"},
+		"MAX": {Name: "MAX"},
+		"min": {Name: "min"},
+	}
+
+	tests := []struct {
+		expression string
+		options    ParserOptions
+		want       string
+		err        string
+	}{
+		{"MIN(1)", ParserOptions{Functions: ambiguous}, "min", ""},
+		{"Max(1)", ParserOptions{Functions: ambiguous}, "Max", ""},
+		{"max(1)", ParserOptions{Functions: ambiguous}, "", "Function name 'max' is ambiguous, matching 'MAX', 'Max'"},
+		{"max(1)", ParserOptions{FunctionRegistry: NewFunctionRegistryFromMap(ambiguous)}, "", "Function name 'max' is ambiguous, matching 'MAX', 'Max'"},
+
+		// the Functions map hides the registry, as it does for an exact match
+		{"max(1)", ParserOptions{Functions: map[string]ExpressionFunction{"mAx": {}}, FunctionRegistry: NewFunctionRegistryFromMap(ambiguous)}, "mAx", ""},
+	}
+
+	for _, test := range tests {
+		test.options.CanonicalNames = map[string]string{}
+
+		// the result mustn't depend on the order the maps are iterated in
+		for i := 0; i < 20; i++ {
+			tokens, err := ParseTokensWithOptions(test.expression, test.options)
+
+			if test.err != "" {
+				if err == nil || parseErrorOf(err).Msg != test.err {
+					t.Fatalf("%q: got error %v, want %q", test.expression, err, test.err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%q: %v", test.expression, err)
+			}
+			if tokens[0].Kind != FUNCTION || tokens[0].Raw != test.want {
+				t.Fatalf("%q: got %v %q, want the function %q", test.expression, tokens[0].Kind, tokens[0].Raw, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package parser
+
+import (
+	"fmt"
+)
+
+// 类型推断使用的类型名，FUNCTION 的 ReturnType 也应使用这些名字
+const (
+	typeNumber = "number"
+	typeString = "string"
+	typeBool   = "bool"
+	typeTime   = "time"
+	typeArray  = "array"
+	typeMap    = "map"
+	typeNull   = "null"
+
+	typeDuration = "duration"
+	typeUnknown  = "unknown"
+)
+
+// InferType 自底向上推断表达式的类型，结果为 "number"、"string"、"bool"、"time"、"array"、"map"、"null"、"duration" 或 "unknown"
+// FUNCTION 的类型取自 functions 中声明的 ReturnType，未声明时为 "unknown"
+// 变量和访问器的类型是 "unknown"，不会触发类型错误；只有两侧类型都确定且明显不兼容时才报错
+func InferType(node *ASTNode, functions map[string]ExpressionFunction) (string, error) {
+	if node == nil || node.Token == nil {
+		return typeUnknown, nil
+	}
+
+	children := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		childType, err := InferType(child, functions)
+		if err != nil {
+			return typeUnknown, err
+		}
+		children[i] = childType
+	}
+
+	token := node.Token
+	if token.Kind == FUNCTION {
+		return functionReturnType(token, functions), nil
+	}
+
+	ret, err := OperationType(*token, children)
+	if err != nil {
+		return typeUnknown, fmt.Errorf("type mismatch: %v at %d", err, token.Start)
+	}
+	return ret, nil
+}
+
+// OperationType 按照 InferType 的类型规则，由子节点的类型 operands 推断 token 所在节点的类型
+// 返回的错误不带 "type mismatch" 前缀与位置，供 InferType 与 types 包共用同一套规则
+// 变量、访问器与函数调用的类型取决于调用方，这里均为 "unknown"
+func OperationType(token ExpressionToken, operands []string) (string, error) {
+	// 自定义运算符的语义未知，只能确定比较与逻辑运算的结果为 bool
+	if _, found := customOperator(&token); found {
+		switch token.Kind {
+		case COMPARATOR, LOGICALOP:
+			return typeBool, nil
+		}
+		return typeUnknown, nil
+	}
+
+	switch token.Kind {
+	case NUMERIC:
+		return typeNumber, nil
+	case STRING, PATTERN, INTERPOLATED_STRING:
+		return typeString, nil
+	case BOOLEAN:
+		return typeBool, nil
+	case TIME:
+		return typeTime, nil
+	case DURATION:
+		return typeDuration, nil
+	case ARRAY:
+		return typeArray, nil
+	case MAP:
+		return typeMap, nil
+	case NULL:
+		return typeNull, nil
+	case CLAUSE, NAMED_ARGUMENT:
+		if len(operands) == 1 {
+			return operands[0], nil
+		}
+		return typeUnknown, nil
+	case PREFIX:
+		return inferPrefixType(&token, operands[0])
+	case MODIFIER:
+		return inferModifierType(&token, operands[0], operands[1])
+	case COMPARATOR:
+		return typeBool, checkComparatorTypes(&token, operands[0], operands[1])
+	case LIKE:
+		for _, operand := range operands {
+			if isKnownType(operand) && operand != typeString {
+				return typeUnknown, fmt.Errorf("'%s' expects string operands, got %s", token.Raw, operand)
+			}
+		}
+		return typeBool, nil
+	case BETWEEN:
+		for _, bound := range operands[1:] {
+			if isKnownType(operands[0]) && isKnownType(bound) && operands[0] != bound {
+				return typeUnknown, fmt.Errorf("cannot compare %s with %s using '%s'", operands[0], bound, token.Raw)
+			}
+		}
+		return typeBool, nil
+	case LOGICALOP:
+		for _, operand := range operands {
+			if isKnownType(operand) && operand != typeBool {
+				return typeUnknown, fmt.Errorf("'%s' expects bool operands, got %s", token.Raw, operand)
+			}
+		}
+		return typeBool, nil
+	case TERNARY:
+		// 三元运算取两个分支的类型，不一致时无法确定
+		if isKnownType(operands[0]) && operands[0] != typeBool {
+			return typeUnknown, fmt.Errorf("'%s' expects a bool condition, got %s", token.Raw, operands[0])
+		}
+		if operands[1] == operands[2] {
+			return operands[1], nil
+		}
+		return typeUnknown, nil
+	case NULL_COALESCE, ELVIS:
+		// 左侧恒为空值（也是假值）时，结果就是右侧
+		if operands[0] == typeNull {
+			return operands[1], nil
+		}
+		if operands[0] == operands[1] {
+			return operands[0], nil
+		}
+		return typeUnknown, nil
+	}
+
+	return typeUnknown, nil
+}
+
+func functionReturnType(token *ExpressionToken, functions map[string]ExpressionFunction) string {
+	function, found := functions[token.Raw]
+	if !found {
+		function, found = token.Value.(ExpressionFunction)
+	}
+
+	if !found || function.ReturnType == "" {
+		return typeUnknown
+	}
+	return function.ReturnType
+}
+
+func inferPrefixType(token *ExpressionToken, operand string) (string, error) {
+	expected := typeNumber
+	if prefixSymbols[token.Symbol()] == INVERT {
+		expected = typeBool
+	}
+
+	if isKnownType(operand) && operand != expected {
+		return typeUnknown, fmt.Errorf("'%s' expects a %s operand, got %s", token.Raw, expected, operand)
+	}
+	return expected, nil
+}
+
+func inferModifierType(token *ExpressionToken, left string, right string) (string, error) {
+	// 与 govaluate 一致，'+' 的任一侧为字符串时按字符串拼接处理
+	if modifierSymbols[token.Raw] == PLUS && (left == typeString || right == typeString) {
+		return typeString, nil
+	}
+
+	if left == typeDuration || right == typeDuration || (left == typeTime && right == typeTime) {
+		return inferDurationArithmetic(token, left, right)
+	}
+
+	for _, operand := range []string{left, right} {
+		if isKnownType(operand) && operand != typeNumber {
+			return typeUnknown, fmt.Errorf("'%s' expects number operands, got %s", token.Raw, operand)
+		}
+	}
+	return typeNumber, nil
+}
+
+// 时间与时长的运算：time ± duration 得到 time，time - time 与 duration ± duration 得到 duration，
+// duration 与 number 相乘或相除仍是 duration，其余组合均为类型错误
+func inferDurationArithmetic(token *ExpressionToken, left string, right string) (string, error) {
+	switch modifierSymbols[token.Raw] {
+	case PLUS, MINUS:
+		switch {
+		case left == typeTime && right == typeTime && modifierSymbols[token.Raw] == MINUS:
+			return typeDuration, nil
+		case left == typeTime && right == typeDuration:
+			return typeTime, nil
+		case left == typeDuration && right == typeTime && modifierSymbols[token.Raw] == PLUS:
+			return typeTime, nil
+		case left == typeDuration && right == typeDuration:
+			return typeDuration, nil
+		case !isKnownType(left) || !isKnownType(right):
+			return typeUnknown, nil
+		}
+	case MULTIPLY, DIVIDE:
+		switch {
+		case left == typeDuration && right == typeDuration && modifierSymbols[token.Raw] == DIVIDE:
+			return typeNumber, nil
+		case left == typeDuration && (right == typeNumber || !isKnownType(right)):
+			return typeDuration, nil
+		case right == typeDuration && (left == typeNumber || !isKnownType(left)) && modifierSymbols[token.Raw] == MULTIPLY:
+			return typeDuration, nil
+		}
+	}
+
+	return typeUnknown, fmt.Errorf("cannot apply '%s' to %s and %s", token.Raw, left, right)
+}
+
+func checkComparatorTypes(token *ExpressionToken, left string, right string) error {
+	switch comparatorSymbols[token.Symbol()] {
+	case IN:
+		return nil
+	case REQ, NREQ:
+		for _, operand := range []string{left, right} {
+			if isKnownType(operand) && operand != typeString {
+				return fmt.Errorf("'%s' expects string operands, got %s", token.Raw, operand)
+			}
+		}
+		return nil
+	}
+
+	// 任何类型都可以和空值判等
+	if left == typeNull || right == typeNull {
+		switch comparatorSymbols[token.Symbol()] {
+		case EQ, NEQ:
+			return nil
+		}
+	}
+
+	if isKnownType(left) && isKnownType(right) && left != right {
+		return fmt.Errorf("cannot compare %s with %s using '%s'", left, right, token.Raw)
+	}
+	return nil
+}
+
+func isKnownType(typeName string) bool {
+	return typeName != typeUnknown
+}
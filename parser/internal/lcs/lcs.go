@@ -0,0 +1,73 @@
+/*
+Package lcs aligns two sequences by their longest common subsequence,
+for the diffs of token streams and of trees.
+*/
+package lcs
+
+/*
+Represents a single step in the alignment of two sequences.
+*/
+type Op int
+
+const (
+	// the elements at the current position of both sequences are equal
+	EQUAL Op = iota
+	// the element at the current position of the first sequence is left out
+	DELETE
+	// the element at the current position of the second sequence is added
+	INSERT
+)
+
+/*
+Align returns a minimal edit script turning a sequence of [n] elements into one of [m],
+where [equal] reports whether element i of the first equals element j of the second.
+Unchanged runs are aligned using the longest common subsequence, so that a single insertion
+doesn't mark everything after it as changed. Where both a deletion and an insertion happen
+at the same place, the deletion comes first.
+*/
+func Align(n, m int, equal func(i, j int) bool) []Op {
+
+	// lengths[i][j] holds the length of the longest common subsequence of a[i:] and b[j:]
+	lengths := make([][]int, n+1)
+	for i := range lengths {
+		lengths[i] = make([]int, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if equal(i, j) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	ret := make([]Op, 0, max(n, m))
+
+	i, j := 0, 0
+	for i < n && j < m {
+
+		switch {
+		case equal(i, j):
+			ret = append(ret, EQUAL)
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			ret = append(ret, DELETE)
+			i++
+		default:
+			ret = append(ret, INSERT)
+			j++
+		}
+	}
+
+	for ; i < n; i++ {
+		ret = append(ret, DELETE)
+	}
+	for ; j < m; j++ {
+		ret = append(ret, INSERT)
+	}
+
+	return ret
+}
@@ -0,0 +1,218 @@
+package parser
+
+import (
+	"strings"
+)
+
+/*
+The value of an INTERPOLATED_STRING token, such as "${user.Name} is over quota".
+Segments holds the literal text around the embedded expressions, so it always has one more
+entry than Expressions; Expressions holds the tokens of each '${...}', with positions relative
+to the whole source expression.
+*/
+type InterpolatedString struct {
+	Segments    []string
+	Expressions [][]ExpressionToken
+}
+
+/*
+Reports whether the double-quoted string starting at the current position of the [stream]
+(just after its opening quote) contains an unescaped '${', without consuming anything.
+*/
+func hasInterpolation(stream *lexerStream) bool {
+
+	for i := stream.position; i < stream.length; i++ {
+
+		switch stream.source[i] {
+		case '\\':
+			i++
+		case '"':
+			return false
+		case '$':
+			if i+1 < stream.length && stream.source[i+1] == '{' {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+Reads a double-quoted string containing '${...}' interpolations, starting just after its opening quote
+and stopping after its closing quote. Each embedded expression is tokenized with the same [options].
+Returns the raw source between the quotes along with the parsed value.
+*/
+func readInterpolatedString(stream *lexerStream, options ParserOptions) (string, InterpolatedString, error) {
+
+	var ret InterpolatedString
+	var segment strings.Builder
+
+	start := stream.position
+
+	for stream.canRead() {
+
+		character := stream.readCharacter()
+
+		if character == '\\' {
+			decoded, err := readEscapeSequence(stream)
+			if err != nil {
+				return "", ret, err
+			}
+			segment.WriteRune(decoded)
+			continue
+		}
+
+		if character == '"' {
+			ret.Segments = append(ret.Segments, segment.String())
+			return string(stream.source[start : stream.position-1]), ret, nil
+		}
+
+		if character != '$' || peekCharacter(stream) != '{' {
+			segment.WriteRune(character)
+			continue
+		}
+
+		// skip the '{', and find the matching '}'
+		stream.readCharacter()
+		expressionStart := stream.position
+
+		expressionEnd, found := findInterpolationEnd(stream)
+		if !found {
+			return "", ret, &ParseError{Msg: "Unclosed interpolation in string literal", Start: expressionStart - 2, End: stream.length}
+		}
+
+		source := string(stream.source[expressionStart:expressionEnd])
+		if strings.TrimSpace(source) == "" {
+			return "", ret, &ParseError{Msg: "Empty interpolation in string literal", Start: expressionStart - 2, End: expressionEnd + 1}
+		}
+
+		tokens, err := ParseTokensWithOptions(source, options)
+		if err != nil {
+			if parseErr := parseErrorOf(err); parseErr != nil {
+				parseErr.Start += expressionStart
+				parseErr.End += expressionStart
+			}
+			return "", ret, err
+		}
+
+		shiftTokens(tokens, expressionStart)
+		locateTokens(tokens, stream)
+
+		ret.Segments = append(ret.Segments, segment.String())
+		ret.Expressions = append(ret.Expressions, tokens)
+		segment.Reset()
+
+		stream.position = expressionEnd + 1
+	}
+
+	return "", ret, &ParseError{Msg: "Unclosed string literal", Start: start - 1, End: stream.length}
+}
+
+/*
+Returns the position of the '}' closing the interpolation which starts at the current position of the [stream],
+skipping over nested braces and quoted strings. Does not move the stream.
+*/
+func findInterpolationEnd(stream *lexerStream) (int, bool) {
+
+	var quote rune
+	var depth int
+
+	for i := stream.position; i < stream.length; i++ {
+
+		character := stream.source[i]
+
+		if character == '\\' {
+			i++
+			continue
+		}
+
+		if quote != 0 {
+			if character == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch character {
+		case '\'', '"':
+			quote = character
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i, true
+			}
+			depth--
+		}
+	}
+
+	return 0, false
+}
+
+/*
+Writes [value] back out as a double-quoted string, rendering each embedded expression with [render].
+Segments are encoded like any other string literal, and any literal '${' is escaped.
+*/
+func writeInterpolatedString(sb *strings.Builder, value InterpolatedString, render func(index int) string) {
+
+	sb.WriteString("\"")
+
+	for i, segment := range value.Segments {
+
+		escaped := encodeString(segment, "\"")
+		sb.WriteString(strings.ReplaceAll(escaped, "${", "\\${"))
+
+		if i < len(value.Expressions) {
+			sb.WriteString("${")
+			sb.WriteString(render(i))
+			sb.WriteString("}")
+		}
+	}
+
+	sb.WriteString("\"")
+}
+
+func cloneInterpolatedString(value InterpolatedString) InterpolatedString {
+
+	ret := InterpolatedString{
+		Segments:    append([]string(nil), value.Segments...),
+		Expressions: make([][]ExpressionToken, len(value.Expressions)),
+	}
+
+	for i, tokens := range value.Expressions {
+		ret.Expressions[i] = make([]ExpressionToken, len(tokens))
+		for j, token := range tokens {
+			token.Value = cloneTokenValue(token.Value)
+			ret.Expressions[i][j] = token
+		}
+	}
+
+	return ret
+}
+
+func interpolatedStringsEqual(a, b InterpolatedString) bool {
+
+	if len(a.Segments) != len(b.Segments) || len(a.Expressions) != len(b.Expressions) {
+		return false
+	}
+
+	for i := range a.Segments {
+		if a.Segments[i] != b.Segments[i] {
+			return false
+		}
+	}
+
+	for i := range a.Expressions {
+		if len(a.Expressions[i]) != len(b.Expressions[i]) {
+			return false
+		}
+		for j := range a.Expressions[i] {
+			if !diffTokensEqual(a.Expressions[i][j], b.Expressions[i][j]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
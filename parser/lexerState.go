@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 )
 
@@ -23,12 +22,17 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
+			ARRAY,
+			MAP,
 			PATTERN,
 			FUNCTION,
 			ACCESSOR,
 			STRING,
+			INTERPOLATED_STRING,
 			TIME,
+			DURATION,
 			CLAUSE,
 		},
 	},
@@ -41,14 +45,21 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
+			ARRAY,
+			MAP,
 			PATTERN,
 			FUNCTION,
 			ACCESSOR,
 			STRING,
+			INTERPOLATED_STRING,
 			TIME,
+			DURATION,
 			CLAUSE,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 		},
 	},
 
@@ -57,18 +68,31 @@ var validLexerStates = []lexerState{
 		isEOF:      true,
 		isNullable: true,
 		validNextKinds: []TokenKind{
+			LAMBDA,
 			COMPARATOR,
+			BETWEEN,
+			LIKE,
 			MODIFIER,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
+			ARRAY,
+			MAP,
 			STRING,
+			INTERPOLATED_STRING,
 			PATTERN,
 			TIME,
+			DURATION,
 			CLAUSE,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 			LOGICALOP,
 			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
 			SEPARATOR,
 		},
 	},
@@ -79,9 +103,16 @@ var validLexerStates = []lexerState{
 		validNextKinds: []TokenKind{
 			MODIFIER,
 			COMPARATOR,
+			BETWEEN,
+			LIKE,
 			LOGICALOP,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
 			SEPARATOR,
 		},
 	},
@@ -92,9 +123,36 @@ var validLexerStates = []lexerState{
 		validNextKinds: []TokenKind{
 			MODIFIER,
 			COMPARATOR,
+			BETWEEN,
+			LIKE,
 			LOGICALOP,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
+			SEPARATOR,
+		},
+	},
+	lexerState{
+		kind:       NULL,
+		isEOF:      true,
+		isNullable: true,
+		validNextKinds: []TokenKind{
+			MODIFIER,
+			COMPARATOR,
+			BETWEEN,
+			LIKE,
+			LOGICALOP,
+			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
 			SEPARATOR,
 		},
 	},
@@ -105,9 +163,16 @@ var validLexerStates = []lexerState{
 		validNextKinds: []TokenKind{
 			MODIFIER,
 			COMPARATOR,
+			BETWEEN,
+			LIKE,
 			LOGICALOP,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
 			SEPARATOR,
 		},
 	},
@@ -118,8 +183,52 @@ var validLexerStates = []lexerState{
 		validNextKinds: []TokenKind{
 			MODIFIER,
 			COMPARATOR,
+			BETWEEN,
+			LIKE,
+			LOGICALOP,
+			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			SEPARATOR,
+		},
+	},
+	lexerState{
+		kind:       DURATION,
+		isEOF:      true,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			MODIFIER,
+			COMPARATOR,
+			BETWEEN,
+			LIKE,
+			LOGICALOP,
+			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
+			SEPARATOR,
+		},
+	},
+	lexerState{
+		kind:       INTERPOLATED_STRING,
+		isEOF:      true,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			MODIFIER,
+			COMPARATOR,
+			BETWEEN,
+			LIKE,
 			LOGICALOP,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
 			SEPARATOR,
 		},
 	},
@@ -130,8 +239,12 @@ var validLexerStates = []lexerState{
 		validNextKinds: []TokenKind{
 			MODIFIER,
 			COMPARATOR,
+			BETWEEN,
+			LIKE,
 			LOGICALOP,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 			SEPARATOR,
 		},
 	},
@@ -141,11 +254,20 @@ var validLexerStates = []lexerState{
 		isNullable: false,
 		validNextKinds: []TokenKind{
 
+			LAMBDA,
+			INDEX,
 			MODIFIER,
 			COMPARATOR,
+			BETWEEN,
+			LIKE,
 			LOGICALOP,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
 			SEPARATOR,
 		},
 	},
@@ -158,12 +280,18 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			VARIABLE,
+			ARRAY,
+			MAP,
 			FUNCTION,
 			ACCESSOR,
 			STRING,
+			INTERPOLATED_STRING,
 			BOOLEAN,
+			NULL,
 			CLAUSE,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 		},
 	},
 	lexerState{
@@ -174,13 +302,70 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
+			ARRAY,
+			MAP,
 			FUNCTION,
 			ACCESSOR,
 			STRING,
+			INTERPOLATED_STRING,
 			TIME,
+			DURATION,
 			CLAUSE,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			PATTERN,
+		},
+	},
+	lexerState{
+		kind:       BETWEEN,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			PREFIX,
+			NUMERIC,
+			BOOLEAN,
+			NULL,
+			VARIABLE,
+			ARRAY,
+			MAP,
+			FUNCTION,
+			ACCESSOR,
+			STRING,
+			INTERPOLATED_STRING,
+			TIME,
+			DURATION,
+			CLAUSE,
+			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			PATTERN,
+		},
+	},
+	lexerState{
+		kind:       LIKE,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			PREFIX,
+			NUMERIC,
+			BOOLEAN,
+			NULL,
+			VARIABLE,
+			ARRAY,
+			MAP,
+			FUNCTION,
+			ACCESSOR,
+			STRING,
+			INTERPOLATED_STRING,
+			TIME,
+			DURATION,
+			CLAUSE,
+			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 			PATTERN,
 		},
 	},
@@ -192,13 +377,20 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
+			ARRAY,
+			MAP,
 			FUNCTION,
 			ACCESSOR,
 			STRING,
+			INTERPOLATED_STRING,
 			TIME,
+			DURATION,
 			CLAUSE,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 		},
 	},
 	lexerState{
@@ -208,11 +400,16 @@ var validLexerStates = []lexerState{
 		validNextKinds: []TokenKind{
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
+			ARRAY,
+			MAP,
 			FUNCTION,
 			ACCESSOR,
 			CLAUSE,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 		},
 	},
 	lexerState{
@@ -223,9 +420,58 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			STRING,
+			INTERPOLATED_STRING,
 			TIME,
+			DURATION,
 			VARIABLE,
+			ARRAY,
+			MAP,
+			FUNCTION,
+			ACCESSOR,
+			CLAUSE,
+			SEPARATOR,
+		},
+	},
+	lexerState{
+		kind:       NULL_COALESCE,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			PREFIX,
+			NUMERIC,
+			BOOLEAN,
+			NULL,
+			STRING,
+			INTERPOLATED_STRING,
+			TIME,
+			DURATION,
+			VARIABLE,
+			ARRAY,
+			MAP,
+			FUNCTION,
+			ACCESSOR,
+			CLAUSE,
+			SEPARATOR,
+		},
+	},
+	lexerState{
+		kind:       ELVIS,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			PREFIX,
+			NUMERIC,
+			BOOLEAN,
+			NULL,
+			STRING,
+			INTERPOLATED_STRING,
+			TIME,
+			DURATION,
+			VARIABLE,
+			ARRAY,
+			MAP,
 			FUNCTION,
 			ACCESSOR,
 			CLAUSE,
@@ -238,6 +484,15 @@ var validLexerStates = []lexerState{
 		isNullable: false,
 		validNextKinds: []TokenKind{
 			CLAUSE,
+			PIPELINE,
+		},
+	},
+	lexerState{
+		kind:       PIPELINE,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			FUNCTION,
 		},
 	},
 	lexerState{
@@ -246,11 +501,19 @@ var validLexerStates = []lexerState{
 		isNullable: false,
 		validNextKinds: []TokenKind{
 			CLAUSE,
+			INDEX,
 			MODIFIER,
 			COMPARATOR,
+			BETWEEN,
+			LIKE,
 			LOGICALOP,
 			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
 			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
 			SEPARATOR,
 		},
 	},
@@ -262,12 +525,151 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
+			STRING,
+			INTERPOLATED_STRING,
+			TIME,
+			DURATION,
+			VARIABLE,
+			ARRAY,
+			MAP,
+			FUNCTION,
+			ACCESSOR,
+			CLAUSE,
+		},
+	},
+	lexerState{
+		kind:       LAMBDA,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			PREFIX,
+			NUMERIC,
+			BOOLEAN,
+			NULL,
+			STRING,
+			INTERPOLATED_STRING,
+			TIME,
+			DURATION,
+			VARIABLE,
+			ARRAY,
+			MAP,
+			FUNCTION,
+			ACCESSOR,
+			CLAUSE,
+		},
+	},
+	lexerState{
+		kind:       INDEX,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			PREFIX,
+			NUMERIC,
+			STRING,
+		},
+	},
+	lexerState{
+		kind:       ARRAY,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			PREFIX,
+			NUMERIC,
+			BOOLEAN,
+			NULL,
 			STRING,
+			INTERPOLATED_STRING,
 			TIME,
+			DURATION,
 			VARIABLE,
 			FUNCTION,
 			ACCESSOR,
 			CLAUSE,
+			ARRAY,
+			MAP,
+			ARRAY_CLOSE,
+		},
+	},
+	lexerState{
+		kind:       ARRAY_CLOSE,
+		isEOF:      true,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			COMPARATOR,
+			BETWEEN,
+			LIKE,
+			LOGICALOP,
+			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
+			SEPARATOR,
+		},
+	},
+	lexerState{
+		kind:       MAP,
+		isEOF:      false,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			PREFIX,
+			NUMERIC,
+			BOOLEAN,
+			NULL,
+			STRING,
+			INTERPOLATED_STRING,
+			TIME,
+			DURATION,
+			VARIABLE,
+			FUNCTION,
+			ACCESSOR,
+			CLAUSE,
+			ARRAY,
+			MAP,
+			MAP_CLOSE,
+		},
+	},
+	lexerState{
+		kind:       MAP_CLOSE,
+		isEOF:      true,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			COMPARATOR,
+			BETWEEN,
+			LIKE,
+			LOGICALOP,
+			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
+			SEPARATOR,
+		},
+	},
+	lexerState{
+		kind:       INDEX_CLOSE,
+		isEOF:      true,
+		isNullable: false,
+		validNextKinds: []TokenKind{
+			INDEX,
+			MODIFIER,
+			COMPARATOR,
+			BETWEEN,
+			LIKE,
+			LOGICALOP,
+			CLAUSE_CLOSE,
+			ARRAY_CLOSE,
+			MAP_CLOSE,
+			TERNARY,
+			NULL_COALESCE,
+			ELVIS,
+			PIPELINE,
+			SEPARATOR,
 		},
 	},
 }
@@ -298,16 +700,16 @@ func checkExpressionSyntax(tokens []ExpressionToken) error {
 
 			// call out a specific error for tokens looking like they want to be functions.
 			if lastToken.Kind == VARIABLE && token.Kind == CLAUSE {
-				return errors.New("Undefined function " + lastToken.Value.(string))
+				return tokenError(lastToken, "Undefined function "+lastToken.Value.(string))
 			}
 
 			firstStateName := fmt.Sprintf("%s [%v]", state.kind.String(), lastToken.Value)
 			nextStateName := fmt.Sprintf("%s [%v]", token.Kind.String(), token.Value)
 
-			return errors.New("Cannot transition token types from " + firstStateName + " to " + nextStateName)
+			return tokenError(token, "Cannot transition token types from "+firstStateName+" to "+nextStateName)
 		}
 
-		state, err = getLexerStateForToken(token.Kind)
+		state, err = getLexerStateForToken(token)
 		if err != nil {
 			return err
 		}
@@ -315,27 +717,30 @@ func checkExpressionSyntax(tokens []ExpressionToken) error {
 		if !state.isNullable && token.Value == nil {
 
 			errorMsg := fmt.Sprintf("Token kind '%v' cannot have a nil value", token.Kind.String())
-			return errors.New(errorMsg)
+			return tokenError(token, errorMsg)
 		}
 
 		lastToken = token
 	}
 
 	if !state.isEOF {
-		return errors.New("Unexpected end of expression")
+		return tokenError(endOf(tokens), "Unexpected end of expression")
 	}
 	return nil
 }
 
-func getLexerStateForToken(kind TokenKind) (lexerState, error) {
+/*
+Returns the lexer state for the kind of [token], or a ParseError spanning the token if there is none.
+*/
+func getLexerStateForToken(token ExpressionToken) (lexerState, error) {
 
 	for _, possibleState := range validLexerStates {
 
-		if possibleState.kind == kind {
+		if possibleState.kind == token.Kind {
 			return possibleState, nil
 		}
 	}
 
-	errorMsg := fmt.Sprintf("No lexer state found for token kind '%v'\n", kind.String())
-	return validLexerStates[0], errors.New(errorMsg)
+	errorMsg := fmt.Sprintf("No lexer state found for token kind '%v'", token.Kind.String())
+	return validLexerStates[0], tokenError(token, errorMsg)
 }
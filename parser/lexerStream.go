@@ -1,33 +1,246 @@
 package parser
 
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
 type lexerStream struct {
 	source   []rune
 	position int
 	length   int
+
+	// offsets at which each line of the source begins, the first always being 0
+	lineStarts []int
+
+	// the same offsets counted in UTF-8 bytes and in UTF-16 code units, from the start of the whole input
+	lineBytes []int
+	lineUTF16 []int
+
+	// number of lines which came before the source, when it is only a window onto a longer input
+	skippedLines int
+
+	// total length of everything appended so far, in UTF-8 bytes and in UTF-16 code units
+	bytes int
+	utf16 int
+
+	// the last position converted by offsets, so that converting positions in order doesn't rescan each line
+	cursor streamOffsets
+
+	// kinds of the currently open square brackets (INDEX or ARRAY), innermost last
+	brackets []TokenKind
+
+	// reused by readUntilFalse to collect the characters of each token, so that reading one doesn't allocate a buffer
+	scratch []rune
+}
+
+/*
+A position in the stream, along with the same position in UTF-8 bytes and UTF-16 code units.
+*/
+type streamOffsets struct {
+	position int
+	bytes    int
+	utf16    int
 }
 
 func newLexerStream(source string) *lexerStream {
 	var ret *lexerStream
-	var runes []rune
-
-	for _, character := range source {
-		runes = append(runes, character)
-	}
 
 	ret = new(lexerStream)
-	ret.source = runes
-	ret.length = len(runes)
+	ret.source = make([]rune, 0, utf8.RuneCountInString(source))
+	ret.lineStarts = []int{0}
+	ret.lineBytes = []int{0}
+	ret.lineUTF16 = []int{0}
+	ret.append(source)
+
+	// skip a leading byte order mark, keeping positions relative to the original source
+	if ret.length > 0 && ret.source[0] == '\uFEFF' {
+		ret.position = 1
+	}
 	return ret
 }
 
+/*
+Returns the next character and advances the stream.
+At the end of the stream this returns 0 and leaves the position where it is.
+*/
 func (s *lexerStream) readCharacter() rune {
+	if !s.canRead() {
+		return 0
+	}
+
 	character := s.source[s.position]
 	s.position += 1
 	return character
 }
 
+/*
+Moves the stream back by [amount] characters (or forward, if negative),
+never leaving the bounds of the source.
+*/
 func (s *lexerStream) rewind(amount int) {
 	s.position -= amount
+
+	if s.position < 0 {
+		s.position = 0
+	}
+	if s.position > s.length {
+		s.position = s.length
+	}
+}
+
+/*
+Records an opening square bracket of the given [kind].
+*/
+func (s *lexerStream) openBracket(kind TokenKind) {
+	s.brackets = append(s.brackets, kind)
+}
+
+/*
+Returns the token kind which closes the innermost open square bracket.
+*/
+func (s *lexerStream) closeBracket() TokenKind {
+	if len(s.brackets) == 0 {
+		return INDEX_CLOSE
+	}
+
+	kind := s.brackets[len(s.brackets)-1]
+	s.brackets = s.brackets[:len(s.brackets)-1]
+
+	if kind == ARRAY {
+		return ARRAY_CLOSE
+	}
+	return INDEX_CLOSE
+}
+
+/*
+Appends more [text] to the end of the source, for when it is read a piece at a time.
+*/
+func (s *lexerStream) append(text string) {
+
+	for len(text) > 0 {
+
+		character, width := utf8.DecodeRuneInString(text)
+		text = text[width:]
+
+		s.source = append(s.source, character)
+		s.bytes += width
+		s.utf16 += utf16Length(character)
+
+		if character == '\n' {
+			s.lineStarts = append(s.lineStarts, len(s.source))
+			s.lineBytes = append(s.lineBytes, s.bytes)
+			s.lineUTF16 = append(s.lineUTF16, s.utf16)
+		}
+	}
+	s.length = len(s.source)
+}
+
+/*
+Drops every line of the source before the one containing [position], keeping the line counts of what is left.
+Returns how many characters were dropped; positions within the stream move back by that much.
+*/
+func (s *lexerStream) discardLinesBefore(position int) int {
+
+	line := s.lineIndex(position)
+	if line == 0 {
+		return 0
+	}
+
+	count := s.lineStarts[line]
+	s.source = append(s.source[:0], s.source[count:]...)
+	s.length = len(s.source)
+	s.position -= count
+	s.skippedLines += line
+
+	lineStarts := s.lineStarts[:0]
+	for _, start := range s.lineStarts[line:] {
+		lineStarts = append(lineStarts, start-count)
+	}
+	s.lineStarts = lineStarts
+	s.lineBytes = append(s.lineBytes[:0], s.lineBytes[line:]...)
+	s.lineUTF16 = append(s.lineUTF16[:0], s.lineUTF16[line:]...)
+	s.cursor = streamOffsets{}
+
+	return count
+}
+
+/*
+Returns the index into lineStarts of the line containing the given [position].
+*/
+func (s *lexerStream) lineIndex(position int) int {
+
+	return sort.Search(len(s.lineStarts), func(i int) bool {
+		return s.lineStarts[i] > position
+	}) - 1
+}
+
+/*
+Fills in the Line, Column, and the byte and UTF-16 offsets of the [token] from its Start and End.
+*/
+func (s *lexerStream) locate(token *ExpressionToken) {
+
+	token.Line, token.Column = s.lineColumn(token.Start)
+	token.StartByte, token.StartUTF16 = s.offsets(token.Start)
+	token.EndByte, token.EndUTF16 = s.offsets(token.End)
+}
+
+/*
+Converts the given [position] (in characters) to an offset in UTF-8 bytes and one in UTF-16 code units,
+both from the start of the whole input. Invalid UTF-8 in the input counts as the replacement character it was read as.
+*/
+func (s *lexerStream) offsets(position int) (int, int) {
+
+	position = min(max(position, 0), s.length)
+	line := s.lineIndex(position)
+
+	from := streamOffsets{position: s.lineStarts[line], bytes: s.lineBytes[line], utf16: s.lineUTF16[line]}
+	if s.cursor.position > from.position && s.cursor.position <= position {
+		from = s.cursor
+	}
+
+	for i := from.position; i < position; i++ {
+		from.bytes += utf8.RuneLen(s.source[i])
+		from.utf16 += utf16Length(s.source[i])
+	}
+	from.position = position
+
+	s.cursor = from
+	return from.bytes, from.utf16
+}
+
+func utf16Length(character rune) int {
+
+	if character >= 0x10000 && character <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+/*
+Returns the line and column of the given [position] within the source, both counted from 1.
+Columns count characters, so a tab or a multi-byte character is a single column.
+*/
+func (s *lexerStream) lineColumn(position int) (int, int) {
+
+	line := s.lineIndex(position)
+	return s.skippedLines + line + 1, position - s.lineStarts[line] + 1
+}
+
+/*
+Returns the full line of the source containing the given [position], without its line break.
+*/
+func (s *lexerStream) lineAt(position int) string {
+
+	line := s.lineIndex(position)
+
+	start := s.lineStarts[line]
+	end := s.length
+	if line+1 < len(s.lineStarts) {
+		end = s.lineStarts[line+1] - 1
+	}
+	return strings.TrimSuffix(string(s.source[start:end]), "\r")
 }
 
 func (s lexerStream) canRead() bool {
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+/*
+LikeToRegexp converts a SQL LIKE pattern into an equivalent anchored regular expression.
+'%' matches any run of characters (including none), '_' matches exactly one character,
+and a backslash escapes the character after it, which must be '%', '_' or another backslash.
+*/
+func LikeToRegexp(pattern string) (*regexp.Regexp, error) {
+
+	var sb strings.Builder
+	var escaped bool
+
+	sb.WriteString("(?s)^")
+
+	for _, character := range pattern {
+
+		if escaped {
+			if character != '%' && character != '_' && character != '\\' {
+				return nil, errors.New("invalid escape '\\" + string(character) + "' in LIKE pattern; only '%', '_' and '\\' can be escaped")
+			}
+			sb.WriteString(regexp.QuoteMeta(string(character)))
+			escaped = false
+			continue
+		}
+
+		switch character {
+		case '\\':
+			escaped = true
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(character)))
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("LIKE pattern ends with an unfinished escape")
+	}
+
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
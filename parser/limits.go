@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"fmt"
+)
+
+// The limits which a LimitExceededError can report.
+const (
+	LIMIT_LENGTH = "length"
+	LIMIT_TOKENS = "tokens"
+	LIMIT_DEPTH  = "depth"
+)
+
+/*
+Returned when an expression goes over one of the limits set in ParserOptions or ASTOptions.
+The embedded ParseError gives the position at which the limit was passed.
+*/
+type LimitExceededError struct {
+	ParseError
+
+	// which limit was exceeded: LIMIT_LENGTH, LIMIT_TOKENS or LIMIT_DEPTH
+	Limit string
+
+	// the configured maximum
+	Max int
+}
+
+func newLimitExceededError(limit string, max int, start int, end int) *LimitExceededError {
+
+	var msg string
+	switch limit {
+	case LIMIT_LENGTH:
+		msg = fmt.Sprintf("Expression is longer than the limit of %d characters", max)
+	case LIMIT_TOKENS:
+		msg = fmt.Sprintf("Expression has more than the limit of %d tokens", max)
+	case LIMIT_DEPTH:
+		msg = fmt.Sprintf("Expression is nested deeper than the limit of %d levels", max)
+	}
+
+	return &LimitExceededError{
+		ParseError: ParseError{Msg: msg, Start: start, End: end},
+		Limit:      limit,
+		Max:        max,
+	}
+}
+
+/*
+Checks the length of the source in the [stream] against options.MaxLength, counting the characters before it too.
+*/
+func checkLength(stream *lexerStream, before int, options ParserOptions) error {
+
+	if options.MaxLength <= 0 || before+stream.length <= options.MaxLength {
+		return nil
+	}
+
+	err := newLimitExceededError(LIMIT_LENGTH, options.MaxLength, options.MaxLength-before, stream.length)
+	err.locate(stream)
+	return err
+}
+
+/*
+Counts tokens and their nesting as they are read, checking them against options.MaxTokens and options.MaxDepth.
+*/
+type limitCounter struct {
+	tokens int
+	depth  int
+}
+
+func (c *limitCounter) add(token ExpressionToken, stream *lexerStream, options ParserOptions) error {
+
+	c.tokens++
+	if options.MaxTokens > 0 && c.tokens > options.MaxTokens {
+		err := newLimitExceededError(LIMIT_TOKENS, options.MaxTokens, token.Start, token.End)
+		err.locate(stream)
+		return err
+	}
+
+	switch token.Kind {
+	case CLAUSE, INDEX, ARRAY, MAP:
+		c.depth++
+	case CLAUSE_CLOSE, INDEX_CLOSE, ARRAY_CLOSE, MAP_CLOSE:
+		c.depth--
+	}
+
+	if options.MaxDepth > 0 && c.depth > options.MaxDepth {
+		err := newLimitExceededError(LIMIT_DEPTH, options.MaxDepth, token.Start, token.End)
+		err.locate(stream)
+		return err
+	}
+	return nil
+}
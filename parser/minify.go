@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+Generates the code for the tree in as few characters as parse back into it, for GenerateOptions.Minify:
+on one line, without comments, with only the parentheses the grouping needs,
+and with whitespace only between tokens which would otherwise run together, such as a name and a textual operator.
+Variables are written bare where their name reads back as the same variable.
+*/
+func (ast *ASTNode) minify(options GenerateOptions) string {
+
+	tree := withoutRedundantParentheses(withoutComments(ast.Clone()), options.KeepPipelines)
+
+	options.Minify = false
+	options.Parentheses = PARENTHESES_AS_WRITTEN
+	options.flat = true
+	options.maxWidth = -1
+	flat := tree.GenerateWithOptions(options)
+
+	functions := map[string]ExpressionFunction{}
+	collectFunctions(ast, functions)
+	parserOptions := ParserOptions{Functions: functions}
+
+	tokens, err := ParseTokensWithOptions(flat, parserOptions)
+	if err != nil {
+		return flat
+	}
+
+	var sb strings.Builder
+	for _, token := range tokens {
+
+		text := tokenText(token)
+		if token.Kind == VARIABLE && isBareName(token.Raw, parserOptions) {
+			text = token.Raw
+		}
+
+		if sb.Len() > 0 && runTogether(lastRune(sb.String()), getFirstRune(text)) {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(text)
+	}
+
+	// the spacing rules are a heuristic of how the lexer splits tokens, so the result is checked by parsing it back
+	ret := sb.String()
+	reparsed, err := parseAST(ret, parserOptions)
+	if err != nil || !equalIgnoringParentheses(ast, reparsed) {
+		return flat
+	}
+	return ret
+}
+
+/*
+Removes the comments of [tree] and of each node within it.
+*/
+func withoutComments(tree *ASTNode) *ASTNode {
+
+	tree.Comments = nil
+	for _, child := range tree.Children {
+		withoutComments(child)
+	}
+	return tree
+}
+
+/*
+Removes the parentheses of [tree], for PARENTHESES_MINIMAL and Minify, then adds back those its grouping needs.
+Kept are the parentheses around the list on the right of 'in', which make it a list,
+and those between two prefix operators, which would otherwise run together as in --x.
+The comments of removed parentheses are moved to what they held.
+Calls written as pipelines are written as calls, and grouped as such, unless [keepPipelines] is set.
+*/
+func withoutRedundantParentheses(tree *ASTNode, keepPipelines bool) *ASTNode {
+
+	var strip func(tree *ASTNode) *ASTNode
+	strip = func(tree *ASTNode) *ASTNode {
+
+		tree.Piped = tree.Piped && keepPipelines
+
+		for i, child := range tree.Children {
+			child = strip(child)
+			isList := i == 1 && tree.Token.Kind == COMPARATOR && tree.Token.Symbol() == "in"
+			for !isList && child.Token.Kind == CLAUSE && len(child.Children) == 1 {
+				if tree.Token.Kind == PREFIX && child.Children[0].Token.Kind == PREFIX {
+					break
+				}
+				child = unwrapClause(child)
+			}
+			tree.Children[i] = child
+		}
+		return tree
+	}
+
+	tree = strip(tree)
+	for tree.Token.Kind == CLAUSE && len(tree.Children) == 1 {
+		tree = unwrapClause(tree)
+	}
+	return StandardizePrecedence(tree)
+}
+
+/*
+Returns what the parentheses of [clause] hold, with the comments of the parentheses around its own.
+*/
+func unwrapClause(clause *ASTNode) *ASTNode {
+
+	inner := clause.Children[0]
+	if len(clause.Comments) == 0 {
+		return inner
+	}
+
+	var leading, trailing []Comment
+	for _, comment := range clause.Comments {
+		if comment.Trailing {
+			trailing = append(trailing, comment)
+		} else {
+			leading = append(leading, comment)
+		}
+	}
+	comments := append(leading, inner.Comments...)
+	inner.Comments = append(comments, trailing...)
+	return inner
+}
+
+/*
+Reports whether [name] written without brackets lexes as a variable of that name.
+*/
+func isBareName(name string, options ParserOptions) bool {
+
+	if name == "" {
+		return false
+	}
+	tokens, err := ParseTokensWithOptions(name, options)
+	return err == nil && len(tokens) == 1 && tokens[0].Kind == VARIABLE && tokens[0].Raw == name
+}
+
+/*
+Reports whether a token ending with [previous] and one starting with [next] would be read as one if written together:
+two names, numbers or keywords, or two operators, such as '-' and '-'.
+*/
+func runTogether(previous rune, next rune) bool {
+
+	isWord := func(character rune) bool {
+		return unicode.IsLetter(character) || unicode.IsDigit(character) || character == '_' || character == '.' || character == '$'
+	}
+	isOperator := func(character rune) bool {
+		return !isWord(character) && !unicode.IsSpace(character) && !strings.ContainsRune("()[]{},'\"`", character)
+	}
+
+	return (isWord(previous) && isWord(next)) || (isOperator(previous) && isOperator(next))
+}
+
+func lastRune(text string) rune {
+	character, _ := utf8.DecodeLastRuneInString(text)
+	return character
+}
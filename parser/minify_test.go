@@ -0,0 +1,50 @@
+package parser
+
+import "testing"
+
+func TestMinify(t *testing.T) {
+
+	options := ParserOptions{Functions: map[string]ExpressionFunction{"f": {Name: "f"}}}
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"(a * b) + c", "a*b+c"},
+		{"(a + b) * c", "(a+b)*c"},
+		{"a - (b - c)", "a-(b-c)"},
+		{"a && b || c", "a&&b||c"},
+		{"(-x) ** 2", "-x**2"},
+		{"a ?? (b ? c : d)", "a??b?c:d"},
+		{"[x] in (1, 2) && y", "x in(1,2)&&y"},
+		{"[my var] > 1 /* c */", "[my var]>1"},
+		{"[a.b] == 1", "[a.b]==1"},
+		{"'a' + 'b'", "'a'+'b'"},
+		{"f(x, y: 2)", "f(x,y:2)"},
+
+		// tokens which would run together are kept apart
+		{"a - -b", "a- -b"},
+		{"- (-x)", "-(-x)"},
+	}
+
+	for _, test := range tests {
+		tree, err := parseAST(test.expression, options)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		minified := tree.GenerateWithOptions(GenerateOptions{Minify: true})
+		if minified != test.want {
+			t.Errorf("%q minifies to %q, want %q", test.expression, minified, test.want)
+		}
+
+		reparsed, err := parseAST(minified, options)
+		if err != nil {
+			t.Errorf("%q minifies to %q, which doesn't parse: %v", test.expression, minified, err)
+			continue
+		}
+		if !equalIgnoringParentheses(tree, reparsed) {
+			t.Errorf("%q minifies to %q, which parses into a different tree", test.expression, minified)
+		}
+	}
+}
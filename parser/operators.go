@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"fmt"
+	"unicode"
+)
+
+/*
+Describes an operator added with RegisterOperator, such as a textual 'within' or a symbolic '<=>'.
+*/
+type Operator struct {
+
+	// The operator as written in expressions. Either a name made of letters, digits and '_' (starting with a letter),
+	// or a run of symbol characters, such as '<=>'.
+	Symbol string
+
+	// What kind of token the operator is lexed as: COMPARATOR, LOGICALOP, MODIFIER, or PREFIX for unary operators.
+	// Infix operators may appear wherever an operator of the same kind may.
+	Kind TokenKind
+
+	// The binding level of an infix operator, one of the PRECEDENCE_ constants. Ignored for PREFIX operators,
+	// which always bind to the operand directly after them.
+	Precedence int
+
+	// Whether an infix operator groups from the right, so that 'a op b op c' parses as 'a op (b op c)'.
+	RightAssoc bool
+}
+
+// operators added with RegisterOperator, keyed by symbol
+var customOperators = map[string]Operator{}
+
+// names which already mean something else to the lexer, and so can't be registered as operators
+var reservedOperatorSymbols = map[string]bool{
+	"true": true, "false": true, "nil": true, "null": true,
+	"in": true, "IN": true, "between": true, "BETWEEN": true, "like": true, "LIKE": true,
+	"->": true, "=": true, "?": true, ":": true,
+}
+
+/*
+RegisterOperator adds a new operator to the lexer and the Parser, for every expression parsed afterwards.
+Operators can't be removed, and can't replace a built-in operator or one registered before.
+
+RegisterOperator is meant to be called while the program starts up (such as from an init function);
+it must not be called while other goroutines are parsing.
+*/
+func RegisterOperator(operator Operator) error {
+
+	symbol := operator.Symbol
+
+	if !isOperatorName(symbol) && !isOperatorSymbol(symbol) {
+		return fmt.Errorf("invalid operator symbol '%s': must be a name or a run of symbol characters", symbol)
+	}
+
+	if _, found := customOperators[symbol]; found || isBuiltinOperator(symbol) {
+		return fmt.Errorf("operator '%s' is already defined", symbol)
+	}
+
+	var symbols map[string]OperatorSymbol
+
+	switch operator.Kind {
+	case COMPARATOR:
+		symbols = comparatorSymbols
+	case LOGICALOP:
+		symbols = logicalSymbols
+	case MODIFIER:
+		symbols = modifierSymbols
+	case PREFIX:
+		symbols = prefixSymbols
+	default:
+		return fmt.Errorf("operator '%s' must be a COMPARATOR, LOGICALOP, MODIFIER or PREFIX, not %s", symbol, operator.Kind)
+	}
+
+	if operator.Kind != PREFIX && (operator.Precedence < PRECEDENCE_LOGICAL_OR || operator.Precedence > PRECEDENCE_EXPONENTIAL) {
+		return fmt.Errorf("operator '%s' has precedence %d, outside of the range %d to %d", symbol, operator.Precedence, PRECEDENCE_LOGICAL_OR, PRECEDENCE_EXPONENTIAL)
+	}
+
+	symbols[symbol] = CUSTOM
+	customOperators[symbol] = operator
+	return nil
+}
+
+/*
+Returns the operator registered for the given [token], if it is one.
+*/
+func customOperator(token *ExpressionToken) (Operator, bool) {
+
+	operator, found := customOperators[token.Symbol()]
+	return operator, found && operator.Kind == token.Kind
+}
+
+func isBuiltinOperator(symbol string) bool {
+
+	if reservedOperatorSymbols[symbol] {
+		return true
+	}
+	if _, found := textualLogicalSymbols[symbol]; found {
+		return true
+	}
+
+	for _, symbols := range []map[string]OperatorSymbol{
+		prefixSymbols, comparatorSymbols, logicalSymbols, modifierSymbols,
+		ternarySymbols, coalesceSymbols, elvisSymbols, pipelineSymbols,
+	} {
+		if _, found := symbols[symbol]; found {
+			return true
+		}
+	}
+	return false
+}
+
+func isOperatorName(symbol string) bool {
+
+	for i, character := range symbol {
+		if i == 0 && !unicode.IsLetter(character) {
+			return false
+		}
+		if !unicode.IsLetter(character) && !unicode.IsDigit(character) && character != '_' {
+			return false
+		}
+	}
+	return symbol != ""
+}
+
+func isOperatorSymbol(symbol string) bool {
+
+	for _, character := range symbol {
+		if !isNotAlphanumeric(character) || unicode.IsSpace(character) || character == ',' || character == '\\' {
+			return false
+		}
+	}
+	return symbol != ""
+}
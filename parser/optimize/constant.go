@@ -0,0 +1,98 @@
+/*
+Package optimize holds passes which simplify syntax trees without changing what they evaluate to,
+such as Fold, which evaluates the parts of an expression made only of constants.
+
+Passes take and return an ast.Node, and never change the tree they are given.
+The nodes they add in place of others have the span of the source they replace.
+*/
+package optimize
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+Returns a literal node for a constant [value] (a float64, int64, string, bool or nil),
+or false if it can't be written as one, like a NaN.
+A negative number is written as '-' applied to its magnitude, since that's how the lexer reads it back;
+where [parent] is an operator, that is wrapped in parentheses so that it isn't read as part of the operator.
+*/
+func literal(value interface{}, parent ast.Node) (ast.Node, bool) {
+
+	var token parser.ExpressionToken
+	negative := false
+
+	switch typed := value.(type) {
+	case nil:
+		token = parser.ExpressionToken{Kind: parser.NULL, Raw: "nil"}
+
+	case bool:
+		token = parser.ExpressionToken{Kind: parser.BOOLEAN, Value: typed, Raw: strconv.FormatBool(typed)}
+
+	case string:
+		token = parser.ExpressionToken{Kind: parser.STRING, Value: typed, Raw: typed}
+
+	case float64:
+		if math.IsNaN(typed) || math.IsInf(typed, 0) {
+			return nil, false
+		}
+		negative = math.Signbit(typed) && typed != 0
+		typed = math.Abs(typed)
+		token = parser.ExpressionToken{Kind: parser.NUMERIC, Value: typed, Raw: formatFloat(typed)}
+
+	case int64:
+		if typed == math.MinInt64 {
+			return nil, false
+		}
+		negative = typed < 0
+		if negative {
+			typed = -typed
+		}
+		token = parser.ExpressionToken{Kind: parser.NUMERIC, Value: typed, Raw: strconv.FormatInt(typed, 10)}
+
+	default:
+		return nil, false
+	}
+
+	ret, err := ast.New(token)
+	if err != nil || !negative {
+		return ret, err == nil
+	}
+
+	ret, err = ast.New(parser.ExpressionToken{Kind: parser.PREFIX, Value: "-", Raw: "-"}, ret)
+	if err != nil {
+		return nil, false
+	}
+
+	if parent == nil || !isOperator(parent.Kind()) {
+		return ret, true
+	}
+
+	ret, err = ast.New(parser.ExpressionToken{Kind: parser.CLAUSE, Value: '(', Raw: "("}, ret)
+	return ret, err == nil
+}
+
+/*
+Writes a float in plain notation where that is exact and short, and in exponent notation otherwise.
+*/
+func formatFloat(value float64) string {
+
+	if value == math.Trunc(value) && value < 1e21 {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func isOperator(kind parser.TokenKind) bool {
+
+	switch kind {
+	case parser.PREFIX, parser.MODIFIER, parser.COMPARATOR, parser.LOGICALOP, parser.NULL_COALESCE, parser.ELVIS,
+		parser.LIKE, parser.BETWEEN, parser.TERNARY, parser.INDEX:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,467 @@
+package optimize
+
+import (
+	"math"
+	"strings"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+A Function is the implementation of a function which Fold may call while optimizing.
+It must be pure: given the same arguments it returns the same result, and it has no side effects.
+*/
+type Function func(arguments ...interface{}) (interface{}, error)
+
+/*
+FoldOptions controls what Fold may evaluate.
+*/
+type FoldOptions struct {
+
+	// the pure functions which may be called on constant arguments, keyed by name;
+	// calls of any other function are left as they are
+	Functions map[string]Function
+}
+
+/*
+Fold evaluates the subtrees of [node] which are made only of constants, replacing each with its value,
+so that 2 * 60 becomes 120, 'a' + 'b' becomes 'ab', and len('abc'), if len is in options.Functions, becomes 3.
+
+Numbers are folded as the lexer reads them, as float64s, or as int64s with ParserOptions.PreserveIntegers;
+numbers of other types, values of different types, and operations whose result can't be written as a literal
+(such as division by zero) are left as they are. Calls of functions which return an error are left too,
+so that the error is raised when the expression is evaluated.
+*/
+func Fold(node ast.Node, options FoldOptions) (ast.Node, error) {
+
+	folder := folder{options: options, constants: map[ast.Node]constant{}}
+
+	return ast.Rewrite(node, func(node ast.Node) (ast.Node, bool) {
+
+		// the parentheses of a list, as in x in (1 + 1), can't be folded away
+		if isLiteral(node) || node.Kind() == parser.CLAUSE && isList(node) {
+			return node, false
+		}
+
+		value, ok := folder.evaluate(node)
+		if !ok {
+			return node, false
+		}
+
+		ret, ok := literal(value, node.Parent())
+		return ret, ok
+	})
+}
+
+type constant struct {
+	value interface{}
+	ok    bool
+}
+
+type folder struct {
+	options FoldOptions
+
+	// the value of each node evaluated so far, since Rewrite visits parents before their children
+	constants map[ast.Node]constant
+}
+
+/*
+Returns the constant value of [node], or false if it depends on something not known until evaluation.
+*/
+func (f *folder) evaluate(node ast.Node) (interface{}, bool) {
+
+	if known, found := f.constants[node]; found {
+		return known.value, known.ok
+	}
+
+	value, ok := f.evaluateNode(node)
+	f.constants[node] = constant{value: value, ok: ok}
+	return value, ok
+}
+
+func (f *folder) evaluateNode(node ast.Node) (interface{}, bool) {
+
+	token := node.Token()
+	children := node.Children()
+
+	switch node.Kind() {
+
+	case parser.NUMERIC:
+		switch token.Value.(type) {
+		case float64, int64:
+			return token.Value, true
+		}
+		return nil, false
+
+	case parser.STRING, parser.BOOLEAN:
+		return token.Value, true
+
+	case parser.NULL:
+		return nil, true
+
+	case parser.CLAUSE:
+		if len(children) != 1 {
+			return nil, false
+		}
+		return f.evaluate(children[0])
+
+	case parser.PREFIX:
+		operand, ok := f.evaluate(children[0])
+		if !ok {
+			return nil, false
+		}
+		return prefix(node.Token().Symbol(), operand)
+
+	case parser.MODIFIER, parser.COMPARATOR, parser.LOGICALOP:
+		if node.Token().Symbol() == "in" {
+			return f.in(children[0], children[1])
+		}
+
+		left, ok := f.evaluate(children[0])
+		if !ok {
+			return nil, false
+		}
+		right, ok := f.evaluate(children[1])
+		if !ok {
+			return nil, false
+		}
+		return binary(node.Token().Symbol(), left, right)
+
+	case parser.NULL_COALESCE:
+		left, ok := f.evaluate(children[0])
+		if !ok {
+			return nil, false
+		}
+		if left != nil {
+			return left, true
+		}
+		return f.evaluate(children[1])
+
+	case parser.TERNARY:
+		condition, ok := f.evaluate(children[0])
+		if !ok {
+			return nil, false
+		}
+		chosen, ok := condition.(bool)
+		if !ok {
+			return nil, false
+		}
+
+		// both branches must be constant, or the whole couldn't be written as a literal
+		yes, ok := f.evaluate(children[1])
+		if !ok {
+			return nil, false
+		}
+		no, ok := f.evaluate(children[2])
+		if !ok {
+			return nil, false
+		}
+		if chosen {
+			return yes, true
+		}
+		return no, true
+
+	case parser.FUNCTION:
+		return f.call(node)
+	}
+
+	return nil, false
+}
+
+/*
+Evaluates 'value in (list)' where the value and every element of the list are constants.
+*/
+func (f *folder) in(needle ast.Node, haystack ast.Node) (interface{}, bool) {
+
+	value, ok := f.evaluate(needle)
+	if !ok || haystack.Kind() != parser.ARRAY {
+		return nil, false
+	}
+
+	found := false
+	for _, element := range haystack.Children() {
+
+		candidate, ok := f.evaluate(element)
+		if !ok {
+			return nil, false
+		}
+		equal, ok := binary("==", value, candidate)
+		if !ok {
+			return nil, false
+		}
+		found = found || equal.(bool)
+	}
+	return found, true
+}
+
+/*
+Calls a function given in FoldOptions.Functions, if all of its arguments are constants passed by position.
+*/
+func (f *folder) call(node ast.Node) (interface{}, bool) {
+
+	function, found := f.options.Functions[node.Token().Raw]
+	if !found {
+		return nil, false
+	}
+
+	var arguments []interface{}
+	for _, child := range node.Children() {
+
+		if child.Kind() == parser.NAMED_ARGUMENT {
+			return nil, false
+		}
+
+		value, ok := f.evaluate(child)
+		if !ok {
+			return nil, false
+		}
+		arguments = append(arguments, value)
+	}
+
+	value, err := function(arguments...)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func prefix(operator string, operand interface{}) (interface{}, bool) {
+
+	switch value := operand.(type) {
+
+	case bool:
+		if operator == "!" {
+			return !value, true
+		}
+
+	case float64:
+		switch operator {
+		case "-":
+			return -value, true
+		case "~":
+			return float64(^int64(value)), true
+		}
+
+	case int64:
+		switch operator {
+		case "-":
+			if value == math.MinInt64 {
+				return nil, false
+			}
+			return -value, true
+		case "~":
+			return ^value, true
+		}
+	}
+	return nil, false
+}
+
+func binary(operator string, left interface{}, right interface{}) (interface{}, bool) {
+
+	switch l := left.(type) {
+
+	case float64:
+		if r, ok := right.(float64); ok {
+			return floatBinary(operator, l, r)
+		}
+
+	case int64:
+		if r, ok := right.(int64); ok {
+			return intBinary(operator, l, r)
+		}
+
+	case string:
+		if r, ok := right.(string); ok {
+			return stringBinary(operator, l, r)
+		}
+
+	case bool:
+		if r, ok := right.(bool); ok {
+			switch operator {
+			case "&&":
+				return l && r, true
+			case "||":
+				return l || r, true
+			case "==":
+				return l == r, true
+			case "!=":
+				return l != r, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func floatBinary(operator string, l float64, r float64) (interface{}, bool) {
+
+	switch operator {
+	case "+":
+		return l + r, true
+	case "-":
+		return l - r, true
+	case "*":
+		return l * r, true
+	case "/":
+		return l / r, true
+	case "%":
+		return math.Mod(l, r), true
+	case "**":
+		return math.Pow(l, r), true
+	case "&":
+		return float64(int64(l) & int64(r)), true
+	case "|":
+		return float64(int64(l) | int64(r)), true
+	case "^":
+		return float64(int64(l) ^ int64(r)), true
+	case "<<":
+		return float64(uint64(l) << uint64(r)), true
+	case ">>":
+		return float64(uint64(l) >> uint64(r)), true
+	}
+	if math.IsNaN(l) || math.IsNaN(r) {
+		return nil, false
+	}
+	if l < r {
+		return compare(operator, -1)
+	}
+	if l > r {
+		return compare(operator, 1)
+	}
+	return compare(operator, 0)
+}
+
+func intBinary(operator string, l int64, r int64) (interface{}, bool) {
+
+	switch operator {
+	case "+":
+		sum := l + r
+		return sum, (sum > l) == (r > 0)
+	case "-":
+		difference := l - r
+		return difference, (difference < l) == (r > 0)
+	case "*":
+		if l == 0 || r == 0 {
+			return int64(0), true
+		}
+		product := l * r
+		return product, product/r == l && !(l == -1 && r == math.MinInt64) && !(r == -1 && l == math.MinInt64)
+	case "/":
+		// only exact quotients, so that folding doesn't decide how integers divide
+		if r == 0 || l%r != 0 || l == math.MinInt64 && r == -1 {
+			return nil, false
+		}
+		return l / r, true
+	case "%":
+		if r == 0 || r == -1 {
+			return nil, false
+		}
+		return l % r, true
+	case "**":
+		// whole powers only, multiplied out so that overflow is caught
+		switch {
+		case r < 0:
+			return nil, false
+		case r == 0 || l == 1:
+			return int64(1), true
+		case l == 0:
+			return int64(0), true
+		case l == -1:
+			return 1 - 2*(r%2), true
+		}
+		// any other base overflows within 63 steps
+		power := int64(1)
+		for i := int64(0); i < r; i++ {
+			next, ok := intBinary("*", power, l)
+			if !ok {
+				return nil, false
+			}
+			power = next.(int64)
+		}
+		return power, true
+	case "&":
+		return l & r, true
+	case "|":
+		return l | r, true
+	case "^":
+		return l ^ r, true
+	case "<<", ">>":
+		if r < 0 || r > 63 {
+			return nil, false
+		}
+		if operator == "<<" {
+			return l << uint(r), true
+		}
+		return l >> uint(r), true
+	}
+	return compare(operator, cmpInt(l, r))
+}
+
+func stringBinary(operator string, l string, r string) (interface{}, bool) {
+
+	switch operator {
+	case "+":
+		return l + r, true
+	}
+	return compare(operator, strings.Compare(l, r))
+}
+
+/*
+Evaluates a comparison [operator] given how its operands compare: [order] is negative, zero or positive
+as the left is less than, equal to or greater than the right.
+*/
+func compare(operator string, order int) (interface{}, bool) {
+
+	switch operator {
+	case "==":
+		return order == 0, true
+	case "!=":
+		return order != 0, true
+	case ">":
+		return order > 0, true
+	case ">=":
+		return order >= 0, true
+	case "<":
+		return order < 0, true
+	case "<=":
+		return order <= 0, true
+	}
+	return nil, false
+}
+
+func cmpInt(l int64, r int64) int {
+
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+/*
+Reports whether [node] is already a literal, so that folding it would gain nothing.
+*/
+func isLiteral(node ast.Node) bool {
+
+	switch node.Kind() {
+	case parser.NUMERIC, parser.STRING, parser.BOOLEAN, parser.NULL:
+		return true
+	case parser.PREFIX:
+		return node.Token().Symbol() == "-" && node.Children()[0].Kind() == parser.NUMERIC
+	case parser.CLAUSE:
+		children := node.Children()
+		return len(children) == 1 && isLiteral(children[0])
+	}
+	return false
+}
+
+/*
+Reports whether [node] is the right operand of an 'in' comparison, which is a list even when written as (1).
+*/
+func isList(node ast.Node) bool {
+
+	parent := node.Parent()
+	return parent != nil && parent.Kind() == parser.COMPARATOR && parent.Token().Symbol() == "in" && parent.Children()[1] == node
+}
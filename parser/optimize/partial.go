@@ -0,0 +1,134 @@
+package optimize
+
+import (
+	"reflect"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+PartialEval substitutes the values of the [params] which are known ahead of evaluation into [node],
+then folds, prunes and simplifies what they make constant, returning the residual expression
+of what is still only known at evaluation. With region = 'eu',
+
+	region == 'eu' && amount > 100 ? 'review' : 'accept'
+
+becomes amount > 100 ? 'review' : 'accept'.
+
+Params are keyed by variable name, as the parameters of an evaluation are. An accessor such as env.Region is substituted
+when params["env"] is a map[string]interface{} holding Region; a variable which is the parameter of a lambda is never substituted.
+Numbers of any type are substituted as float64s, as the lexer reads them; values which can't be written as a literal,
+such as times, slices and structs, are left as the variables they were.
+
+The residual is made constant by Fold with [options] and has its dead branches removed by PruneBranches,
+over and over until there is no branch left to remove, then is simplified by Simplify,
+so it evaluates as the original expression would with the same params, as long as it's used as a condition.
+It is in this package rather than in ast since it builds on Fold and PruneBranches, which ast can't import.
+*/
+func PartialEval(node ast.Node, params map[string]interface{}, options FoldOptions) (ast.Node, error) {
+
+	if node == nil {
+		return nil, nil
+	}
+
+	ret, err := ast.Rewrite(node, func(node ast.Node) (ast.Node, bool) {
+
+		value, ok := paramValue(node, params)
+		if !ok {
+			return node, false
+		}
+		return literal(value, node.Parent())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// folding a condition may leave a branch dead, and removing it may leave something else to fold,
+	// such as the (true) && true left of ((true || x) && y) ? a : b with y = true, so both are repeated until nothing is pruned
+	for {
+		if ret, err = Fold(ret, options); err != nil {
+			return nil, err
+		}
+
+		var pruned []PrunedBranch
+		if ret, pruned, err = PruneBranches(ret); err != nil {
+			return nil, err
+		}
+		if len(pruned) == 0 {
+			break
+		}
+	}
+	return Simplify(ret)
+}
+
+/*
+Returns the value [node] has with the given [params], if it is a variable or accessor whose value is known.
+*/
+func paramValue(node ast.Node, params map[string]interface{}) (interface{}, bool) {
+
+	var segments []string
+
+	switch value := node.Token().Value.(type) {
+	case []string:
+		segments = value
+	case parser.OptionalAccessor:
+		segments = value.Segments
+	}
+
+	switch node.Kind() {
+	case parser.VARIABLE:
+		segments = []string{node.Token().Raw}
+	case parser.ACCESSOR:
+	default:
+		return nil, false
+	}
+
+	if len(segments) == 0 || node.Scope().Lookup(segments[0]) != nil {
+		return nil, false
+	}
+
+	value, found := params[segments[0]]
+	if !found {
+		return nil, false
+	}
+
+	for _, segment := range segments[1:] {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, found = fields[segment]; !found {
+			return nil, false
+		}
+	}
+
+	return literalValue(value)
+}
+
+/*
+Converts a param's [value] to one literal can write, turning numbers of any type into float64s
+and values of named string and bool types into plain ones.
+*/
+func literalValue(value interface{}) (interface{}, bool) {
+
+	switch typed := value.(type) {
+	case nil, bool, string, float64:
+		return typed, true
+	}
+
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(reflected.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(reflected.Uint()), true
+	case reflect.Float32:
+		return reflected.Float(), true
+	case reflect.String:
+		return reflected.String(), true
+	case reflect.Bool:
+		return reflected.Bool(), true
+	}
+	return nil, false
+}
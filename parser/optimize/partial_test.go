@@ -0,0 +1,40 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+func TestPartialEval(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		params     map[string]interface{}
+		want       string
+	}{
+		{"(true || x) ? a : b", nil, "[a]"},
+		{"(false && x) ? a : b", nil, "[b]"},
+		{"((true || x) && y) ? a : b", map[string]interface{}{"y": true}, "[a]"},
+		{"((true || x) && y) ? a : b", map[string]interface{}{"y": false}, "[b]"},
+		{"region == 'eu' && amount > 100 ? 'review' : 'accept'", map[string]interface{}{"region": "eu"}, "[amount] > 100 ? 'review' : 'accept'"},
+		{"region == 'eu' && amount > 100 ? 'review' : 'accept'", map[string]interface{}{"region": "us"}, "'accept'"},
+		{"env.Tier == 2 ? a : b", map[string]interface{}{"env": map[string]interface{}{"Tier": 2}}, "[a]"},
+		{"limit * 2 > amount", map[string]interface{}{"limit": int32(50)}, "100 > [amount]"},
+		{"a ? b : c", map[string]interface{}{"d": true}, "[a] ? [b] : [c]"},
+	}
+
+	for _, test := range tests {
+		residual, err := PartialEval(ast.FromParser(parse(t, test.expression)), test.params, FoldOptions{})
+		if err != nil {
+			t.Errorf("PartialEval(%q): %v", test.expression, err)
+			continue
+		}
+
+		generated := parser.Formatter{MaxWidth: -1}.Format(ast.ToParser(residual))
+		if generated != test.want {
+			t.Errorf("PartialEval(%q, %v) generates %q, want %q", test.expression, test.params, generated, test.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package optimize
+
+import (
+	"sort"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+PrunedBranch describes a branch removed by PruneBranches.
+*/
+type PrunedBranch struct {
+
+	// the branch which could never be evaluated, as it was in the tree given to PruneBranches
+	Branch ast.Node
+
+	// the constant which made it unreachable, such as the false condition of a ternary
+	Condition ast.Node
+}
+
+/*
+PruneBranches removes the branches of [node] which can never be evaluated because the condition guarding them is constant:
+
+  - a ternary with a boolean literal as its condition becomes the branch it selects: true ? a : b becomes a
+  - && and || whose left operand decides the result become it: false && a becomes false, true || a becomes true
+  - ?? whose left operand is a literal other than nil becomes it: 'x' ?? a becomes 'x'
+
+It returns the pruned tree along with the branches removed, in the order they appear in the source,
+leaving out those inside a branch which was itself removed.
+Constant conditions are usually the result of substituting known values and folding, as with Fold.
+*/
+func PruneBranches(node ast.Node) (ast.Node, []PrunedBranch, error) {
+
+	if node == nil {
+		return nil, nil, nil
+	}
+
+	var pruned []PrunedBranch
+
+	var prune func(node ast.Node) (ast.Node, bool)
+	prune = func(node ast.Node) (ast.Node, bool) {
+
+		if !hasCondition(node) {
+			return node, false
+		}
+
+		// the condition is pruned first, as removing its own dead branches may leave it constant: (true || x) ? a : b
+		before := len(pruned)
+		condition, err := ast.Rewrite(node.Children()[0], prune)
+		if err != nil {
+			return node, false
+		}
+
+		kept, removed, found := deadBranch(node, condition)
+		if !found {
+			// Rewrite goes on into the condition, and finds its dead branches again
+			pruned = pruned[:before]
+			return node, false
+		}
+
+		pruned = append(pruned, removed)
+		if kept == node.Children()[0] {
+			return condition, true
+		}
+
+		// the kept part may hold dead branches of its own
+		ret, err := ast.Rewrite(kept, prune)
+		if err != nil {
+			return node, false
+		}
+		return ret, true
+	}
+
+	ret, err := ast.Rewrite(node, prune)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a kept branch is searched after the branch removed beside it, which may come later in the source
+	sort.SliceStable(pruned, func(i, j int) bool {
+		return pruned[i].Branch.Pos() < pruned[j].Branch.Pos()
+	})
+
+	// a kept branch may need parentheses in its new place
+	ret = ast.FromParser(parser.StandardizePrecedence(ast.ToParser(ret)))
+	return ret, pruned, nil
+}
+
+/*
+Returns whether [node] is an operation whose first child decides which of the others are evaluated.
+*/
+func hasCondition(node ast.Node) bool {
+
+	switch node.Kind() {
+	case parser.TERNARY, parser.LOGICALOP, parser.NULL_COALESCE:
+		return len(node.Children()) >= 2
+	}
+	return false
+}
+
+/*
+Returns what is left of [node] once its dead branch is removed, and the branch removed,
+or false if it has no branch which can never be evaluated. The [condition] stands in for the first child of [node],
+which it is once its own dead branches are pruned; what is left is the first child itself when that is what is kept.
+*/
+func deadBranch(node ast.Node, condition ast.Node) (ast.Node, PrunedBranch, bool) {
+
+	children := node.Children()
+
+	switch node.Kind() {
+
+	case parser.TERNARY:
+		value, ok := booleanConstant(condition)
+		if !ok || len(children) != 3 {
+			break
+		}
+		if value {
+			return children[1], PrunedBranch{Branch: children[2], Condition: condition}, true
+		}
+		return children[2], PrunedBranch{Branch: children[1], Condition: condition}, true
+
+	case parser.LOGICALOP:
+		left, ok := booleanConstant(condition)
+		if !ok {
+			break
+		}
+		// false && a, true || a
+		if left == (node.Token().Symbol() == "||") {
+			return children[0], PrunedBranch{Branch: children[1], Condition: condition}, true
+		}
+
+	case parser.NULL_COALESCE:
+		left := unparenthesized(condition)
+		if isLiteral(left) && left.Kind() != parser.NULL {
+			return children[0], PrunedBranch{Branch: children[1], Condition: condition}, true
+		}
+	}
+
+	return nil, PrunedBranch{}, false
+}
+
+func booleanConstant(node ast.Node) (bool, bool) {
+
+	node = unparenthesized(node)
+	if node.Kind() != parser.BOOLEAN {
+		return false, false
+	}
+	value, ok := node.Token().Value.(bool)
+	return value, ok
+}
+
+func unparenthesized(node ast.Node) ast.Node {
+
+	for node.Kind() == parser.CLAUSE && len(node.Children()) == 1 {
+		node = node.Children()[0]
+	}
+	return node
+}
@@ -0,0 +1,51 @@
+package optimize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+func TestPruneBranches(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       string
+		branches   []string
+	}{
+		{"true ? a : b", "[a]", []string{"[b]"}},
+		{"false ? a : b", "[b]", []string{"[a]"}},
+		{"false && a", "false", []string{"[a]"}},
+		{"true || a", "true", []string{"[a]"}},
+		{"'x' ?? a", "'x'", []string{"[a]"}},
+		{"a ? b : c", "[a] ? [b] : [c]", nil},
+		{"(true || x) ? a : b", "[a]", []string{"[x]", "[b]"}},
+		{"(false && x) ? a : b", "[b]", []string{"[x]", "[a]"}},
+		{"((true || x) && y) ? a : b", "( ( true ) && [y] ) ? [a] : [b]", []string{"[x]"}},
+		{"true ? (false ? a : b) : c", "( [b] )", []string{"[a]", "[c]"}},
+		{"false ? (true ? a : b) : c", "[c]", []string{"( true ? [a] : [b] )"}},
+	}
+
+	for _, test := range tests {
+		pruned, branches, err := PruneBranches(ast.FromParser(parse(t, test.expression)))
+		if err != nil {
+			t.Errorf("PruneBranches(%q): %v", test.expression, err)
+			continue
+		}
+
+		generated := parser.Formatter{MaxWidth: -1}.Format(ast.ToParser(pruned))
+		if generated != test.want {
+			t.Errorf("PruneBranches(%q) generates %q, want %q", test.expression, generated, test.want)
+		}
+
+		var removed []string
+		for _, branch := range branches {
+			removed = append(removed, parser.Formatter{MaxWidth: -1}.Format(ast.ToParser(branch.Branch)))
+		}
+		if !reflect.DeepEqual(removed, test.branches) {
+			t.Errorf("PruneBranches(%q) removes %q, want %q", test.expression, removed, test.branches)
+		}
+	}
+}
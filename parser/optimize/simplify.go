@@ -0,0 +1,181 @@
+package optimize
+
+import (
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+Simplify rewrites the boolean logic of [node] into a simpler form which evaluates the same:
+
+  - double negations are removed: !(!(a)) becomes a
+  - negations are pushed inwards by De Morgan's laws: !(a && b) becomes !a || !b, and !(a || b) becomes !a && !b
+  - comparisons with a boolean literal are dropped: x == true and x != false become x, x == false and x != true become !x
+  - neutral operands are removed: a && true and a || false become a
+
+Comparisons with a boolean literal assume the other operand is a boolean, as it is wherever the expression is a condition;
+for any other value, x == true is false while x alone is not a boolean at all.
+Textual operators stay textual, so not (a and b) becomes not a or not b.
+
+Parentheses are added where the simplified tree needs them to keep its grouping, and removed from around single operands.
+*/
+func Simplify(node ast.Node) (ast.Node, error) {
+
+	if node == nil {
+		return nil, nil
+	}
+
+	tree := simplify(ast.ToParser(node))
+	ret := ast.FromParser(parser.StandardizePrecedence(tree))
+	return ret, ast.Validate(ret)
+}
+
+// the opposite of each logical operator, as written
+var dualOperators = map[string]string{
+	"&&":  "||",
+	"||":  "&&",
+	"and": "or",
+	"or":  "and",
+	"AND": "OR",
+	"OR":  "AND",
+}
+
+func simplify(tree *parser.ASTNode) *parser.ASTNode {
+
+	for i, child := range tree.Children {
+		child = simplify(child)
+
+		// parentheses left around a single operand once what they grouped has been simplified,
+		// except those of a list, as in x in (1), and those between two prefix operators, as in -(-x)
+		if child.Token.Kind == parser.CLAUSE && len(child.Children) == 1 && isOperand(child.Children[0]) &&
+			!isListOperand(tree, i) && !isNestedPrefix(tree, child.Children[0]) {
+			child = child.Children[0]
+		}
+		tree.Children[i] = child
+	}
+
+	switch tree.Token.Kind {
+
+	case parser.PREFIX:
+		if tree.Token.Symbol() != "!" {
+			break
+		}
+		operand := unparenthesize(tree.Children[0])
+
+		// !!a
+		if operand.Token.Kind == parser.PREFIX && operand.Token.Symbol() == "!" {
+			return unparenthesize(operand.Children[0])
+		}
+
+		// !(a && b), !(a || b)
+		if operand.Token.Kind == parser.LOGICALOP && len(operand.Children) == 2 {
+			if dual, found := dualOperators[operand.Token.Raw]; found {
+				token := *operand.Token
+				token.Raw = dual
+				token.Value = dualOperators[operand.Token.Symbol()]
+
+				ret := &parser.ASTNode{Token: &token, Children: []*parser.ASTNode{
+					simplify(negate(tree.Token, operand.Children[0])),
+					simplify(negate(tree.Token, operand.Children[1])),
+				}}
+				return ret
+			}
+		}
+
+	case parser.COMPARATOR:
+		operator := tree.Token.Symbol()
+		if operator != "==" && operator != "!=" {
+			break
+		}
+
+		for i, child := range tree.Children {
+			value, ok := booleanLiteral(child)
+			if !ok {
+				continue
+			}
+
+			other := tree.Children[1-i]
+			if value == (operator == "==") {
+				return unparenthesize(other)
+			}
+			return simplify(negate(&parser.ExpressionToken{Kind: parser.PREFIX, Value: "!", Raw: "!"}, other))
+		}
+
+	case parser.LOGICALOP:
+		// the neutral operand: true for &&, false for ||
+		neutral := tree.Token.Symbol() == "&&"
+		if !neutral && tree.Token.Symbol() != "||" {
+			break
+		}
+
+		for i, child := range tree.Children {
+			if value, ok := booleanLiteral(child); ok && value == neutral {
+				return unparenthesize(tree.Children[1-i])
+			}
+		}
+	}
+
+	return tree
+}
+
+/*
+Returns a negation of [operand] with a copy of the [prefix] token, so that it is written in the same style.
+An operand which is itself a prefix operation stays in parentheses.
+*/
+func negate(prefix *parser.ExpressionToken, operand *parser.ASTNode) *parser.ASTNode {
+
+	token := *prefix
+	operand = unparenthesize(operand)
+	if isNestedPrefix(&parser.ASTNode{Token: &token}, operand) {
+		operand = &parser.ASTNode{Token: &parser.ExpressionToken{Kind: parser.CLAUSE, Value: '(', Raw: "("}, Children: []*parser.ASTNode{operand}}
+	}
+	return &parser.ASTNode{Token: &token, Children: []*parser.ASTNode{operand}}
+}
+
+/*
+Returns the value of a boolean literal, looking through any parentheses around it.
+*/
+func booleanLiteral(tree *parser.ASTNode) (bool, bool) {
+
+	tree = unparenthesize(tree)
+	if tree.Token.Kind != parser.BOOLEAN {
+		return false, false
+	}
+	value, ok := tree.Token.Value.(bool)
+	return value, ok
+}
+
+/*
+Strips the parentheses around [tree]; StandardizePrecedence puts back those its new place needs.
+*/
+func unparenthesize(tree *parser.ASTNode) *parser.ASTNode {
+
+	for tree.Token.Kind == parser.CLAUSE && len(tree.Children) == 1 {
+		tree = tree.Children[0]
+	}
+	return tree
+}
+
+/*
+Reports whether [tree] needs no parentheses wherever it is placed, such as a variable, a call or a negation.
+*/
+func isOperand(tree *parser.ASTNode) bool {
+
+	kind := tree.Token.Kind
+	return kind == parser.PREFIX || !isOperator(kind) && kind != parser.LAMBDA && !tree.Piped
+}
+
+/*
+Reports whether [operand] is a prefix operation under the prefix operator [tree]. Written together without parentheses,
+the two operators would read as one, as in --x or !-x, which isn't a valid token.
+*/
+func isNestedPrefix(tree *parser.ASTNode, operand *parser.ASTNode) bool {
+	return tree.Token.Kind == parser.PREFIX && operand.Token.Kind == parser.PREFIX
+}
+
+/*
+Reports whether the [index]th child of [tree] is the list of an 'in' comparison.
+*/
+func isListOperand(tree *parser.ASTNode, index int) bool {
+	return index == 1 && tree.Token.Kind == parser.COMPARATOR && tree.Token.Symbol() == "in"
+}
@@ -0,0 +1,59 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+func parse(t *testing.T, expression string) *parser.ASTNode {
+	t.Helper()
+
+	tokens, err := parser.ParseTokens(expression, nil)
+	if err != nil {
+		t.Fatalf("ParseTokens(%q): %v", expression, err)
+	}
+	tree, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expression, err)
+	}
+	return tree
+}
+
+func TestSimplifyReparses(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"-(-x)", "-( -[x] )"},
+		{"-(-(1))", "-( -1 )"},
+		{"!(-x)", "!( -[x] )"},
+		{"-(!a)", "-( ![a] )"},
+		{"!(!a)", "[a]"},
+		{"!(!(-x))", "-[x]"},
+		{"(-x) == false", "!( -[x] )"},
+		{"!((-a) && b)", "!( -[a] ) || ![b]"},
+		{"!(a && b)", "![a] || ![b]"},
+		{"a && true", "[a]"},
+	}
+
+	for _, test := range tests {
+		simplified, err := Simplify(ast.FromParser(parse(t, test.expression)))
+		if err != nil {
+			t.Errorf("Simplify(%q): %v", test.expression, err)
+			continue
+		}
+
+		generated := parser.Formatter{MaxWidth: -1}.Format(ast.ToParser(simplified))
+		if generated != test.want {
+			t.Errorf("Simplify(%q) generates %q, want %q", test.expression, generated, test.want)
+		}
+
+		reparsed := parse(t, generated)
+		if !parser.Equal(reparsed, ast.ToParser(simplified)) {
+			t.Errorf("Simplify(%q) generates %q, which parses into a different tree", test.expression, generated)
+		}
+	}
+}
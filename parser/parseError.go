@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Represents an error encountered while tokenizing an expression.
+Start and End give the span of the offending text (as rune offsets), so that editors can highlight it.
+Line and Column give the position of Start, both counted from 1, and Snippet is the full source line
+containing it, so that diagnostics can be rendered without going back to the source.
+The byte and UTF-16 offsets give the same span as Start and End, in the same way as on ExpressionToken.
+*/
+type ParseError struct {
+	Msg   string
+	Start int
+	End   int
+
+	Line    int
+	Column  int
+	Snippet string
+
+	StartByte  int
+	EndByte    int
+	StartUTF16 int
+	EndUTF16   int
+}
+
+func (e *ParseError) Error() string {
+	return e.Msg
+}
+
+/*
+Returns [err] as a *ParseError (or *LimitExceededError) located within the source of the [stream].
+Other errors are wrapped in a *ParseError, taking the span from [start] and [end].
+*/
+func toParseError(err error, start int, end int, stream *lexerStream) error {
+
+	parseErr := parseErrorOf(err)
+	if parseErr == nil {
+		parseErr = &ParseError{Msg: err.Error(), Start: start, End: end}
+		err = parseErr
+	}
+
+	parseErr.locate(stream)
+	return err
+}
+
+/*
+Returns a ParseError spanning the given [token], taking its line, column and offsets from it.
+*/
+func tokenError(token ExpressionToken, msg string) *ParseError {
+
+	return &ParseError{
+		Msg:        msg,
+		Start:      token.Start,
+		End:        token.End,
+		Line:       token.Line,
+		Column:     token.Column,
+		StartByte:  token.StartByte,
+		EndByte:    token.EndByte,
+		StartUTF16: token.StartUTF16,
+		EndUTF16:   token.EndUTF16,
+	}
+}
+
+/*
+Returns an empty token just past the last of [tokens] which isn't a comment, for errors found at the end of an expression,
+or one at the start of the expression if there is none.
+*/
+func endOf(tokens []ExpressionToken) ExpressionToken {
+
+	i := len(tokens) - 1
+	for i >= 0 && tokens[i].Kind == COMMENT {
+		i--
+	}
+	if i < 0 {
+		return ExpressionToken{Line: 1, Column: 1}
+	}
+
+	last := tokens[i]
+
+	// a token with a line break in it, such as a string, ends on a later line; after the break, its source is
+	// the rest of its Raw text and its closing quote or bracket, unless escapes made it longer than that
+	line, column := last.Line, last.Column+last.End-last.Start
+	if breaks := strings.Count(last.Raw, "\n"); breaks > 0 {
+		line += breaks
+		column = utf8.RuneCountInString(last.Raw[strings.LastIndex(last.Raw, "\n")+1:]) + 2
+	}
+
+	return ExpressionToken{
+		Start:      last.End,
+		End:        last.End,
+		Line:       line,
+		Column:     column,
+		StartByte:  last.EndByte,
+		EndByte:    last.EndByte,
+		StartUTF16: last.EndUTF16,
+		EndUTF16:   last.EndUTF16,
+	}
+}
+
+/*
+Returns the ParseError held by [err], if it is a *ParseError or a *LimitExceededError, or nil otherwise.
+*/
+func parseErrorOf(err error) *ParseError {
+
+	switch typed := err.(type) {
+	case *ParseError:
+		return typed
+	case *LimitExceededError:
+		return &typed.ParseError
+	}
+	return nil
+}
+
+/*
+Fills in Line, Column and Snippet from the Start offset of the error within the source of the [stream].
+*/
+func (e *ParseError) locate(stream *lexerStream) {
+
+	start := min(max(e.Start, 0), stream.length)
+
+	e.Line, e.Column = stream.lineColumn(start)
+	e.Snippet = stream.lineAt(start)
+	e.StartByte, e.StartUTF16 = stream.offsets(e.Start)
+	e.EndByte, e.EndUTF16 = stream.offsets(e.End)
+}
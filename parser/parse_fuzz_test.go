@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+/*
+Reads a corpus of expressions from testdata: one Go-quoted expression per line,
+skipping blank lines and those starting with '#'.
+*/
+func readCorpus(tb testing.TB, name string) []string {
+	tb.Helper()
+
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+
+	var ret []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		expression, err := strconv.Unquote(text)
+		if err != nil {
+			tb.Fatalf("%s:%d: %v", name, line, err)
+		}
+		ret = append(ret, expression)
+	}
+	if err := scanner.Err(); err != nil {
+		tb.Fatal(err)
+	}
+	return ret
+}
+
+func FuzzParseTokens(f *testing.F) {
+
+	for _, expression := range readCorpus(f, "harden.txt") {
+		f.Add(expression)
+	}
+
+	f.Fuzz(func(t *testing.T, expression string) {
+
+		tokens, err := ParseTokens(expression, nil)
+		if err != nil {
+			return
+		}
+
+		length := utf8.RuneCountInString(expression)
+		for _, token := range tokens {
+			if token.Start < 0 || token.End < token.Start || token.End > length {
+				t.Fatalf("token %q of %q spans [%d, %d), outside of the expression", token.Raw, expression, token.Start, token.End)
+			}
+		}
+
+		// the Parser must reject what it can't parse with an error, never a panic
+		NewParser(tokens).Parse()
+	})
+}
@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 )
 
 func newASTNode(token *ExpressionToken) *ASTNode {
@@ -9,19 +11,70 @@ func newASTNode(token *ExpressionToken) *ASTNode {
 }
 
 type Parser struct {
-	tokens []ExpressionToken
-	pos    int
+	tokens  []ExpressionToken
+	pos     int
+	options ASTOptions
+	depth   int
+}
+
+// ASTOptions 控制语法树的构建，零值与 NewParser 的行为一致
+type ASTOptions struct {
+	// 覆盖运算符的优先级，table 中没有的运算符仍使用默认优先级
+	Precedence PrecedenceTable
+
+	// token 数量与语法树嵌套深度的上限，超出时返回 *LimitExceededError，0 表示不限制
+	MaxTokens int
+	MaxDepth  int
 }
 
 func NewParser(tokens []ExpressionToken) *Parser {
 	return &Parser{tokens: tokens, pos: 0}
 }
 
+// NewParserWithPrecedence 创建按 table 覆盖运算符优先级的 Parser，table 中没有的运算符仍使用默认优先级
+func NewParserWithPrecedence(tokens []ExpressionToken, table PrecedenceTable) *Parser {
+	return NewParserWithOptions(tokens, ASTOptions{Precedence: table})
+}
+
+func NewParserWithOptions(tokens []ExpressionToken, options ASTOptions) *Parser {
+	return &Parser{tokens: tokens, pos: 0, options: options}
+}
+
 func (p *Parser) Parse() (*ASTNode, error) {
-	return p.parseExpression(0)
+	// 与词法分析一致，注释不计入 token 数量
+	if p.options.MaxTokens > 0 {
+		count := 0
+		for i := range p.tokens {
+			if p.tokens[i].Kind == COMMENT {
+				continue
+			}
+			count++
+			if count > p.options.MaxTokens {
+				return nil, p.limitExceeded(LIMIT_TOKENS, p.options.MaxTokens, &p.tokens[i])
+			}
+		}
+	}
+
+	node, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := p.peek(); token != nil {
+		return nil, p.errorAt(token, "unexpected token %s", describeToken(token))
+	}
+
+	// 注释附着到相邻的节点上，使格式化与改写后注释仍在原处
+	attachComments(node, p.tokens)
+	return node, nil
 }
 
 func (p *Parser) parseExpression(precedence int) (*ASTNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
 	left, err := p.parsePrimaryExpression()
 	if err != nil {
 		return nil, err
@@ -35,16 +88,23 @@ func (p *Parser) parseExpression(precedence int) (*ASTNode, error) {
 
 		// log.Printf("parseExpression peek token: %s, start %d end %d\n", token.Raw, token.Start, token.End)
 
-		tokenPrecedence := p.getPrecedence(token)
-		if tokenPrecedence < precedence {
+		// ':' closes the true branch of a ternary, and is handled by parseTernary
+		if token.Kind == TERNARY && token.Raw == ":" {
 			break
 		}
 
-		if token.Kind == CLAUSE_CLOSE {
+		tokenPrecedence, rightAssoc, ok := p.precedenceOf(token)
+		if !ok || tokenPrecedence < precedence {
 			break
 		}
 
-		left, err = p.parseBinaryExpression(left, tokenPrecedence)
+		// left-associative operators only take tighter operators on their right-hand side
+		nextPrecedence := tokenPrecedence + 1
+		if rightAssoc {
+			nextPrecedence = tokenPrecedence
+		}
+
+		left, err = p.parseBinaryExpression(left, nextPrecedence)
 		if err != nil {
 			return nil, err
 		}
@@ -61,19 +121,33 @@ func (p *Parser) parseBinaryExpression(left *ASTNode, precedence int) (*ASTNode,
 	switch token.Kind {
 	case LOGICALOP:
 		return p.parseLogicalOp(left, precedence)
-	case COMPARATOR:
+	case COMPARATOR, LIKE:
 		return p.parseComparator(left, precedence)
+	case BETWEEN:
+		return p.parseBetween(left)
+	case MODIFIER:
+		return p.parseModifier(left, precedence)
+	case TERNARY:
+		return p.parseTernary(left, precedence)
+	case NULL_COALESCE, ELVIS:
+		return p.parseCoalesce(left, precedence)
+	case PIPELINE:
+		return p.parsePipeline(left)
 	default:
 		// node, err = p.parseExpression(precedence + 1)
 		// log.Fatalf("parseBinaryExpression unexpected token: %v", token)
-		return left, fmt.Errorf("parseBinaryExpression unexpected token: %v", token)
+		return left, p.errorAt(token, "unexpected token %s", describeToken(token))
 	}
 }
 
 func (p *Parser) parsePrimaryExpression() (*ASTNode, error) {
 	token := p.peek()
 	if token == nil {
-		return nil, fmt.Errorf("unexpected end of tokens")
+		return nil, p.errorAt(nil, "unexpected end of expression")
+	}
+
+	if p.isLambdaStart() {
+		return p.parseLambda()
 	}
 
 	// log.Printf("parsePrimaryExpression peek token: %s, kind %s, start %d, end %d\n", token.Raw, token.Kind.String(), token.Start, token.End)
@@ -85,33 +159,44 @@ func (p *Parser) parsePrimaryExpression() (*ASTNode, error) {
 		return p.parseNumeric()
 	case BOOLEAN:
 		return p.parseBoolean()
+	case NULL:
+		return p.parseNull()
 	case STRING:
 		return p.parseString()
+	case INTERPOLATED_STRING:
+		return p.parseInterpolatedString()
 	case PATTERN:
 		return p.parsePattern()
 	case TIME:
 		return p.parseTime()
+	case DURATION:
+		return p.parseDuration()
 	case VARIABLE:
 		return p.parseVariable()
 	case FUNCTION:
 		return p.parseFunction()
 	case ACCESSOR:
 		return p.parseAccessor()
-	case MODIFIER:
-		return p.parseModifier()
 	case CLAUSE:
 		return p.parseClause()
-	case TERNARY:
-		return p.parseTernary()
+	case ARRAY:
+		return p.parseArray()
+	case MAP:
+		return p.parseMap()
 	}
 
-	return nil, fmt.Errorf("unexpected token: %v", token)
+	return nil, p.errorAt(token, "unexpected token %s", describeToken(token))
 }
 
 func (p *Parser) parsePrefix() (*ASTNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
 	token := p.next()
-	if token.Kind != PREFIX {
-		return nil, fmt.Errorf("expected prefix token, got %v", token)
+	if token == nil || token.Kind != PREFIX {
+		return nil, p.errorAt(token, "expected a prefix operator, got %s", describeToken(token))
 	}
 
 	// log.Printf("parsePrefix peek token: %s, start %d end %d\n", token.Raw, token.Start, token.End)
@@ -136,10 +221,37 @@ func (p *Parser) parseBoolean() (*ASTNode, error) {
 	return p.parseToken(BOOLEAN)
 }
 
+func (p *Parser) parseNull() (*ASTNode, error) {
+	return p.parseToken(NULL)
+}
+
 func (p *Parser) parseString() (*ASTNode, error) {
 	return p.parseToken(STRING)
 }
 
+// 插值字符串中的每个 ${} 表达式单独解析，按出现顺序作为子节点
+func (p *Parser) parseInterpolatedString() (*ASTNode, error) {
+	token := p.next()
+	if token == nil || token.Kind != INTERPOLATED_STRING {
+		return nil, p.errorAt(token, "expected an interpolated string, got %s", describeToken(token))
+	}
+	value, ok := token.Value.(InterpolatedString)
+	if !ok {
+		return nil, p.errorAt(token, "expected an interpolated string, got %s", describeToken(token))
+	}
+
+	node := newASTNode(token)
+	for _, tokens := range value.Expressions {
+		child, err := NewParser(tokens).Parse()
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
 func (p *Parser) parsePattern() (*ASTNode, error) {
 	return p.parseToken(PATTERN)
 }
@@ -148,8 +260,47 @@ func (p *Parser) parseTime() (*ASTNode, error) {
 	return p.parseToken(TIME)
 }
 
+func (p *Parser) parseDuration() (*ASTNode, error) {
+	return p.parseToken(DURATION)
+}
+
 func (p *Parser) parseVariable() (*ASTNode, error) {
-	return p.parseToken(VARIABLE)
+	node, err := p.parseToken(VARIABLE)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseIndex(node)
+}
+
+// parseIndex 解析紧跟在变量或访问器后的下标访问，如 items[0]、matrix[1][2]、labels['env']
+// 下标必须是非负整数或字符串字面量，不支持 items[-1] 这样的负数下标
+func (p *Parser) parseIndex(container *ASTNode) (*ASTNode, error) {
+	for p.peekIs(INDEX) {
+		node := newASTNode(p.next()) // consume '['
+
+		key := p.peek()
+		if key == nil {
+			return nil, p.errorAt(nil, "unexpected end of expression in index access")
+		}
+		if key.Kind == PREFIX && key.Raw == "-" || key.Kind == NUMERIC && isNegativeValue(key.Value) {
+			return nil, p.errorAt(key, "negative index is not supported")
+		}
+		isIntegerKey := key.Kind == NUMERIC && isIntegerValue(key.Value)
+		if !isIntegerKey && key.Kind != STRING {
+			return nil, p.errorAt(key, "index must be a non-negative integer or a string, got %s", describeToken(key))
+		}
+		p.next()
+
+		if err := p.expectToken(INDEX_CLOSE); err != nil {
+			return nil, err
+		}
+
+		node.Children = append(node.Children, container, newASTNode(key))
+		container = node
+	}
+
+	return container, nil
 }
 
 func (p *Parser) parseFunction() (*ASTNode, error) {
@@ -168,6 +319,10 @@ func (p *Parser) parseFunction() (*ASTNode, error) {
 		return nil, err
 	}
 
+	// 参数保持书写顺序，只检查具名参数能否对应到声明的参数上
+	if _, err := bindArguments(node.Token, args); err != nil {
+		return nil, err
+	}
 	node.Children = append(node.Children, args...)
 
 	return node, nil
@@ -178,24 +333,24 @@ func (p *Parser) parseArguments() ([]*ASTNode, error) {
 
 	for {
 		if p.peek() == nil {
-			return nil, fmt.Errorf("unexpected end of tokens in function arguments")
+			return nil, p.errorAt(nil, "unexpected end of expression in function arguments")
 		}
 
 		// End of arguments list
-		if p.peek().Kind == CLAUSE_CLOSE {
+		if p.peekIs(CLAUSE_CLOSE) {
 			p.next() // consume ')'
 			break
 		}
 
 		// Parse individual argument
-		arg, err := p.parsePrimaryExpression()
+		arg, err := p.parseNamedArgument()
 		if err != nil {
 			return nil, err
 		}
 		args = append(args, arg)
 
 		// Arguments are separated by commas
-		if p.peek().Kind == SEPARATOR {
+		if p.peekIs(SEPARATOR) {
 			p.next() // Consume ','
 		}
 	}
@@ -203,41 +358,162 @@ func (p *Parser) parseArguments() ([]*ASTNode, error) {
 	return args, nil
 }
 
+// parseNamedArgument 解析一个参数，name: value 形式的具名参数解析为 NAMED_ARGUMENT 节点
+func (p *Parser) parseNamedArgument() (*ASTNode, error) {
+	token := p.peek()
+	if token.Kind != VARIABLE || !p.isFollowedBy(TERNARY, ":") {
+		return p.parseExpression(0)
+	}
+
+	p.next() // consume the name
+	p.next() // consume ':'
+
+	value, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	// 复制参数名的 token，保留它的位置信息
+	named := *token
+	named.Kind = NAMED_ARGUMENT
+	named.Value = token.Raw
+	node := newASTNode(&named)
+	node.Children = append(node.Children, value)
+	return node, nil
+}
+
+// isFollowedBy 判断下一个 token 之后紧跟的 token 是否是给定的类型和内容，注释会被跳过
+func (p *Parser) isFollowedBy(kind TokenKind, raw string) bool {
+	p.skipComments()
+	for i := p.pos + 1; i < len(p.tokens); i++ {
+		if p.tokens[i].Kind != COMMENT {
+			return p.tokens[i].Kind == kind && p.tokens[i].Raw == raw
+		}
+	}
+	return false
+}
+
+// bindArguments 按照函数声明的 Parameters 把具名参数排到对应的位置上，返回排好顺序的参数
+// 具名参数必须在所有位置参数之后；函数没有声明 Parameters 时保持书写顺序
+func bindArguments(function *ExpressionToken, args []*ASTNode) ([]*ASTNode, error) {
+	named := false
+	for _, arg := range args {
+		if arg.Token.Kind == NAMED_ARGUMENT {
+			named = true
+		} else if named {
+			return nil, tokenError(*arg.Token, fmt.Sprintf("positional argument after named argument in call to '%s'", function.Raw))
+		}
+	}
+
+	parameters := functionParameters(function)
+	if !named || len(parameters) == 0 {
+		return args, nil
+	}
+
+	slots := make([]*ASTNode, len(parameters))
+	for i, arg := range args {
+		index := i
+		if arg.Token.Kind == NAMED_ARGUMENT {
+			index = parameterIndex(parameters, arg.Token.Raw)
+			if index < 0 {
+				return nil, tokenError(*arg.Token, fmt.Sprintf("unknown parameter '%s' in call to '%s'", arg.Token.Raw, function.Raw))
+			}
+		}
+
+		if index >= len(slots) {
+			return nil, tokenError(*arg.Token, fmt.Sprintf("too many arguments in call to '%s'", function.Raw))
+		}
+		if slots[index] != nil {
+			return nil, tokenError(*arg.Token, fmt.Sprintf("duplicate argument for parameter '%s' in call to '%s'", parameters[index], function.Raw))
+		}
+		slots[index] = arg
+	}
+
+	var ret []*ASTNode
+	for _, slot := range slots {
+		if slot != nil {
+			ret = append(ret, slot)
+		}
+	}
+	return ret, nil
+}
+
+// withBoundArguments 把树中所有函数调用的具名参数按照 Parameters 排好顺序，AST 中的参数是书写顺序
+// 不能绑定的调用（如手工构造的树）保持原样
+func withBoundArguments(ast *ASTNode) *ASTNode {
+	if ast.Token != nil && ast.Token.Kind == FUNCTION {
+		if args, err := bindArguments(ast.Token, ast.Children); err == nil {
+			ast.Children = args
+		}
+	}
+	for _, child := range ast.Children {
+		if child != nil {
+			withBoundArguments(child)
+		}
+	}
+	return ast
+}
+
+func functionParameters(function *ExpressionToken) []string {
+	if value, ok := function.Value.(ExpressionFunction); ok {
+		return value.Parameters
+	}
+	return nil
+}
+
+func parameterIndex(parameters []string, name string) int {
+	for i, parameter := range parameters {
+		if parameter == name {
+			return i
+		}
+	}
+	return -1
+}
+
 func (p *Parser) parseAccessor() (*ASTNode, error) {
 	token := p.next()
-	if token.Kind != ACCESSOR {
-		return nil, fmt.Errorf("expected accessor token, got %v", token)
+	if token == nil || token.Kind != ACCESSOR {
+		return nil, p.errorAt(token, "expected an accessor, got %s", describeToken(token))
 	}
 
 	node := newASTNode(token)
 
+	// 紧跟括号的访问器是方法调用，改写为 METHOD 节点，参数作为子节点
 	ptoken := p.peek()
 	if ptoken != nil && ptoken.Kind == CLAUSE {
 		p.next()
-		if p.expectToken(CLAUSE_CLOSE) != nil {
-			return nil, fmt.Errorf("expected ')' to close accessor function")
+		args, err := p.parseArguments()
+		if err != nil {
+			return nil, err
 		}
-		node.Children = append(node.Children, newASTNode(ptoken))
+
+		method := *token
+		method.Kind = METHOD
+		method.End = ptoken.End
+		node = newASTNode(&method)
+		node.Children = append(node.Children, args...)
 	}
 
-	return node, nil
+	return p.parseIndex(node)
 }
 
+// parseComparator 解析比较运算，like 与普通比较运算的结构相同
 func (p *Parser) parseComparator(left *ASTNode, precedence int) (*ASTNode, error) {
-	node, err := p.parseToken(COMPARATOR)
+	node, err := p.parseToken(p.peek().Kind)
 	if err != nil {
 		return nil, err
 	}
 	node.Children = append(node.Children, left)
 
-	if p.peek().Kind == CLAUSE {
+	// 只有含逗号（或为空）的括号才是列表，如 x in (1, 2)；其余的括号是分组，之后还可以有运算，如 a == (b + c) * 2
+	if p.isListAhead() {
 		right, err := p.parseClauseOrArray()
 		if err != nil {
 			return nil, err
 		}
 		node.Children = append(node.Children, right)
 	} else {
-		right, err := p.parseExpression(precedence + 1)
+		right, err := p.parseExpression(precedence)
 		if err != nil {
 			return nil, err
 		}
@@ -247,6 +523,64 @@ func (p *Parser) parseComparator(left *ASTNode, precedence int) (*ASTNode, error
 	return node, nil
 }
 
+// isListAhead 判断下一个 token 是否开始一个列表：括号为空，或括号内的顶层有逗号
+func (p *Parser) isListAhead() bool {
+	if !p.peekIs(CLAUSE) {
+		return false
+	}
+
+	depth, empty := 0, true
+	for i := p.pos; i < len(p.tokens); i++ {
+		switch p.tokens[i].Kind {
+		case COMMENT:
+			continue
+		case CLAUSE, INDEX, ARRAY, MAP:
+			depth++
+		case CLAUSE_CLOSE, INDEX_CLOSE, ARRAY_CLOSE, MAP_CLOSE:
+			depth--
+			if depth == 0 {
+				return empty
+			}
+		case SEPARATOR:
+			if depth == 1 {
+				return true
+			}
+		}
+		empty = empty && i == p.pos
+	}
+	return false
+}
+
+// parseBetween 解析区间比较 x between low and high
+// 上下界只取比比较运算结合更紧的表达式，这样分隔上下界的 and 不会被当成逻辑运算
+func (p *Parser) parseBetween(left *ASTNode) (*ASTNode, error) {
+	node, err := p.parseToken(BETWEEN)
+	if err != nil {
+		return nil, err
+	}
+
+	level, _, _ := p.precedenceOf(node.Token)
+
+	low, err := p.parseExpression(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	separator := p.peek()
+	if separator == nil || separator.Kind != LOGICALOP || separator.Symbol() != "&&" {
+		return nil, p.errorAt(separator, "expected 'and' between the bounds of '%s', got %s", node.Token.Raw, describeToken(separator))
+	}
+	p.next()
+
+	high, err := p.parseExpression(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	node.Children = append(node.Children, left, low, high)
+	return node, nil
+}
+
 func (p *Parser) parseLogicalOp(left *ASTNode, precedence int) (*ASTNode, error) {
 	node, err := p.parseToken(LOGICALOP)
 	if err != nil {
@@ -255,7 +589,7 @@ func (p *Parser) parseLogicalOp(left *ASTNode, precedence int) (*ASTNode, error)
 
 	node.Children = append(node.Children, left)
 
-	right, err := p.parseExpression(precedence + 1)
+	right, err := p.parseExpression(precedence)
 	if err != nil {
 		return nil, err
 	}
@@ -264,31 +598,82 @@ func (p *Parser) parseLogicalOp(left *ASTNode, precedence int) (*ASTNode, error)
 	return node, nil
 }
 
-func (p *Parser) parseModifier() (*ASTNode, error) {
+func (p *Parser) parseModifier(left *ASTNode, precedence int) (*ASTNode, error) {
 	node, err := p.parseToken(MODIFIER)
 	if err != nil {
 		return nil, err
 	}
 
-	expr, err := p.parseExpression(0)
+	node.Children = append(node.Children, left)
+
+	right, err := p.parseExpression(precedence)
 	if err != nil {
 		return nil, err
 	}
-	node.Children = append(node.Children, expr)
+	node.Children = append(node.Children, right)
 
 	return node, nil
 }
 
-func (p *Parser) parseTernary() (*ASTNode, error) {
-	condition, err := p.parseExpression(0)
+// parseCoalesce 解析空值合并运算 a ?? b，left 为 nil 时取右侧的值
+// Elvis 运算 a ?: b 的结构与之相同，只是 left 为假值时就取右侧的值
+func (p *Parser) parseCoalesce(left *ASTNode, precedence int) (*ASTNode, error) {
+	node, err := p.parseToken(p.peek().Kind)
 	if err != nil {
 		return nil, err
 	}
 
-	if p.peek() == nil || p.peek().Kind != TERNARY || p.peek().Raw != "?" {
-		return nil, fmt.Errorf("expected '?' for ternary operator")
+	node.Children = append(node.Children, left)
+
+	right, err := p.parseExpression(precedence)
+	if err != nil {
+		return nil, err
+	}
+	node.Children = append(node.Children, right)
+
+	return node, nil
+}
+
+// parsePipeline 把管道 a |> f 改写为函数调用 f(a)，a |> f(b) 改写为 f(a, b)
+// 改写后的节点标记为 Piped，生成代码时可以选择保留管道形式
+func (p *Parser) parsePipeline(left *ASTNode) (*ASTNode, error) {
+	if _, err := p.parseToken(PIPELINE); err != nil {
+		return nil, err
+	}
+
+	target := p.peek()
+	if target == nil || target.Kind != FUNCTION {
+		return nil, p.errorAt(target, "expected a function after '|>', got %s", describeToken(target))
+	}
+
+	node := newASTNode(p.next())
+	node.Piped = true
+	args := []*ASTNode{left}
+
+	if next := p.peek(); next != nil && next.Kind == CLAUSE {
+		p.next() // consume '('
+		rest, err := p.parseArguments()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, rest...)
+	}
+
+	if _, err := bindArguments(node.Token, args); err != nil {
+		return nil, err
+	}
+	node.Children = append(node.Children, args...)
+
+	return node, nil
+}
+
+// parseTernary 解析以 condition 为条件的三元运算 a ? b : c
+func (p *Parser) parseTernary(condition *ASTNode, precedence int) (*ASTNode, error) {
+	token := p.next()
+
+	if token == nil || token.Raw != "?" {
+		return nil, p.errorAt(token, "expected '?' for ternary operator, got %s", describeToken(token))
 	}
-	p.next() // consume '?'
 
 	trueExpr, err := p.parseExpression(0)
 	if err != nil {
@@ -296,16 +681,19 @@ func (p *Parser) parseTernary() (*ASTNode, error) {
 	}
 
 	if p.peek() == nil || p.peek().Kind != TERNARY || p.peek().Raw != ":" {
-		return nil, fmt.Errorf("expected ':' in ternary operator")
+		return nil, p.errorAt(p.peek(), "expected ':' in ternary operator, got %s", describeToken(p.peek()))
 	}
 	p.next() // consume ':'
 
-	falseExpr, err := p.parseExpression(0)
+	falseExpr, err := p.parseExpression(precedence)
 	if err != nil {
 		return nil, err
 	}
 
-	node := newASTNode(&ExpressionToken{Kind: TERNARY, Raw: "?:", Value: nil})
+	ternary := *token
+	ternary.Raw = "?:"
+	ternary.Value = nil
+	node := newASTNode(&ternary)
 	node.Children = append(node.Children, condition, trueExpr, falseExpr)
 
 	return node, nil
@@ -313,8 +701,8 @@ func (p *Parser) parseTernary() (*ASTNode, error) {
 
 func (p *Parser) parseClause() (*ASTNode, error) {
 	token := p.next()
-	if token.Kind != CLAUSE {
-		return nil, fmt.Errorf("expected %v token, got %v", CLAUSE, token)
+	if token == nil || token.Kind != CLAUSE {
+		return nil, p.errorAt(token, "expected %v token, got %s", CLAUSE, describeToken(token))
 	}
 
 	// log.Printf("parseClause\n")
@@ -334,61 +722,225 @@ func (p *Parser) parseClause() (*ASTNode, error) {
 	return node, nil
 }
 
+// isLambdaStart 向前查看当前位置是否是 lambda 的参数部分：x -> 或 (x, y) ->，不消耗 token
+func (p *Parser) isLambdaStart() bool {
+	var kinds []TokenKind
+	for _, token := range p.tokens[p.pos:] {
+		if token.Kind == COMMENT {
+			continue
+		}
+		kinds = append(kinds, token.Kind)
+
+		// 参数部分只包含变量、逗号和右括号，遇到其他 token 即可停止查看
+		if len(kinds) == 2 && kinds[0] != CLAUSE {
+			break
+		}
+		if len(kinds) > 1 && token.Kind != VARIABLE && token.Kind != SEPARATOR && token.Kind != CLAUSE_CLOSE {
+			break
+		}
+	}
+
+	if len(kinds) == 2 {
+		return kinds[0] == VARIABLE && kinds[1] == LAMBDA
+	}
+	if len(kinds) < 3 || kinds[0] != CLAUSE || kinds[len(kinds)-1] != LAMBDA || kinds[len(kinds)-2] != CLAUSE_CLOSE {
+		return false
+	}
+
+	// 括号内只能是逗号分隔的参数名
+	parameters := kinds[1 : len(kinds)-2]
+	for i, kind := range parameters {
+		if (i%2 == 0 && kind != VARIABLE) || (i%2 == 1 && kind != SEPARATOR) {
+			return false
+		}
+	}
+	return len(parameters)%2 == 1 || len(parameters) == 0
+}
+
+// parseLambda 解析 lambda 表达式，参数名保存在 token 的 Value 中（[]string），函数体是唯一的子节点
+func (p *Parser) parseLambda() (*ASTNode, error) {
+	var parameters []string
+
+	if p.peekIs(VARIABLE) {
+		parameters = append(parameters, p.next().Raw)
+	} else {
+		p.next() // consume '('
+		for token := p.next(); token.Kind != CLAUSE_CLOSE; token = p.next() {
+			if token.Kind == VARIABLE {
+				parameters = append(parameters, token.Raw)
+			}
+		}
+	}
+
+	arrow := *p.next()
+	arrow.Value = parameters
+	node := newASTNode(&arrow)
+
+	body, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	node.Children = append(node.Children, body)
+
+	return node, nil
+}
+
+// parseArray 解析数组字面量 [1, 2, 3]
+func (p *Parser) parseArray() (*ASTNode, error) {
+	node, err := p.parseToken(ARRAY)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.peek() == nil {
+			return nil, p.errorAt(nil, "unexpected end of expression in array literal")
+		}
+
+		if p.peekIs(ARRAY_CLOSE) {
+			p.next() // consume ']'
+			break
+		}
+
+		element, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, element)
+
+		if p.peekIs(SEPARATOR) {
+			p.next() // consume ','
+		} else if !p.peekIs(ARRAY_CLOSE) {
+			return nil, p.errorAt(p.peek(), "expected ',' or ']' in array literal, got %s", describeToken(p.peek()))
+		}
+	}
+
+	return node, nil
+}
+
+// parseMap 解析映射字面量 {'a': 1, 'b': 2}，子节点按 键、值、键、值 的顺序排列
+func (p *Parser) parseMap() (*ASTNode, error) {
+	node, err := p.parseToken(MAP)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.peek() == nil {
+			return nil, p.errorAt(nil, "unexpected end of expression in map literal")
+		}
+
+		if p.peekIs(MAP_CLOSE) {
+			p.next() // consume '}'
+			break
+		}
+
+		key, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() == nil || p.peek().Kind != TERNARY || p.peek().Raw != ":" {
+			return nil, p.errorAt(p.peek(), "expected ':' after map key, got %s", describeToken(p.peek()))
+		}
+		p.next() // consume ':'
+
+		value, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, key, value)
+
+		if p.peekIs(SEPARATOR) {
+			p.next() // consume ','
+		} else if !p.peekIs(MAP_CLOSE) {
+			return nil, p.errorAt(p.peek(), "expected ',' or '}' in map literal, got %s", describeToken(p.peek()))
+		}
+	}
+
+	return node, nil
+}
+
+// parseClauseOrArray 解析比较运算右侧的括号：只有一个元素时是普通的括号，如 a == (b + c)
+// 含逗号时是列表，如 status in ('open', 'pending')，解析为没有位置的 ARRAY 节点
 func (p *Parser) parseClauseOrArray() (*ASTNode, error) {
+	token := p.peek()
 	// 开括号
 	if err := p.expectToken(CLAUSE); err != nil {
 		return nil, err
 	}
 
-	token := p.next() // consume '('
-
-	node := newASTNode(token)
-	array := newASTNode(&ExpressionToken{Kind: ARRAY})
+	var elements []*ASTNode
 	isArray := false
 
 	for {
 		if p.peek() == nil {
-			return nil, fmt.Errorf("unexpected end of tokens")
+			return nil, p.errorAt(nil, "unexpected end of expression in list")
 		}
 
-		if p.peek().Kind == CLAUSE_CLOSE {
+		if p.peekIs(CLAUSE_CLOSE) {
 			p.next() // consume ')'
 			break
 		}
 
+		element, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+
 		// 判断是否为分隔符，如果是，则继续解析下一个元素
-		if p.peek().Kind == SEPARATOR {
+		if p.peekIs(SEPARATOR) {
 			p.next() // consume ','
-			if !isArray {
-				array.Children = append(array.Children, node)
-			}
 			isArray = true
-
-			continue
+		} else if !p.peekIs(CLAUSE_CLOSE) {
+			return nil, p.errorAt(p.peek(), "expected ',' or ')' in list, got %s", describeToken(p.peek()))
 		}
+	}
 
-		element, err := p.parsePrimaryExpression()
-		if err != nil {
-			return nil, err
-		}
-		if isArray {
-			array.Children = append(array.Children, element)
-		} else {
-			node.Children = append(node.Children, element)
-		}
+	if len(elements) == 1 && !isArray {
+		node := newASTNode(token)
+		node.Children = append(node.Children, elements[0])
+		return node, nil
 	}
 
-	if isArray {
-		return array, nil
+	array := newASTNode(&ExpressionToken{Kind: ARRAY})
+	array.Children = append(array.Children, elements...)
+	return array, nil
+}
+
+// isIntegerValue 判断 NUMERIC 的值是否为整数，值可能是 float64，也可能是保留整数时的 int64 或 *big.Int
+func isIntegerValue(value interface{}) bool {
+	switch v := value.(type) {
+	case int64, *big.Int:
+		return true
+	case float64:
+		return v == math.Trunc(v)
+	case *big.Rat:
+		return v.IsInt()
 	}
+	return false
+}
 
-	return node, nil
+// isNegativeValue 判断 NUMERIC 的值是否为负数，FoldNegativeNumbers 会把 -1 合并为一个 NUMERIC
+func isNegativeValue(value interface{}) bool {
+	switch v := value.(type) {
+	case int64:
+		return v < 0
+	case float64:
+		return v < 0
+	case *big.Int:
+		return v.Sign() < 0
+	case *big.Rat:
+		return v.Sign() < 0
+	}
+	return false
 }
 
 func (p *Parser) parseToken(expected TokenKind) (*ASTNode, error) {
 	token := p.next()
-	if token.Kind != expected {
-		return nil, fmt.Errorf("expected %v token, got %v", expected, token)
+	if token == nil || token.Kind != expected {
+		return nil, p.errorAt(token, "expected %v token, got %s", expected, describeToken(token))
 	}
 
 	// log.Printf("parseToken expected %s token: %s, start %d end %d\n", expected, token.Raw, token.Start, token.End)
@@ -399,20 +951,82 @@ func (p *Parser) parseToken(expected TokenKind) (*ASTNode, error) {
 func (p *Parser) expectToken(expected TokenKind) error {
 	token := p.peek()
 	if token == nil || token.Kind != expected {
-		return fmt.Errorf("expected %v token, got %v", expected, token)
+		return p.errorAt(token, "expected %v token, got %s", expected, describeToken(token))
 	}
 	p.next() // Consume the token
 	return nil
 }
 
+// peekIs 判断下一个 token 是否为 kind 类型，已到末尾时为 false
+func (p *Parser) peekIs(kind TokenKind) bool {
+	token := p.peek()
+	return token != nil && token.Kind == kind
+}
+
 func (p *Parser) peek() *ExpressionToken {
+	p.skipComments()
 	if p.pos >= len(p.tokens) {
 		return nil
 	}
 	return &p.tokens[p.pos]
 }
 
+// enter 进入一层嵌套的表达式，超出 MaxDepth 时返回错误，与 leave 成对调用
+func (p *Parser) enter() error {
+	p.depth++
+	if p.options.MaxDepth > 0 && p.depth > p.options.MaxDepth {
+		token := p.peek()
+		if token == nil {
+			token = &ExpressionToken{}
+		}
+		p.depth--
+		return p.limitExceeded(LIMIT_DEPTH, p.options.MaxDepth, token)
+	}
+	return nil
+}
+
+func (p *Parser) leave() {
+	p.depth--
+}
+
+// errorAt 构造位于 token 处的解析错误，token 为 nil 时表示表达式已经结束，错误位于最后一个 token 之后
+// Parser 没有源码，因此不带 Snippet
+func (p *Parser) errorAt(token *ExpressionToken, format string, args ...interface{}) *ParseError {
+	if token == nil {
+		return tokenError(endOf(p.tokens), fmt.Sprintf(format, args...))
+	}
+	return tokenError(*token, fmt.Sprintf(format, args...))
+}
+
+// describeToken 返回错误信息中 token 的写法，token 为 nil 时为表达式结束
+func describeToken(token *ExpressionToken) string {
+	if token == nil {
+		return "end of expression"
+	}
+	if token.Raw == "" {
+		return token.Kind.String()
+	}
+	return fmt.Sprintf("'%s'", token.Raw)
+}
+
+// limitExceeded 构造在 token 处超出限制的错误，Parser 没有源码，因此不带 Snippet
+func (p *Parser) limitExceeded(limit string, max int, token *ExpressionToken) *LimitExceededError {
+	err := newLimitExceededError(limit, max, token.Start, token.End)
+	err.Line, err.Column = token.Line, token.Column
+	err.StartByte, err.EndByte = token.StartByte, token.EndByte
+	err.StartUTF16, err.EndUTF16 = token.StartUTF16, token.EndUTF16
+	return err
+}
+
+// skipComments 跳过注释，注释不参与 AST 的构建
+func (p *Parser) skipComments() {
+	for p.pos < len(p.tokens) && p.tokens[p.pos].Kind == COMMENT {
+		p.pos++
+	}
+}
+
 func (p *Parser) next() *ExpressionToken {
+	p.skipComments()
 	if p.pos >= len(p.tokens) {
 		return nil
 	}
@@ -420,16 +1034,3 @@ func (p *Parser) next() *ExpressionToken {
 	p.pos++
 	return token
 }
-
-func (p *Parser) getPrecedence(token *ExpressionToken) int {
-	switch token.Kind {
-	case MODIFIER:
-		return 9000
-	case COMPARATOR:
-		return 8000
-	case LOGICALOP:
-		return 7000
-	default:
-		return 0
-	}
-}
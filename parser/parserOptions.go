@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"strings"
+	"time"
+)
+
+/*
+Options that control how an expression is tokenized, passed to ParseTokensWithOptions and ParseProgramWithOptions.
+The zero value (plus any Functions) behaves the same as ParseTokens; new parsing features are added
+as fields here, so that existing callers keep working unchanged.
+*/
+type ParserOptions struct {
+
+	// Functions that may be called from within the expression, keyed by name.
+	Functions map[string]ExpressionFunction
+
+	// More functions that may be called from within the expression, which can be changed while parsing
+	// goes on in other goroutines. A name found in Functions takes priority over one registered here.
+	FunctionRegistry *FunctionRegistry
+
+	// Attempt to parse every string literal as a time, even ones without a date or time separator.
+	// By default, only strings containing '-', ':', '/' or a month name are considered.
+	PermissiveTimeParsing bool
+
+	// Layouts (in the form used by time.Parse) to try when parsing string literals as times, in order.
+	// When set, these replace DefaultTimeFormats, and every string literal is tried against them.
+	TimeFormats []string
+
+	// Never parse string literals as times, so that '2006-01-02' stays a STRING.
+	// Takes priority over TimeFormats and PermissiveTimeParsing.
+	DisableTimeLiterals bool
+
+	// Also parse string literals written as a duration, such as '90s', as DURATION tokens.
+	// By default only bare duration literals, such as 90s or 2h30m, are durations, and '90s' stays a STRING.
+	QuotedDurations bool
+
+	// The time zone for time literals which don't give one of their own, such as '2006-01-02 15:04'.
+	// Defaults to UTC, so that the same expression parses to the same time on every machine.
+	Location *time.Location
+
+	// Limits for expressions from untrusted sources, each of which is returned as a *LimitExceededError
+	// when passed. MaxLength counts characters, MaxTokens counts tokens (not including comments),
+	// and MaxDepth counts how deeply parenthesis and brackets are nested. Zero means no limit.
+	MaxLength int
+	MaxTokens int
+	MaxDepth  int
+
+	// Allow accessor segments that start with a lowercase letter, such as 'order.total'.
+	// By default these are rejected, since govaluate can only reflect on exported struct fields;
+	// enable this when accessors resolve against maps or other data with lowercase keys.
+	AllowUnexportedAccessors bool
+
+	// Reject a name directly followed by '(' which isn't one of the Functions, as in 'fooBar(1)',
+	// with an "unknown function" error. By default such a name is read as a VARIABLE, and only fails later on.
+	StrictFunctions bool
+
+	// Words which may not be used as names (of variables, functions or accessor segments), such as 'select',
+	// matched regardless of case. A reserved word can still be used as a variable by escaping it, as in [select].
+	ReservedWords []string
+
+	// Canonical spellings of names, keyed by their lower case form, such as "status": "Status".
+	// When set, names are matched regardless of case: each variable name and accessor segment found here is
+	// rewritten to its canonical spelling, and Functions are found whatever the case of the call,
+	// so that 'STATUS' and 'status' both parse (and are generated) as 'Status'. A call which doesn't match
+	// a function exactly, and matches more than one regardless of case, is an error.
+	CanonicalNames map[string]string
+
+	// Which characters may make up variable, accessor and function names, including the letters in bracketed names.
+	// Defaults to IDENTIFIERS_UNICODE.
+	IdentifierPolicy IdentifierPolicy
+
+	// Decides whether [character] may start a name (when [first] is true) or continue one,
+	// when IdentifierPolicy is IDENTIFIERS_CUSTOM.
+	IdentifierRune func(character rune, first bool) bool
+
+	// Emit '//' line comments and '/* */' block comments as COMMENT tokens, instead of discarding them.
+	// COMMENT tokens don't affect the lexer state, and the Parser attaches them to the nodes next to them as Comments.
+	KeepComments bool
+
+	// Keep whitespace and comments as TRIVIA tokens, attached to the LeadingTrivia and TrailingTrivia of the
+	// tokens around them, so that a formatter can preserve blank lines and comments. Comments then don't
+	// appear as COMMENT tokens of their own, even with KeepComments, but are still attached to the nodes by the Parser.
+	KeepTrivia bool
+
+	// Store integer literals (decimal, hex, octal or binary, without a fraction or exponent) exactly, instead of
+	// as float64: as an int64, or a *big.Int for literals that don't fit in one, such as 0xFFFFFFFFFFFFFFFF.
+	PreserveIntegers bool
+
+	// Fold a '-' prefix followed by a number into a single negative NUMERIC token, so that '-5' is one token
+	// with the value -5 instead of a PREFIX and a NUMERIC.
+	FoldNegativeNumbers bool
+
+	// Store every numeric literal as an exact *big.Rat instead of a float64, so that values such as 0.1
+	// keep their precision. Takes priority over PreserveIntegers.
+	DecimalLiterals bool
+}
+
+func (options ParserOptions) timeFormats() []string {
+
+	if options.TimeFormats != nil {
+		return options.TimeFormats
+	}
+	return DefaultTimeFormats
+}
+
+/*
+Returns the function called [name], from Functions or else the FunctionRegistry.
+*/
+func (options ParserOptions) function(name string) (ExpressionFunction, bool) {
+
+	if function, found := options.Functions[name]; found {
+		return function, true
+	}
+	return options.FunctionRegistry.Lookup(name)
+}
+
+func (options ParserOptions) isReservedWord(name string) bool {
+
+	for _, word := range options.ReservedWords {
+		if strings.EqualFold(word, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (options ParserOptions) location() *time.Location {
+
+	if options.Location != nil {
+		return options.Location
+	}
+	return time.UTC
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrorPositions(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		msg        string
+		start, end int
+	}{
+		{"[a] +", "unexpected end of expression", 5, 5},
+		{"f(1, 2", "Unclosed '(' at offset 1", 1, 2},
+		{"x[-1]", "negative index is not supported", 2, 3},
+		{"x[a]", "index must be a non-negative integer or a string, got 'a'", 2, 3},
+		{"{\"a\" 1}", "expected ':' after map key, got '1'", 5, 6},
+		{"a ? b", "expected ':' in ternary operator, got end of expression", 5, 5},
+		{"a |> 1", "expected a function after '|>', got '1'", 5, 6},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokens(test.expression, nil)
+		if err == nil {
+			_, err = NewParser(tokens).Parse()
+		}
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			t.Errorf("%q: got %T %v, want a *ParseError", test.expression, err, err)
+			continue
+		}
+		if parseError.Msg != test.msg || parseError.Start != test.start || parseError.End != test.end {
+			t.Errorf("%q: got %q at [%d, %d), want %q at [%d, %d)",
+				test.expression, parseError.Msg, parseError.Start, parseError.End, test.msg, test.start, test.end)
+		}
+		if parseError.Line != 1 || parseError.Column != test.start+1 {
+			t.Errorf("%q: got %d:%d, want 1:%d", test.expression, parseError.Line, parseError.Column, test.start+1)
+		}
+	}
+}
+
+func TestIndexAccess(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		kind       TokenKind
+		want       string
+	}{
+		{"items[0]", INDEX, "([ items 0)"},
+		{"matrix[2][1]", INDEX, "([ ([ matrix 2) 1)"},
+		{"a.B[0]", INDEX, "([ a.B 0)"},
+		{"items['k']", INDEX, "([ items k)"},
+		{"[escaped var]", VARIABLE, "escaped var"},
+		{"[escaped var][0]", INDEX, "([ escaped var 0)"},
+		{"items[0] + [my items][1]", MODIFIER, "(+ ([ items 0) ([ my items 1))"},
+	}
+
+	for _, test := range tests {
+		tree, err := parseAST(test.expression, ParserOptions{})
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if tree.Token.Kind != test.kind || sexpr(tree) != test.want {
+			t.Errorf("%q parses into %v %s, want %v %s", test.expression, tree.Token.Kind, sexpr(tree), test.kind, test.want)
+		}
+		if err := CheckRoundTrip(test.expression, ParserOptions{}, GenerateOptions{}); err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+		}
+	}
+
+	// an index follows its operand directly; after a space, the brackets start a list
+	tokens, err := ParseTokens("items [0]", nil)
+	if err != nil {
+		t.Fatalf("'items [0]': %v", err)
+	}
+	if len(tokens) < 2 || tokens[1].Kind != ARRAY {
+		t.Errorf("'items [0]' lexes into %v, want an ARRAY after the variable", tokens)
+	}
+}
+
+func TestErrorAtEndOfMultilineToken(t *testing.T) {
+
+	tests := []struct {
+		expression   string
+		msg          string
+		start        int
+		line, column int
+	}{
+		{"[a] ? 'x\nyz'", "expected ':' in ternary operator, got end of expression", 12, 2, 4},
+		{"[a] ? 'x\ny\nz'", "expected ':' in ternary operator, got end of expression", 13, 3, 3},
+		{"[a] ?\n  [b\nc]", "expected ':' in ternary operator, got end of expression", 13, 3, 3},
+		{"[a] ? 'xyz'", "expected ':' in ternary operator, got end of expression", 11, 1, 12},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokens(test.expression, nil)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+		_, err = NewParser(tokens).Parse()
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			t.Errorf("%q: got %T %v, want a *ParseError", test.expression, err, err)
+			continue
+		}
+		if parseError.Msg != test.msg || parseError.Start != test.start {
+			t.Errorf("%q: got %q at %d, want %q at %d", test.expression, parseError.Msg, parseError.Start, test.msg, test.start)
+		}
+		if parseError.Line != test.line || parseError.Column != test.column {
+			t.Errorf("%q: got %d:%d, want %d:%d", test.expression, parseError.Line, parseError.Column, test.line, test.column)
+		}
+	}
+}
+
+func TestParseInterpolatedStringAtEnd(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		tokens []ExpressionToken
+		msg    string
+	}{
+		{"no tokens", nil, "expected an interpolated string, got end of expression"},
+		{"no value", []ExpressionToken{{Kind: INTERPOLATED_STRING, Raw: "x${y}"}}, "expected an interpolated string, got 'x${y}'"},
+	}
+
+	for _, test := range tests {
+		_, err := NewParser(test.tokens).parseInterpolatedString()
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) || parseError.Msg != test.msg {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.msg)
+		}
+	}
+}
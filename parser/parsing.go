@@ -1,9 +1,10 @@
 package parser
 
 import (
-	"bytes"
-	"errors"
+	"context"
 	"fmt"
+	"math/big"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -11,29 +12,93 @@ import (
 )
 
 func ParseTokens(expression string, functions map[string]ExpressionFunction) ([]ExpressionToken, error) {
+	return ParseTokensWithOptions(expression, ParserOptions{Functions: functions})
+}
+
+func ParseTokensWithOptions(expression string, options ParserOptions) ([]ExpressionToken, error) {
+	return parseTokens(context.Background(), expression, options)
+}
+
+/*
+ParseTokensContext is like ParseTokens, but gives up once [ctx] is done, returning ctx.Err().
+The context is checked every contextCheckInterval tokens, so a deadline can be enforced on very large expressions.
+*/
+func ParseTokensContext(ctx context.Context, expression string, functions map[string]ExpressionFunction) ([]ExpressionToken, error) {
+	return parseTokens(ctx, expression, ParserOptions{Functions: functions})
+}
+
+/*
+ParseTokensWithOptionsContext is like ParseTokensWithOptions, but gives up once [ctx] is done, returning ctx.Err().
+*/
+func ParseTokensWithOptionsContext(ctx context.Context, expression string, options ParserOptions) ([]ExpressionToken, error) {
+	return parseTokens(ctx, expression, options)
+}
+
+// how many tokens are read between checks of the context
+const contextCheckInterval = 256
+
+func parseTokens(ctx context.Context, expression string, options ParserOptions) ([]ExpressionToken, error) {
+
+	stream := newLexerStream(expression)
+
+	err := checkLength(stream, 0, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return lexTokens(ctx, stream, options, &limitCounter{})
+}
+
+/*
+Reads all of the tokens of the [stream], counting them against options.MaxTokens and options.MaxDepth
+with [limits], which ParseProgramWithOptions shares between the statements of a program.
+*/
+func lexTokens(ctx context.Context, stream *lexerStream, options ParserOptions, limits *limitCounter) ([]ExpressionToken, error) {
 	var ret []ExpressionToken
 	var token ExpressionToken
-	var stream *lexerStream
 	var state lexerState
 	var err error
 	var found bool
 
-	stream = newLexerStream(expression)
 	state = validLexerStates[0]
 
-	for stream.canRead() {
+	for count := 0; stream.canRead(); count++ {
+
+		if count%contextCheckInterval == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
 
-		token, err, found = readToken(stream, state, functions)
+		token, err, found = readToken(stream, state, options)
 
 		if err != nil {
-			return ret, err
+			// errors inside an interpolation (or an escape sequence) already carry their own position
+			return ret, toParseError(err, token.Start, token.End, stream)
 		}
 
 		if !found {
 			break
 		}
 
-		state, err = getLexerStateForToken(token.Kind)
+		stream.locate(&token)
+
+		// comments are trivia, and don't change what may legally come next
+		if token.Kind == COMMENT {
+			if options.KeepComments || options.KeepTrivia {
+				ret = append(ret, token)
+			}
+			continue
+		}
+
+		state, err = getLexerStateForToken(token)
+		if err != nil {
+			return ret, toParseError(err, token.Start, token.End, stream)
+		}
+
+		err = limits.add(token, stream, options)
 		if err != nil {
 			return ret, err
 		}
@@ -44,18 +109,91 @@ func ParseTokens(expression string, functions map[string]ExpressionFunction) ([]
 
 	err = checkBalance(ret)
 	if err != nil {
-		return nil, err
+		return nil, toParseError(err, 0, 0, stream)
+	}
+
+	err = compilePatterns(ret)
+	if err != nil {
+		return nil, toParseError(err, 0, stream.length, stream)
+	}
+
+	if options.FoldNegativeNumbers {
+		ret = foldNegativeNumbers(ret)
+	}
+
+	if options.KeepTrivia {
+		ret = attachTrivia(ret, stream)
 	}
 
 	return ret, nil
 }
 
-func readToken(stream *lexerStream, state lexerState, functions map[string]ExpressionFunction) (ExpressionToken, error, bool) {
+/*
+Turns the string operand on the right of a regex comparator ('=~' or '!~') into a PATTERN token,
+holding the compiled *regexp.Regexp, so that invalid patterns are reported at parse time.
+The string operand of a 'like' is checked too, but stays a STRING.
+*/
+func compilePatterns(tokens []ExpressionToken) error {
+
+	var compiler patternCompiler
+
+	for i := range tokens {
+		if err := compiler.next(&tokens[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Does the work of compilePatterns one token at a time, remembering what came before,
+so that tokens can be checked as they are read.
+*/
+type patternCompiler struct {
+	lastKind       TokenKind
+	lastComparator string
+}
+
+func (c *patternCompiler) next(token *ExpressionToken) error {
+
+	if token.Kind == COMMENT {
+		return nil
+	}
+
+	symbol := comparatorSymbols[c.lastComparator]
+	if (symbol == REQ || symbol == NREQ) && (token.Kind == STRING || token.Kind == TIME) {
+
+		pattern, err := regexp.Compile(token.Raw)
+		if err != nil {
+			errorMsg := fmt.Sprintf("Unable to compile regex pattern '%s': %v", token.Raw, err)
+			return &ParseError{Msg: errorMsg, Start: token.Start, End: token.End}
+		}
+
+		token.Kind = PATTERN
+		token.Value = pattern
+	}
+
+	if c.lastKind == LIKE && token.Kind == STRING {
+		if _, err := LikeToRegexp(token.Raw); err != nil {
+			return &ParseError{Msg: err.Error(), Start: token.Start, End: token.End}
+		}
+	}
+
+	c.lastKind = token.Kind
+	c.lastComparator = ""
+	if token.Kind == COMPARATOR {
+		c.lastComparator = token.Raw
+	}
+	return nil
+}
+
+func readToken(stream *lexerStream, state lexerState, options ParserOptions) (ExpressionToken, error, bool) {
 
 	var function ExpressionFunction
 	var ret ExpressionToken
 	var tokenValue interface{}
 	var tokenTime time.Time
+	var tokenDuration time.Duration
 	var tokenString string
 	var kind TokenKind
 	var character rune
@@ -66,7 +204,7 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 	// numeric is 0-9, or . or 0x followed by digits
 	// string starts with '
 	// variable is alphanumeric, always starts with a letter
-	// bracket always means variable
+	// bracket means variable, unless it directly follows a variable (index access)
 	// symbols are anything non-alphanumeric
 	// all others read into a buffer until they reach the end of the stream
 	for stream.canRead() {
@@ -81,35 +219,151 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 
 		kind = UNKNOWN
 
+		// invisible formatting characters (zero-width spaces, stray byte order marks) would otherwise
+		// show up as confusing invalid tokens. Unicode spaces, such as U+00A0, are whitespace above.
+		if unicode.Is(unicode.Cf, character) {
+			errorMsg := fmt.Sprintf("Invisible character %U is not allowed in expressions", character)
+			return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+		}
+
+		// comments
+		if character == '/' && (peekCharacter(stream) == '/' || peekCharacter(stream) == '*') {
+			tokenString, tokenValue, completed = readComment(stream)
+
+			if !completed {
+				return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: "Unclosed block comment", Start: position, End: stream.position}, false
+			}
+
+			kind = COMMENT
+			break
+		}
+
 		// numeric constant
 		if isNumeric(character) {
 
-			if stream.canRead() && character == '0' {
+			// a '0' may start a hex, binary or octal literal; a bare '0' at the end of the stream is just zero.
+			if character == '0' && stream.canRead() {
 				character = stream.readCharacter()
 
-				if stream.canRead() && character == 'x' {
-					tokenString, _ = readUntilFalse(stream, false, true, true, isHexDigit)
-					tokenValueInt, err := strconv.ParseUint(tokenString, 16, 64)
+				if character == 'x' {
+					tokenString, _ = readUntilFalse(stream, false, true, true, isHexDigitOrSeparator)
+
+					// hex floats, such as 0x1.8p3, continue with a fraction and/or binary exponent
+					if isHexFloatMarker(peekCharacter(stream)) {
+						tokenString = "0x" + tokenString + readHexFloatTail(stream)
+
+						// with DecimalLiterals the value is parsed exactly further on, and needn't fit in a float64
+						if !options.DecimalLiterals {
+							tokenValue, err = strconv.ParseFloat(tokenString, 64)
+
+							if err != nil {
+								errorMsg := fmt.Sprintf("Unable to parse hex float value '%v' to float64", tokenString)
+								return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+							}
+						}
+
+						kind = NUMERIC
+						break
+					}
+
+					if tokenString == "" {
+						return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: "Hex literal '0x' has no digits", Start: position, End: stream.position}, false
+					}
+
+					if !hasValidSeparators(tokenString) {
+						errorMsg := fmt.Sprintf("Invalid digit separator in hex value '0x%v'", tokenString)
+						return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+					}
 
+					tokenValue, err = integerValue(tokenString, 16, options)
 					if err != nil {
 						errorMsg := fmt.Sprintf("Unable to parse hex value '%v' to uint64\n", tokenString)
-						return ExpressionToken{Start: position, End: stream.position}, errors.New(errorMsg), false
+						return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
 					}
 
 					kind = NUMERIC
-					tokenValue = float64(tokenValueInt)
+					tokenString = "0x" + tokenString
 					break
-				} else {
-					stream.rewind(1)
 				}
+
+				if character == 'b' || character == 'o' {
+					base, baseName := 2, "binary"
+					if character == 'o' {
+						base, baseName = 8, "octal"
+					}
+
+					// read anything digit-like, so that a stray digit is reported rather than split into its own token
+					tokenString, _ = readUntilFalse(stream, false, true, true, isHexDigitOrSeparator)
+					if tokenString == "" {
+						errorMsg := fmt.Sprintf("%s literal '0%c' has no digits", strings.ToUpper(baseName[:1])+baseName[1:], character)
+						return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+					}
+
+					tokenString = fmt.Sprintf("0%c%s", character, tokenString)
+					for _, digit := range tokenString[2:] {
+						if digit != '_' && !isDigitInBase(digit, base) {
+							errorMsg := fmt.Sprintf("Invalid digit '%c' in %s value '%v'", digit, baseName, tokenString)
+							return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+						}
+					}
+
+					if !hasValidSeparators(tokenString[2:]) {
+						errorMsg := fmt.Sprintf("Invalid digit separator in %s value '%v'", baseName, tokenString)
+						return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+					}
+
+					tokenValue, err = integerValue(tokenString[2:], base, options)
+					if err != nil {
+						errorMsg := fmt.Sprintf("Unable to parse %s value '%v' to uint64", baseName, tokenString)
+						return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+					}
+
+					kind = NUMERIC
+					break
+				}
+
+				stream.rewind(1)
 			}
 
-			tokenString = readTokenUntilFalse(stream, isNumeric)
-			tokenValue, err = strconv.ParseFloat(tokenString, 64)
+			tokenString = readTokenUntilFalse(stream, isNumericOrSeparator)
+			if !hasValidSeparators(tokenString) {
+				errorMsg := fmt.Sprintf("Invalid digit separator in numeric value '%v'", tokenString)
+				return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+			}
+
+			tokenString += readExponent(stream)
+
+			// duration, such as 5m or 2h30m?
+			if isDurationUnit(peekCharacter(stream)) {
+
+				tokenString += readDurationTail(stream)
+				tokenValue, err = time.ParseDuration(strings.ReplaceAll(tokenString, "_", ""))
+
+				if err != nil {
+					errorMsg := fmt.Sprintf("Unable to parse duration value '%v'", tokenString)
+					return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+				}
+				kind = DURATION
+				break
+			}
+
+			// with DecimalLiterals the value is parsed exactly further on, and needn't fit in a float64, as 1e400 doesn't
+			if options.DecimalLiterals {
+				kind = NUMERIC
+				break
+			}
+
+			tokenValue, err = strconv.ParseFloat(strings.ReplaceAll(tokenString, "_", ""), 64)
 
 			if err != nil {
 				errorMsg := fmt.Sprintf("Unable to parse numeric value '%v' to float64\n", tokenString)
-				return ExpressionToken{Start: position, End: stream.position}, errors.New(errorMsg), false
+				return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+			}
+
+			if options.PreserveIntegers {
+				if tokenValueInt, ok := new(big.Int).SetString(strings.ReplaceAll(tokenString, "_", ""), 10); ok {
+					tokenValue = preservedInteger(tokenValueInt)
+				}
 			}
 			kind = NUMERIC
 			break
@@ -124,6 +378,31 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 			break
 		}
 
+		// index access, only when the bracket directly follows a variable, accessor, or another index.
+		if character == '[' && isIndexable(state.kind) && !unicode.IsSpace(stream.source[position-1]) {
+			tokenString = "["
+			tokenValue = character
+			kind = INDEX
+			stream.openBracket(kind)
+			break
+		}
+
+		// array literal, only when the bracket contains literals, so that [data] is still an escaped variable.
+		if character == '[' && isArrayLiteralStart(peekNonSpace(stream)) {
+			tokenString = "["
+			tokenValue = character
+			kind = ARRAY
+			stream.openBracket(kind)
+			break
+		}
+
+		if character == ']' {
+			tokenString = "]"
+			tokenValue = character
+			kind = stream.closeBracket()
+			break
+		}
+
 		// escaped variable
 		if character == '[' {
 			tokenValue, completed = readUntilFalse(stream, true, false, true, isNotClosingBracket)
@@ -131,7 +410,17 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 			tokenString = fmt.Sprintf("%s", tokenValue)
 
 			if !completed {
-				return ExpressionToken{Start: position, End: stream.position}, errors.New("Unclosed parameter bracket"), false
+				return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: "Unclosed parameter bracket", Start: position, End: stream.position}, false
+			}
+
+			err = options.checkBracketedName(tokenString)
+			if err != nil {
+				return ExpressionToken{Start: position, End: stream.position + 1}, err, false
+			}
+
+			if options.CanonicalNames != nil {
+				tokenString = options.canonicalSegment(tokenString)
+				tokenValue = tokenString
 			}
 
 			// above method normally rewinds us to the closing bracket, which we want to skip.
@@ -140,9 +429,21 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 		}
 
 		// regular variable - or function?
-		if unicode.IsLetter(character) {
+		if options.isIdentifierRune(character, true) {
+
+			tokenString = readTokenUntilFalse(stream, options.isVariableName)
+
+			// optional chaining, such as foo?.Bar
+			for isOptionalChain(stream, options) {
+				stream.rewind(-2)
+				segment, _ := readUntilFalse(stream, false, true, true, options.isVariableName)
+				tokenString += "?." + segment
+			}
 
-			tokenString = readTokenUntilFalse(stream, isVariableName)
+			// a letter the identifier policy doesn't allow would otherwise start a confusing second token
+			if next := peekCharacter(stream); unicode.IsLetter(next) {
+				return ExpressionToken{Start: position, End: stream.position + 1}, disallowedIdentifierError(next, tokenString+string(next)), false
+			}
 
 			tokenValue = tokenString
 			kind = VARIABLE
@@ -161,6 +462,13 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 				}
 			}
 
+			// null?
+			if tokenValue == "nil" || tokenValue == "null" {
+
+				kind = NULL
+				tokenValue = nil
+			}
+
 			// textual operator?
 			if tokenValue == "in" || tokenValue == "IN" {
 
@@ -169,8 +477,51 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 				kind = COMPARATOR
 			}
 
+			// range comparison?
+			if tokenValue == "between" || tokenValue == "BETWEEN" {
+
+				tokenValue = "between"
+				kind = BETWEEN
+			}
+
+			// wildcard match?
+			if tokenValue == "like" || tokenValue == "LIKE" {
+
+				tokenValue = "like"
+				kind = LIKE
+			}
+
+			// textual logical operator? normalized to its symbol, the same way as "in" above
+			if symbol, found := textualLogicalSymbols[tokenString]; found {
+
+				tokenValue = symbol
+				kind = LOGICALOP
+				if symbol == "!" {
+					kind = PREFIX
+				}
+			}
+
+			// registered operator, such as 'within'?
+			if operator, found := customOperators[tokenString]; found {
+
+				tokenValue = tokenString
+				kind = operator.Kind
+			}
+
+			// a name in other than its canonical case?
+			if kind == VARIABLE && options.CanonicalNames != nil {
+				tokenString = options.canonicalName(tokenString)
+				tokenValue = tokenString
+			}
+
 			// function?
-			function, found = functions[tokenString]
+			function, found = options.function(tokenString)
+			if !found && options.CanonicalNames != nil {
+				tokenString, function, found, err = options.foldedFunction(tokenString)
+				if err != nil {
+					return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: err.Error(), Start: position, End: stream.position}, false
+				}
+			}
 			if found {
 				kind = FUNCTION
 				tokenValue = function
@@ -183,46 +534,98 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 				// check that it doesn't end with a hanging period
 				if tokenString[len(tokenString)-1] == '.' {
 					errorMsg := fmt.Sprintf("Hanging accessor on token '%s'", tokenString)
-					return ExpressionToken{Start: position, End: stream.position}, errors.New(errorMsg), false
+					return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
 				}
 
 				kind = ACCESSOR
-				splits := strings.Split(tokenString, ".")
+				splits, nilSafe := splitAccessor(tokenString)
 				tokenValue = splits
+				if strings.Contains(tokenString, "?.") {
+					tokenValue = OptionalAccessor{Segments: splits, NilSafe: nilSafe}
+				}
 
 				// check that none of them are unexported
-				for i := 1; i < len(splits); i++ {
-
-					firstCharacter := getFirstRune(splits[i])
+				for i := 1; i < len(splits) && !options.AllowUnexportedAccessors; i++ {
 
-					if unicode.ToUpper(firstCharacter) != firstCharacter {
+					if !isExportedName(splits[i]) {
 						errorMsg := fmt.Sprintf("Unable to access unexported field '%s' in token '%s'", splits[i], tokenString)
-						return ExpressionToken{Start: position, End: stream.position}, errors.New(errorMsg), false
+						return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+					}
+				}
+			}
+
+			// or a reserved word?
+			if len(options.ReservedWords) > 0 && (kind == VARIABLE || kind == ACCESSOR || kind == FUNCTION) {
+				for _, segment := range strings.Split(strings.ReplaceAll(tokenString, "?.", "."), ".") {
+					if options.isReservedWord(segment) {
+						errorMsg := fmt.Sprintf("'%s' is a reserved word, and can't be used as a name", segment)
+						if kind == VARIABLE {
+							errorMsg = fmt.Sprintf("'%s' is a reserved word; write it as [%s] to use it as a variable", segment, segment)
+						}
+						return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
 					}
 				}
 			}
+
+			// a call to a function that doesn't exist?
+			if kind == VARIABLE && options.StrictFunctions && peekCharacter(stream) == '(' {
+				errorMsg := fmt.Sprintf("unknown function '%s'", tokenString)
+				return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMsg, Start: position, End: stream.position}, false
+			}
+
+			break
+		}
+
+		if unicode.IsLetter(character) {
+			return ExpressionToken{Start: position, End: stream.position}, disallowedIdentifierError(character, string(character)), false
+		}
+
+		if character == '"' && hasInterpolation(stream) {
+
+			tokenString, tokenValue, err = readInterpolatedString(stream, options)
+			if err != nil {
+				return ExpressionToken{Start: position, End: stream.position}, err, false
+			}
+			kind = INTERPOLATED_STRING
 			break
 		}
 
 		if !isNotQuote(character) {
-			tokenValue, completed = readUntilFalse(stream, true, false, true, isNotQuote)
+			tokenValue, completed, err = readStringLiteral(stream)
+			if err != nil {
+				return ExpressionToken{Start: position, End: stream.position}, err, false
+			}
 
 			if !completed {
-				return ExpressionToken{Start: position, End: stream.position}, errors.New("Unclosed string literal"), false
+				return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: "Unclosed string literal", Start: position, End: stream.position}, false
 			}
 
 			// advance the stream one position, since reading until false assumes the terminator is a real token
 			stream.rewind(-1)
 
 			// check to see if this can be parsed as a time.
-			tokenTime, found = tryParseTime(tokenValue.(string))
 			tokenString = tokenValue.(string)
+			found = false
+			if !options.DisableTimeLiterals && (options.PermissiveTimeParsing || options.TimeFormats != nil || hasTimeSignal(tokenString)) {
+				tokenTime, found = tryParseTime(tokenString, options.timeFormats(), options.location())
+			}
 			if found {
 				kind = TIME
 				tokenValue = tokenTime
-			} else {
-				kind = STRING
+				break
+			}
+
+			// or as a duration, if asked to.
+			if options.QuotedDurations {
+				tokenDuration, found = tryParseDuration(tokenString)
 			}
+			if found {
+				kind = DURATION
+				tokenValue = tokenDuration
+				break
+			}
+
+			kind = STRING
 			break
 		}
 
@@ -240,10 +643,30 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 			break
 		}
 
+		if character == '{' {
+			tokenString = "{"
+			tokenValue = character
+			kind = MAP
+			break
+		}
+
+		if character == '}' {
+			tokenString = "}"
+			tokenValue = character
+			kind = MAP_CLOSE
+			break
+		}
+
 		// must be a known symbol
 		tokenString = readTokenUntilFalse(stream, isNotAlphanumeric)
 		tokenValue = tokenString
 
+		// lambda arrow, as in x -> x.Price > 10
+		if tokenString == "->" {
+			kind = LAMBDA
+			break
+		}
+
 		// quick hack for the case where "-" can mean "prefixed negation" or "minus", which are used
 		// very differently.
 		if state.canTransitionTo(PREFIX) {
@@ -281,8 +704,49 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 			break
 		}
 
+		_, found = coalesceSymbols[tokenString]
+		if found {
+
+			kind = NULL_COALESCE
+			break
+		}
+
+		_, found = elvisSymbols[tokenString]
+		if found {
+
+			kind = ELVIS
+			break
+		}
+
+		_, found = pipelineSymbols[tokenString]
+		if found {
+
+			kind = PIPELINE
+			break
+		}
+
+		// a lone '=' is almost always an equality check written assignment-style.
+		if tokenString == "=" && state.canTransitionTo(COMPARATOR) {
+			return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: "Invalid token: '='; did you mean '=='?", Start: position, End: stream.position}, false
+		}
+
+		// a backslash at the end of the input escapes nothing, and leaves the token empty
+		if tokenString == "" {
+			return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: "Unterminated escape sequence", Start: position, End: stream.position}, false
+		}
+
 		errorMessage := fmt.Sprintf("Invalid token: '%s'", tokenString)
-		return ret, errors.New(errorMessage), false
+		return ExpressionToken{Start: position, End: stream.position}, &ParseError{Msg: errorMessage, Start: position, End: stream.position}, false
+	}
+
+	// exact decimals are parsed from the raw text, so that no precision is lost to float64 along the way
+	if kind == NUMERIC && options.DecimalLiterals {
+		tokenRat, ok := new(big.Rat).SetString(strings.ReplaceAll(tokenString, "_", ""))
+		if !ok {
+			errorMsg := fmt.Sprintf("Unable to parse numeric value '%v' to decimal", tokenString)
+			return ExpressionToken{Start: ret.Start, End: stream.position}, &ParseError{Msg: errorMsg, Start: ret.Start, End: stream.position}, false
+		}
+		tokenValue = tokenRat
 	}
 
 	ret.Kind = kind
@@ -293,6 +757,130 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 	return ret, nil, (kind != UNKNOWN)
 }
 
+/*
+Returns the next character without consuming it, or 0 at the end of the stream.
+*/
+func peekCharacter(stream *lexerStream) rune {
+
+	if !stream.canRead() {
+		return 0
+	}
+
+	character := stream.readCharacter()
+	stream.rewind(1)
+	return character
+}
+
+/*
+Returns the next character that isn't whitespace, without consuming anything, or 0 at the end of the stream.
+*/
+func peekNonSpace(stream *lexerStream) rune {
+
+	for i := stream.position; i < stream.length; i++ {
+		if !unicode.IsSpace(stream.source[i]) {
+			return stream.source[i]
+		}
+	}
+	return 0
+}
+
+/*
+Reads a comment, after its leading '/'. Line comments run until (but not including) the next newline,
+block comments until the closing '*' and '/'.
+Returns the raw text including delimiters, the text without them, and false if a block comment is unclosed.
+*/
+func readComment(stream *lexerStream) (string, string, bool) {
+
+	start := stream.position - 1
+	block := stream.readCharacter() == '*'
+
+	for stream.canRead() {
+
+		character := stream.readCharacter()
+
+		if !block && character == '\n' {
+			stream.rewind(1)
+			break
+		}
+
+		if block && character == '*' && peekCharacter(stream) == '/' {
+			stream.readCharacter()
+
+			raw := string(stream.source[start:stream.position])
+			return raw, strings.TrimSpace(raw[2 : len(raw)-2]), true
+		}
+	}
+
+	raw := string(stream.source[start:stream.position])
+	return raw, strings.TrimSpace(raw[2:]), !block
+}
+
+/*
+Reads the exponent suffix of a decimal number, such as the 'e6' in 1e6 or 'E-3' in 2.5E-3.
+If what follows isn't a well-formed exponent, nothing is consumed and an empty string is returned.
+*/
+func readExponent(stream *lexerStream) string {
+
+	start := stream.position
+
+	marker := peekCharacter(stream)
+	if marker != 'e' && marker != 'E' {
+		return ""
+	}
+	stream.readCharacter()
+
+	sign := peekCharacter(stream)
+	if sign == '+' || sign == '-' {
+		stream.readCharacter()
+	}
+
+	digits := 0
+	for stream.canRead() && isDigit(peekCharacter(stream)) {
+		stream.readCharacter()
+		digits++
+	}
+
+	if digits == 0 {
+		stream.position = start
+		return ""
+	}
+	return string(stream.source[start:stream.position])
+}
+
+/*
+Reads the fraction and exponent of a hex float, after its integer digits.
+A sign is only accepted directly after the 'p' exponent marker.
+*/
+func readHexFloatTail(stream *lexerStream) string {
+
+	var previous rune
+
+	start := stream.position
+	for stream.canRead() {
+
+		character := stream.readCharacter()
+
+		isSign := (character == '+' || character == '-') && (previous == 'p' || previous == 'P')
+		if !isHexDigit(character) && !isHexFloatMarker(character) && !isSign {
+			stream.rewind(1)
+			break
+		}
+
+		previous = character
+	}
+
+	return string(stream.source[start:stream.position])
+}
+
+/*
+Reads the rest of a duration literal, following its leading number: units and any further numbers, such as the "h30m" of 2h30m.
+*/
+func readDurationTail(stream *lexerStream) string {
+
+	ret, _ := readUntilFalse(stream, false, true, false, isDurationCharacter)
+	return ret
+}
+
 func readTokenUntilFalse(stream *lexerStream, condition func(rune) bool) string {
 
 	var ret string
@@ -305,10 +893,11 @@ func readTokenUntilFalse(stream *lexerStream, condition func(rune) bool) string
 /*
 Returns the string that was read until the given [condition] was false, or whitespace was broken.
 Returns false if the stream ended before whitespace was broken or condition was met.
+Characters are collected in the stream's scratch buffer, so the returned string is the only allocation.
 */
 func readUntilFalse(stream *lexerStream, includeWhitespace bool, breakWhitespace bool, allowEscaping bool, condition func(rune) bool) (string, bool) {
 
-	var tokenBuffer bytes.Buffer
+	tokenBuffer := stream.scratch[:0]
 	var character rune
 	var conditioned bool
 
@@ -321,15 +910,22 @@ func readUntilFalse(stream *lexerStream, includeWhitespace bool, breakWhitespace
 		// Use backslashes to escape anything
 		if allowEscaping && character == '\\' {
 
+			// a trailing backslash has nothing to escape
+			if !stream.canRead() {
+				break
+			}
+
 			character = stream.readCharacter()
-			tokenBuffer.WriteString(string(character))
+			tokenBuffer = append(tokenBuffer, character)
 			continue
 		}
 
 		if unicode.IsSpace(character) {
 
-			if breakWhitespace && tokenBuffer.Len() > 0 {
+			if breakWhitespace && len(tokenBuffer) > 0 {
+				// leave the whitespace in the stream so it isn't counted in the token's span
 				conditioned = true
+				stream.rewind(1)
 				break
 			}
 			if !includeWhitespace {
@@ -338,7 +934,7 @@ func readUntilFalse(stream *lexerStream, includeWhitespace bool, breakWhitespace
 		}
 
 		if condition(character) {
-			tokenBuffer.WriteString(string(character))
+			tokenBuffer = append(tokenBuffer, character)
 		} else {
 			conditioned = true
 			stream.rewind(1)
@@ -346,39 +942,182 @@ func readUntilFalse(stream *lexerStream, includeWhitespace bool, breakWhitespace
 		}
 	}
 
-	return tokenBuffer.String(), conditioned
+	stream.scratch = tokenBuffer
+	return string(tokenBuffer), conditioned
+}
+
+/*
+Converts the [digits] of an integer literal in the given [base] (which may contain '_' separators) to its value.
+With PreserveIntegers (or DecimalLiterals, which replaces the value later on) this is exact, as an int64 or
+a *big.Int; otherwise it is a float64, and a literal which doesn't fit in a uint64 is an error.
+*/
+func integerValue(digits string, base int, options ParserOptions) (interface{}, error) {
+
+	digits = strings.ReplaceAll(digits, "_", "")
+
+	if options.PreserveIntegers || options.DecimalLiterals {
+		value, ok := new(big.Int).SetString(digits, base)
+		if !ok {
+			return nil, fmt.Errorf("invalid base %d integer '%s'", base, digits)
+		}
+		return preservedInteger(value), nil
+	}
+
+	value, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return nil, err
+	}
+	return float64(value), nil
+}
+
+/*
+Returns the [value] as an int64 if it fits in one, or else as it is.
+*/
+func preservedInteger(value *big.Int) interface{} {
+
+	if value.IsInt64() {
+		return value.Int64()
+	}
+	return value
+}
+
+/*
+Replaces each '-' prefix directly followed by a NUMERIC with a single NUMERIC token holding the negated value,
+spanning both. A comment between the two keeps them apart.
+*/
+func foldNegativeNumbers(tokens []ExpressionToken) []ExpressionToken {
+
+	ret := tokens[:0]
+
+	for i := 0; i < len(tokens); i++ {
+
+		token := tokens[i]
+
+		if token.Kind == PREFIX && token.Raw == "-" && i+1 < len(tokens) && tokens[i+1].Kind == NUMERIC {
+
+			if value, ok := negateNumber(tokens[i+1].Value); ok {
+				number := tokens[i+1]
+
+				token.Kind = NUMERIC
+				token.Value = value
+				token.Raw = "-" + number.Raw
+				token.End = number.End
+				token.EndByte = number.EndByte
+				token.EndUTF16 = number.EndUTF16
+				i++
+			}
+		}
+
+		ret = append(ret, token)
+	}
+	return ret
+}
+
+func negateNumber(value interface{}) (interface{}, bool) {
+
+	switch typed := value.(type) {
+	case float64:
+		return -typed, true
+	case int64:
+		return -typed, true
+	case *big.Int:
+		return preservedInteger(new(big.Int).Neg(typed)), true
+	case *big.Rat:
+		return new(big.Rat).Neg(typed), true
+	}
+	return nil, false
 }
 
 /*
-Checks the balance of tokens which have multiple parts, such as parenthesis.
+Checks the balance of tokens which have multiple parts: parenthesis, square brackets and braces.
+An unbalanced bracket is reported as a *ParseError spanning that bracket, with its offset in the message.
 */
 func checkBalance(tokens []ExpressionToken) error {
 
-	var stream *tokenStream
-	var token ExpressionToken
-	var parens int
+	var balance bracketBalance
 
-	stream = newTokenStream(tokens)
+	for _, token := range tokens {
+		if err := balance.next(token); err != nil {
+			return err
+		}
+	}
+	return balance.finish()
+}
 
-	for stream.hasNext() {
+/*
+Keeps track of the brackets opened so far, innermost last, so that closing brackets can be matched up as tokens are read.
+*/
+type bracketBalance struct {
+	open []ExpressionToken
+}
 
-		token = stream.next()
-		if token.Kind == CLAUSE {
-			parens++
-			continue
+func (b *bracketBalance) next(token ExpressionToken) error {
+
+	switch token.Kind {
+	case CLAUSE, INDEX, ARRAY, MAP:
+		b.open = append(b.open, token)
+
+	case CLAUSE_CLOSE, INDEX_CLOSE, ARRAY_CLOSE, MAP_CLOSE:
+		closing := bracketText(token.Kind)
+
+		if len(b.open) == 0 {
+			return tokenError(token, fmt.Sprintf("Unexpected '%s' at offset %d", closing, token.Start))
 		}
-		if token.Kind == CLAUSE_CLOSE {
-			parens--
-			continue
+
+		opening := b.open[len(b.open)-1]
+		if expected := bracketText(closingBracketKind(opening.Kind)); expected != closing {
+			msg := fmt.Sprintf("Mismatched '%s' at offset %d: expected '%s' to close '%s' at offset %d",
+				closing, token.Start, expected, bracketText(opening.Kind), opening.Start)
+			return tokenError(token, msg)
 		}
+		b.open = b.open[:len(b.open)-1]
 	}
+	return nil
+}
+
+/*
+Checks that every bracket has been closed, once all tokens have been read.
+The innermost bracket left open is the one reported.
+*/
+func (b *bracketBalance) finish() error {
 
-	if parens != 0 {
-		return errors.New("Unbalanced parenthesis")
+	if len(b.open) > 0 {
+		opening := b.open[len(b.open)-1]
+		return tokenError(opening, fmt.Sprintf("Unclosed '%s' at offset %d", bracketText(opening.Kind), opening.Start))
 	}
 	return nil
 }
 
+func closingBracketKind(kind TokenKind) TokenKind {
+
+	switch kind {
+	case CLAUSE:
+		return CLAUSE_CLOSE
+	case INDEX:
+		return INDEX_CLOSE
+	case ARRAY:
+		return ARRAY_CLOSE
+	}
+	return MAP_CLOSE
+}
+
+func bracketText(kind TokenKind) string {
+
+	switch kind {
+	case CLAUSE:
+		return "("
+	case CLAUSE_CLOSE:
+		return ")"
+	case INDEX, ARRAY:
+		return "["
+	case INDEX_CLOSE, ARRAY_CLOSE:
+		return "]"
+	case MAP:
+		return "{"
+	}
+	return "}"
+}
+
 func isDigit(character rune) bool {
 	return unicode.IsDigit(character)
 }
@@ -396,22 +1135,52 @@ func isHexDigit(character rune) bool {
 		character == 'f'
 }
 
+func isHexFloatMarker(character rune) bool {
+
+	return character == '.' || character == 'p' || character == 'P'
+}
+
 func isNumeric(character rune) bool {
 
 	return unicode.IsDigit(character) || character == '.'
 }
 
-func isNotQuote(character rune) bool {
+func isDigitInBase(character rune, base int) bool {
 
-	return character != '\'' && character != '"'
+	return character >= '0' && character < '0'+rune(base)
 }
 
-func isVariableName(character rune) bool {
+func isNumericOrSeparator(character rune) bool {
 
-	return unicode.IsLetter(character) ||
-		unicode.IsDigit(character) ||
-		character == '_' ||
-		character == '.'
+	return isNumeric(character) || character == '_'
+}
+
+func isHexDigitOrSeparator(character rune) bool {
+
+	return isHexDigit(character) || character == '_'
+}
+
+/*
+Returns true if every '_' digit separator in [digits] sits between two digits, as in 1_000 or FF_FF.
+*/
+func hasValidSeparators(digits string) bool {
+
+	runes := []rune(digits)
+
+	for i, character := range runes {
+		if character != '_' {
+			continue
+		}
+		if i == 0 || i == len(runes)-1 || !isHexDigit(runes[i-1]) || !isHexDigit(runes[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNotQuote(character rune) bool {
+
+	return character != '\'' && character != '"'
 }
 
 func isNotAlphanumeric(character rune) bool {
@@ -422,9 +1191,33 @@ func isNotAlphanumeric(character rune) bool {
 		character == ')' ||
 		character == '[' ||
 		character == ']' || // starting to feel like there needs to be an `isOperation` func (#59)
+		character == '{' ||
+		character == '}' ||
 		!isNotQuote(character))
 }
 
+/*
+Returns true if a '[' directly after a token of the given [kind] starts an index access
+rather than an escaped variable.
+*/
+func isIndexable(kind TokenKind) bool {
+	return kind == VARIABLE || kind == ACCESSOR || kind == INDEX_CLOSE
+}
+
+/*
+Returns true if a '[' followed by the given [character] starts an array literal rather than an escaped variable:
+that is, if the array is empty, or its first element is a number or string.
+Identifiers (including true and false) are left as escaped variables, to keep [data] working.
+*/
+func isArrayLiteralStart(character rune) bool {
+	return character == ']' ||
+		unicode.IsDigit(character) ||
+		character == '.' ||
+		character == '-' ||
+		character == '+' ||
+		!isNotQuote(character)
+}
+
 func isNotClosingBracket(character rune) bool {
 
 	return character != ']'
@@ -439,36 +1232,104 @@ func getFirstRune(candidate string) rune {
 	return 0
 }
 
+/*
+Reports whether the given [character] can start a time.Duration unit (ns, us, µs, ms, s, m, h).
+*/
+func isDurationUnit(character rune) bool {
+
+	switch character {
+	case 'n', 'u', 'µ', 'μ', 'm', 's', 'h':
+		return true
+	}
+	return false
+}
+
+func isDurationCharacter(character rune) bool {
+
+	return isDurationUnit(character) || isNumericOrSeparator(character)
+}
+
+/*
+Attempts to parse the [candidate] string as a time.Duration, such as '90s' or '1h15m'.
+A bare number (such as '0') is not treated as a duration, since it has no unit.
+*/
+func tryParseDuration(candidate string) (time.Duration, bool) {
+
+	if !strings.ContainsFunc(candidate, isDurationUnit) {
+		return 0, false
+	}
+
+	// every duration starts with a number, perhaps signed; checked first since a failed parse allocates an error
+	first := getFirstRune(candidate)
+	if !isDigit(first) && first != '.' && first != '-' && first != '+' {
+		return 0, false
+	}
+
+	ret, err := time.ParseDuration(candidate)
+	if err != nil {
+		return 0, false
+	}
+	return ret, true
+}
+
+var monthNames = [...]string{
+	"jan", "feb", "mar", "apr", "may", "jun",
+	"jul", "aug", "sep", "oct", "nov", "dec",
+}
+
+/*
+Returns true if the [candidate] has some structure that a time literal would have,
+namely a date or time separator or a month name.
+Used to keep plain numbers and words (such as '1504' or 'Monday') from becoming times.
+*/
+func hasTimeSignal(candidate string) bool {
+
+	if strings.ContainsAny(candidate, "-:/") {
+		return true
+	}
+
+	lower := strings.ToLower(candidate)
+	for _, month := range monthNames {
+		if strings.Contains(lower, month) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+The layouts string literals are tried against when ParserOptions.TimeFormats is not set.
+*/
+var DefaultTimeFormats = []string{
+	time.ANSIC,
+	time.UnixDate,
+	time.RubyDate,
+	time.Kitchen,
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02",                         // RFC 3339
+	"2006-01-02 15:04",                   // RFC 3339 with minutes
+	"2006-01-02 15:04:05",                // RFC 3339 with seconds
+	"2006-01-02 15:04:05-07:00",          // RFC 3339 with seconds and timezone
+	"2006-01-02T15Z0700",                 // ISO8601 with hour
+	"2006-01-02T15:04Z0700",              // ISO8601 with minutes
+	"2006-01-02T15:04:05Z0700",           // ISO8601 with seconds
+	"2006-01-02T15:04:05.999999999Z0700", // ISO8601 with nanoseconds
+}
+
 /*
 Attempts to parse the [candidate] as a Time.
-Tries a series of standardized date formats, returns the Time if one applies,
+Tries each of the [timeFormats] in turn, in the given [location], returns the Time for the first which applies,
 otherwise returns false through the second return.
 */
-func tryParseTime(candidate string) (time.Time, bool) {
+func tryParseTime(candidate string, timeFormats []string, location *time.Location) (time.Time, bool) {
 
 	var ret time.Time
 	var found bool
 
-	timeFormats := [...]string{
-		time.ANSIC,
-		time.UnixDate,
-		time.RubyDate,
-		time.Kitchen,
-		time.RFC3339,
-		time.RFC3339Nano,
-		"2006-01-02",                         // RFC 3339
-		"2006-01-02 15:04",                   // RFC 3339 with minutes
-		"2006-01-02 15:04:05",                // RFC 3339 with seconds
-		"2006-01-02 15:04:05-07:00",          // RFC 3339 with seconds and timezone
-		"2006-01-02T15Z0700",                 // ISO8601 with hour
-		"2006-01-02T15:04Z0700",              // ISO8601 with minutes
-		"2006-01-02T15:04:05Z0700",           // ISO8601 with seconds
-		"2006-01-02T15:04:05.999999999Z0700", // ISO8601 with nanoseconds
-	}
-
 	for _, format := range timeFormats {
 
-		ret, found = tryParseExactTime(candidate, format)
+		ret, found = tryParseExactTime(candidate, format, location)
 		if found {
 			return ret, true
 		}
@@ -477,12 +1338,12 @@ func tryParseTime(candidate string) (time.Time, bool) {
 	return time.Now(), false
 }
 
-func tryParseExactTime(candidate string, format string) (time.Time, bool) {
+func tryParseExactTime(candidate string, format string, location *time.Location) (time.Time, bool) {
 
 	var ret time.Time
 	var err error
 
-	ret, err = time.ParseInLocation(format, candidate, time.Local)
+	ret, err = time.ParseInLocation(format, candidate, location)
 	if err != nil {
 		return time.Now(), false
 	}
@@ -0,0 +1,424 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuotedDurations(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		options    ParserOptions
+		kind       TokenKind
+		value      interface{}
+	}{
+		{"5m", ParserOptions{}, DURATION, 5 * time.Minute},
+		{"2h30m", ParserOptions{}, DURATION, 150 * time.Minute},
+		{"'5m'", ParserOptions{}, STRING, "5m"},
+		{"'90s'", ParserOptions{DisableTimeLiterals: true}, STRING, "90s"},
+		{"'90s'", ParserOptions{QuotedDurations: true}, DURATION, 90 * time.Second},
+		{"'soon'", ParserOptions{QuotedDurations: true}, STRING, "soon"},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokensWithOptions(test.expression, test.options)
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if len(tokens) != 1 || tokens[0].Kind != test.kind || tokens[0].Value != test.value {
+			t.Errorf("%q with %+v lexes into %v, want one %v of %v", test.expression, test.options, tokens, test.kind, test.value)
+		}
+	}
+}
+
+func BenchmarkParseTokens(b *testing.B) {
+
+	benchmarks := []struct {
+		name       string
+		expression string
+	}{
+		{"rule", "[request.method] == 'POST' && ([status] >= 500 || [latency] > 2.5e3) && [region] in ('eu', 'us')"},
+		{"strings", "'a fairly long string literal' + \"with an \\\"escaped\\\" quote\" + 'and 5m'"},
+		{"numbers", "0x1F + 1_000_000 * 3.14159 - 2.5e-3 / 0x1.8p1"},
+		{"comments", "[a] > 1 // the first\n/* and the second */ && [b] < 2"},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			if _, err := ParseTokens(benchmark.expression, nil); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ParseTokens(benchmark.expression, nil)
+			}
+		})
+	}
+}
+
+func TestDecimalLiterals(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"0.1", "1/10"},
+		{"1_000.25", "4001/4"},
+		{"2.5e-3", "1/400"},
+		{"0x1.8p1", "3"},
+		{"0xff", "255"},
+
+		// beyond the range of a float64
+		{"1e400", "1" + strings.Repeat("0", 400)},
+		{"1e-400", "1/1" + strings.Repeat("0", 400)},
+		{"0x1p5000", new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 5000)).RatString()},
+	}
+
+	options := ParserOptions{DecimalLiterals: true}
+	for _, test := range tests {
+		tokens, err := ParseTokensWithOptions(test.expression, options)
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if len(tokens) != 1 || tokens[0].Kind != NUMERIC {
+			t.Errorf("%q lexes into %v, want one NUMERIC", test.expression, tokens)
+			continue
+		}
+
+		var value string
+		switch typed := tokens[0].Value.(type) {
+		case *big.Rat:
+			value = typed.RatString()
+		default:
+			value = fmt.Sprint(typed)
+		}
+		if value != test.want {
+			t.Errorf("%q lexes into %.40s, want %.40s", test.expression, value, test.want)
+		}
+
+		if err := CheckRoundTrip(test.expression, options, GenerateOptions{}); err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+		}
+	}
+}
+
+func TestInvalidTokenSpans(t *testing.T) {
+
+	tests := []struct {
+		expression   string
+		msg          string
+		start, end   int
+		line, column int
+	}{
+		{"a @ b", "Invalid token: '@'", 2, 3, 1, 3},
+		{"[a] + #", "Invalid token: '#'", 6, 7, 1, 7},
+		{"x ~~ 3", "Invalid token: '~~'", 2, 4, 1, 3},
+		{"a ≠ b", "Invalid token: '≠'", 2, 3, 1, 3},
+		{"[a] > 1 &&\n  @ [b]", "Invalid token: '@'", 13, 14, 2, 3},
+	}
+
+	for _, test := range tests {
+		_, err := ParseTokens(test.expression, nil)
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			t.Errorf("%q: got %T %v, want a *ParseError", test.expression, err, err)
+			continue
+		}
+		if parseError.Msg != test.msg || parseError.Start != test.start || parseError.End != test.end {
+			t.Errorf("%q: got %q at [%d, %d), want %q at [%d, %d)",
+				test.expression, parseError.Msg, parseError.Start, parseError.End, test.msg, test.start, test.end)
+		}
+		if parseError.Line != test.line || parseError.Column != test.column {
+			t.Errorf("%q: got %d:%d, want %d:%d", test.expression, parseError.Line, parseError.Column, test.line, test.column)
+		}
+	}
+}
+
+func TestSingleEquals(t *testing.T) {
+
+	_, err := ParseTokens("a = b", nil)
+
+	var parseError *ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("'a = b': got %T %v, want a *ParseError", err, err)
+	}
+	if want := "Invalid token: '='; did you mean '=='?"; parseError.Msg != want || parseError.Start != 2 || parseError.End != 3 {
+		t.Errorf("'a = b': got %q at [%d, %d), want %q at [2, 3)", parseError.Msg, parseError.Start, parseError.End, want)
+	}
+
+	tokens, err := ParseTokens("a == b", nil)
+	if err != nil {
+		t.Fatalf("'a == b': %v", err)
+	}
+	if len(tokens) != 3 || tokens[1].Kind != COMPARATOR || tokens[1].Value != "==" {
+		t.Errorf("'a == b' lexes into %v, want a COMPARATOR '==' between two variables", tokens)
+	}
+}
+
+func TestZeroAtEndOfInput(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		kinds      []TokenKind
+		values     []interface{}
+		err        string
+	}{
+		{"0", []TokenKind{NUMERIC}, []interface{}{0.0}, ""},
+		{"[a] > 0", []TokenKind{VARIABLE, COMPARATOR, NUMERIC}, []interface{}{"a", ">", 0.0}, ""},
+		{"0+1", []TokenKind{NUMERIC, MODIFIER, NUMERIC}, []interface{}{0.0, "+", 1.0}, ""},
+		{"0)", nil, nil, "Unexpected ')' at offset 1"},
+		{"0x", nil, nil, "Hex literal '0x' has no digits"},
+		{"0x+1", nil, nil, "Hex literal '0x' has no digits"},
+		{"0x1F", []TokenKind{NUMERIC}, []interface{}{31.0}, ""},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokens(test.expression, nil)
+		if test.err != "" {
+			var parseError *ParseError
+			if !errors.As(err, &parseError) || parseError.Msg != test.err {
+				t.Errorf("%q: got %v, want %q", test.expression, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+
+		var kinds []TokenKind
+		var values []interface{}
+		for _, token := range tokens {
+			kinds = append(kinds, token.Kind)
+			values = append(values, token.Value)
+		}
+		if !reflect.DeepEqual(kinds, test.kinds) || !reflect.DeepEqual(values, test.values) {
+			t.Errorf("%q lexes into %v %v, want %v %v", test.expression, kinds, values, test.kinds, test.values)
+		}
+	}
+}
+
+func TestTimeDetection(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		options    ParserOptions
+		kind       TokenKind
+	}{
+		// strings without a date or time separator, or a month name, are never tried as times
+		{"'1504'", ParserOptions{}, STRING},
+		{"'Monday'", ParserOptions{}, STRING},
+		{"'42'", ParserOptions{}, STRING},
+		{"'1504'", ParserOptions{PermissiveTimeParsing: true}, STRING},
+
+		{"'2024-01-02'", ParserOptions{}, TIME},
+		{"'2024-01-02 15:04'", ParserOptions{}, TIME},
+		{"'2024-01-02T10:00:00Z'", ParserOptions{}, TIME},
+		{"'3:04PM'", ParserOptions{}, TIME},
+		{"'2024-01-02'", ParserOptions{DisableTimeLiterals: true}, STRING},
+
+		// layouts given in TimeFormats are tried against every string
+		{"'1504'", ParserOptions{TimeFormats: []string{"1504"}}, TIME},
+		{"'2024-01-02'", ParserOptions{TimeFormats: []string{"1504"}}, STRING},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokensWithOptions(test.expression, test.options)
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if len(tokens) != 1 || tokens[0].Kind != test.kind {
+			t.Errorf("%q with %+v lexes into %v, want one %v", test.expression, test.options, tokens, test.kind)
+		}
+	}
+}
+
+func TestEndOfInput(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		msg        string
+		start, end int
+	}{
+		{"", "", 0, 0},
+		{"   ", "", 0, 0},
+		{"a \\", "Unterminated escape sequence", 2, 3},
+		{"\\", "Unterminated escape sequence", 0, 1},
+		{"'abc\\", "Unterminated escape sequence", 4, 5},
+		{"a [", "Unclosed parameter bracket", 2, 3},
+		{"[", "Unclosed parameter bracket", 0, 1},
+		{"a + [b\\", "Unclosed parameter bracket", 4, 7},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokens(test.expression, nil)
+		if test.msg == "" {
+			if err != nil || len(tokens) != 0 {
+				t.Errorf("%q: got %v %v, want no tokens", test.expression, tokens, err)
+			}
+			continue
+		}
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			t.Errorf("%q: got %T %v, want a *ParseError", test.expression, err, err)
+			continue
+		}
+		if parseError.Msg != test.msg || parseError.Start != test.start || parseError.End != test.end {
+			t.Errorf("%q: got %q at [%d, %d), want %q at [%d, %d)",
+				test.expression, parseError.Msg, parseError.Start, parseError.End, test.msg, test.start, test.end)
+		}
+	}
+}
+
+func TestUnexportedAccessors(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		segments   []string
+		err        string
+	}{
+		{"order.total > 100", nil, "Unable to access unexported field 'total' in token 'order.total'"},
+		{"a.b.C", nil, "Unable to access unexported field 'b' in token 'a.b.C'"},
+		{"order.Total > 100", []string{"order", "Total"}, ""},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokens(test.expression, nil)
+		if test.err != "" {
+			var parseError *ParseError
+			if !errors.As(err, &parseError) || parseError.Msg != test.err {
+				t.Errorf("%q: got %v, want %q", test.expression, err, test.err)
+			}
+			continue
+		}
+		if err != nil || tokens[0].Kind != ACCESSOR || !reflect.DeepEqual(tokens[0].Value, test.segments) {
+			t.Errorf("%q lexes into %v %v, want an ACCESSOR of %q", test.expression, tokens, err, test.segments)
+		}
+	}
+
+	// with AllowUnexportedAccessors, as for map-backed parameters, they are accessors like any other
+	options := ParserOptions{AllowUnexportedAccessors: true}
+	for _, test := range []struct {
+		expression string
+		value      interface{}
+	}{
+		{"order.total > 100", []string{"order", "total"}},
+		{"a.b.C", []string{"a", "b", "C"}},
+		{"order?.total", OptionalAccessor{Segments: []string{"order", "total"}, NilSafe: []bool{false, true}}},
+	} {
+		tokens, err := ParseTokensWithOptions(test.expression, options)
+		if err != nil || tokens[0].Kind != ACCESSOR || !reflect.DeepEqual(tokens[0].Value, test.value) {
+			t.Errorf("%q with AllowUnexportedAccessors lexes into %v %v, want an ACCESSOR of %v", test.expression, tokens, err, test.value)
+		}
+
+		tree, err := NewParser(tokens).Parse()
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if generated := (Formatter{MaxWidth: -1}).Format(tree); !strings.HasPrefix(generated, strings.Fields(test.expression)[0]) {
+			t.Errorf("%q generates %q, which doesn't start with the accessor as written", test.expression, generated)
+		}
+		if err := CheckRoundTrip(test.expression, options, GenerateOptions{}); err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+		}
+	}
+}
+
+func TestHexFloats(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		value      float64
+		err        string
+	}{
+		{"0x1.8p3", 12, ""},
+		{"0x1p-2", 0.25, ""},
+		{"0x1.8P+1", 3, ""},
+		{"0xA.8p0", 10.5, ""},
+		{"0x1_0p0", 16, ""},
+		{"0xFF", 255, ""},
+
+		// the binary exponent can't be left out, or be empty
+		{"0x1.p", 0, "Unable to parse hex float value '0x1.p' to float64"},
+		{"0x1.8", 0, "Unable to parse hex float value '0x1.8' to float64"},
+		{"0x1p", 0, "Unable to parse hex float value '0x1p' to float64"},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokens(test.expression, nil)
+		if test.err != "" {
+			var parseError *ParseError
+			if !errors.As(err, &parseError) || parseError.Msg != test.err || parseError.Start != 0 || parseError.End != len(test.expression) {
+				t.Errorf("%q: got %v, want %q over the whole literal", test.expression, err, test.err)
+			}
+			continue
+		}
+		if err != nil || len(tokens) != 1 || tokens[0].Kind != NUMERIC || tokens[0].Value != test.value {
+			t.Errorf("%q lexes into %v %v, want one NUMERIC of %v", test.expression, tokens, err, test.value)
+		}
+	}
+}
+
+func TestInvisibleCharacters(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		raws       []string
+		starts     []int
+		err        string
+		start      int
+	}{
+		// a leading byte order mark is skipped, though offsets still count it
+		{"\uFEFFa + b", []string{"a", "+", "b"}, []int{1, 3, 5}, "", 0},
+		{"\uFEFF", nil, nil, "", 0},
+
+		// non-breaking and other unicode spaces separate tokens, and are kept within strings
+		{"a\u00A0+ b", []string{"a", "+", "b"}, []int{0, 2, 4}, "", 0},
+		{"a\u2003+ b", []string{"a", "+", "b"}, []int{0, 2, 4}, "", 0},
+		{"'x\u00A0y'", []string{"x\u00A0y"}, []int{0}, "", 0},
+
+		// anywhere else, invisible characters are an error
+		{"a + b\uFEFF", nil, nil, "Invisible character U+FEFF is not allowed in expressions", 5},
+		{"\uFEFF\uFEFFa", nil, nil, "Invisible character U+FEFF is not allowed in expressions", 1},
+		{"a\u200B+ b", nil, nil, "Invisible character U+200B is not allowed in expressions", 1},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokens(test.expression, nil)
+		if test.err != "" {
+			var parseError *ParseError
+			if !errors.As(err, &parseError) || parseError.Msg != test.err || parseError.Start != test.start || parseError.End != test.start+1 {
+				t.Errorf("%q: got %v, want %q at %d", test.expression, err, test.err, test.start)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+
+		var raws []string
+		var starts []int
+		for _, token := range tokens {
+			raws = append(raws, token.Raw)
+			starts = append(starts, token.Start)
+		}
+		if !reflect.DeepEqual(raws, test.raws) || !reflect.DeepEqual(starts, test.starts) {
+			t.Errorf("%q lexes into %q at %v, want %q at %v", test.expression, raws, starts, test.raws, test.starts)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package parser
+
+// Binding levels of the binary operators, from loosest to tightest.
+// These mirror the order in which govaluate plans its evaluation stages.
+// They are spaced apart, so that PrecedenceTable overrides and registered operators can sit between them.
+const (
+	pipelinePrecedence = (iota + 1) * 10
+	ternaryPrecedence
+	logicalOrPrecedence
+	logicalAndPrecedence
+	comparatorPrecedence
+	bitwisePrecedence
+	bitwiseShiftPrecedence
+	additivePrecedence
+	multiplicativePrecedence
+	exponentialPrecedence
+)
+
+// The same binding levels, for operators added with RegisterOperator and for PrecedenceTable overrides.
+const (
+	PRECEDENCE_LOGICAL_OR     = logicalOrPrecedence
+	PRECEDENCE_LOGICAL_AND    = logicalAndPrecedence
+	PRECEDENCE_COMPARATOR     = comparatorPrecedence
+	PRECEDENCE_BITWISE        = bitwisePrecedence
+	PRECEDENCE_BITWISE_SHIFT  = bitwiseShiftPrecedence
+	PRECEDENCE_ADDITIVE       = additivePrecedence
+	PRECEDENCE_MULTIPLICATIVE = multiplicativePrecedence
+	PRECEDENCE_EXPONENTIAL    = exponentialPrecedence
+)
+
+/*
+Precedence reports the binding level of an operator token, as used by the Parser when grouping
+binary expressions: a higher level binds tighter. rightAssoc is true for operators that group
+from the right (ternaries and '**'). ok is false for tokens that are not binary operators.
+*/
+func Precedence(token ExpressionToken) (level int, rightAssoc bool, ok bool) {
+
+	if operator, found := customOperator(&token); found && operator.Kind != PREFIX {
+		return operator.Precedence, operator.RightAssoc, true
+	}
+
+	switch token.Kind {
+	case PIPELINE:
+		return pipelinePrecedence, false, true
+	case TERNARY, NULL_COALESCE, ELVIS:
+		return ternaryPrecedence, true, true
+	case LOGICALOP:
+		if logicalSymbols[token.Symbol()] == OR {
+			return logicalOrPrecedence, false, true
+		}
+		return logicalAndPrecedence, false, true
+	case COMPARATOR, BETWEEN, LIKE:
+		return comparatorPrecedence, false, true
+	case MODIFIER:
+		return modifierPrecedence(token.Raw)
+	}
+
+	return 0, false, false
+}
+
+func modifierPrecedence(symbol string) (int, bool, bool) {
+
+	if _, found := bitwiseSymbols[symbol]; found {
+		return bitwisePrecedence, false, true
+	}
+	if _, found := bitwiseShiftSymbols[symbol]; found {
+		return bitwiseShiftPrecedence, false, true
+	}
+	if _, found := additiveSymbols[symbol]; found {
+		return additivePrecedence, false, true
+	}
+	if _, found := multiplicativeSymbols[symbol]; found {
+		return multiplicativePrecedence, false, true
+	}
+	if _, found := exponentialSymbolsS[symbol]; found {
+		return exponentialPrecedence, true, true
+	}
+
+	return 0, false, false
+}
+
+/*
+Overrides the binding level of binary operators, keyed by their symbol (such as "&", or "&&" for a textual 'and'),
+for expressions written for engines whose precedence differs from govaluate's. Levels are on the same scale as
+the PRECEDENCE_ constants; for instance, PRECEDENCE_COMPARATOR - 5 makes '&' bind looser than '==', as it does in C.
+*/
+type PrecedenceTable map[string]PrecedenceLevel
+
+/*
+The binding level of one operator in a PrecedenceTable.
+*/
+type PrecedenceLevel struct {
+	Level      int
+	RightAssoc bool
+}
+
+/*
+Returns the binding level of [token] as the Parser sees it, taking its PrecedenceTable into account.
+*/
+func (p *Parser) precedenceOf(token *ExpressionToken) (int, bool, bool) {
+
+	level, rightAssoc, ok := Precedence(*token)
+	if !ok {
+		return level, rightAssoc, ok
+	}
+
+	if override, found := p.options.Precedence[token.Symbol()]; found {
+		return override.Level, override.RightAssoc, true
+	}
+	return level, rightAssoc, ok
+}
+
+/*
+StandardizePrecedence returns a copy of the [ast] with parenthesis (CLAUSE nodes) added wherever its grouping
+differs from what the standard precedence would give, such as a tree built by a Parser with a PrecedenceTable.
+Generating the copy then gives an expression which means the same under the standard rules.
+*/
+func StandardizePrecedence(ast *ASTNode) *ASTNode {
+
+	ret := ast.Clone()
+	addParentheses(ret)
+	return ret
+}
+
+func addParentheses(node *ASTNode) {
+
+	for _, child := range node.Children {
+		addParentheses(child)
+	}
+
+	if node.Token.Kind == PREFIX {
+		// prefix operators only ever take a single operand
+		if operatorLevel(node.Children[0]) != 0 {
+			node.Children[0] = parenthesize(node.Children[0])
+		}
+		return
+	}
+
+	level := operatorLevel(node)
+	if level == 0 {
+		return
+	}
+	_, rightAssoc, _ := Precedence(*node.Token)
+
+	switch {
+	case node.Piped:
+		// the piped value is the first argument
+		wrapOperand(node, 0, level, false, true)
+	case node.Token.Kind == TERNARY:
+		// the true branch is closed by ':', so it never needs parenthesis
+		wrapOperand(node, 0, level, true, true)
+		wrapOperand(node, 2, level, true, false)
+	case node.Token.Kind == BETWEEN:
+		// the bounds bind tighter than the comparison itself
+		wrapOperand(node, 0, level, false, true)
+		wrapOperand(node, 1, level, false, false)
+		wrapOperand(node, 2, level, false, false)
+	default:
+		wrapOperand(node, 0, level, rightAssoc, true)
+		wrapOperand(node, 1, level, rightAssoc, false)
+	}
+}
+
+/*
+Wraps the [index]th child of [node] in parenthesis, if the standard precedence would otherwise group it differently.
+*/
+func wrapOperand(node *ASTNode, index int, level int, rightAssoc bool, left bool) {
+
+	if index >= len(node.Children) {
+		return
+	}
+
+	child := node.Children[index]
+	childLevel := operatorLevel(child)
+	if childLevel == 0 {
+		return
+	}
+
+	if childLevel < level || (childLevel == level && left == rightAssoc) {
+		node.Children[index] = parenthesize(child)
+	}
+}
+
+/*
+Returns the standard binding level of the operator at [node], or 0 if it isn't a binary (or ternary) operation.
+*/
+func operatorLevel(node *ASTNode) int {
+
+	if node.Piped {
+		return pipelinePrecedence
+	}
+	if node.Token.Kind == TERNARY {
+		return ternaryPrecedence
+	}
+
+	level, _, ok := Precedence(*node.Token)
+	if !ok || len(node.Children) < 2 {
+		return 0
+	}
+	return level
+}
+
+func parenthesize(node *ASTNode) *ASTNode {
+
+	// the parenthesis take the position of the operator they group
+	token := *node.Token
+	token.Kind = CLAUSE
+	token.Value = '('
+	token.Raw = "("
+
+	clause := newASTNode(&token)
+	clause.Children = append(clause.Children, node)
+	return clause
+}
+
+/*
+Returns a copy of the [ast] for PARENTHESES_EXPLICIT, with parentheses around each operand of a logical or arithmetic
+operation which is itself one of the same kind at a different level, such as the b * c of a + b * c
+or the a && b of a && b || c, so that its grouping reads without knowing the precedence.
+The parentheses the standard precedence needs are added as StandardizePrecedence adds them.
+*/
+func withExplicitParentheses(ast *ASTNode) *ASTNode {
+
+	ret := StandardizePrecedence(ast)
+	addExplicitParentheses(ret)
+	return ret
+}
+
+func addExplicitParentheses(node *ASTNode) {
+
+	for _, child := range node.Children {
+		addExplicitParentheses(child)
+	}
+
+	kind := node.Token.Kind
+	level := operatorLevel(node)
+	if node.Piped || level == 0 || (kind != LOGICALOP && kind != MODIFIER) {
+		return
+	}
+
+	for i, child := range node.Children {
+		childLevel := operatorLevel(child)
+		if child.Token.Kind == kind && !child.Piped && childLevel != 0 && childLevel != level {
+			node.Children[i] = parenthesize(child)
+		}
+	}
+}
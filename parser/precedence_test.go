@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+/*
+Writes a tree as an s-expression, such as (* (== a (paren (+ b c))) 2), to show how it is grouped.
+*/
+func sexpr(node *ASTNode) string {
+
+	if node == nil || node.Token == nil {
+		return "nil"
+	}
+
+	name := node.Token.Symbol()
+	switch node.Token.Kind {
+	case CLAUSE:
+		name = "paren"
+	case ARRAY:
+		name = "list"
+	}
+	if len(node.Children) == 0 {
+		return name
+	}
+
+	parts := []string{name}
+	for _, child := range node.Children {
+		parts = append(parts, sexpr(child))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func precedenceOf(t *testing.T, expression string) (int, bool, bool) {
+	t.Helper()
+
+	tokens, err := ParseTokens(expression, nil)
+	if err != nil {
+		t.Fatalf("%q: %v", expression, err)
+	}
+	return Precedence(tokens[1])
+}
+
+func TestPrecedence(t *testing.T) {
+
+	tighter := []struct {
+		tight, loose string
+	}{
+		{"a * b", "a + b"},
+		{"a ** b", "a * b"},
+		{"a + b", "a == b"},
+		{"a == b", "a && b"},
+		{"a && b", "a || b"},
+		{"a || b", "a ? b : c"},
+	}
+
+	for _, test := range tighter {
+		tight, _, ok := precedenceOf(t, test.tight)
+		loose, _, ok2 := precedenceOf(t, test.loose)
+		if !ok || !ok2 || tight <= loose {
+			t.Errorf("the operator of %q should bind tighter than that of %q, got levels %d and %d", test.tight, test.loose, tight, loose)
+		}
+	}
+
+	for expression, want := range map[string]bool{"a ** b": true, "a ? b : c": true, "a - b": false, "a || b": false} {
+		if _, rightAssoc, _ := precedenceOf(t, expression); rightAssoc != want {
+			t.Errorf("the operator of %q has rightAssoc %v, want %v", expression, rightAssoc, want)
+		}
+	}
+
+	tokens, _ := ParseTokens("[a]", nil)
+	if _, _, ok := Precedence(tokens[0]); ok {
+		t.Errorf("a VARIABLE has a precedence")
+	}
+}
+
+func TestParseGroupsByPrecedence(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"a + b * c", "(+ a (* b c))"},
+		{"a * b + c", "(+ (* a b) c)"},
+		{"a - b - c", "(- (- a b) c)"},
+		{"a ** b ** c", "(** a (** b c))"},
+		{"a || b && c", "(|| a (&& b c))"},
+		{"a == b + c", "(== a (+ b c))"},
+
+		// parentheses after a comparator group, and the expression goes on after them
+		{"a == (b + c) * 2", "(== a (* (paren (+ b c)) 2))"},
+		{"a == (b) && c", "(&& (== a (paren b)) c)"},
+		{"a < (b - c) + d", "(< a (+ (paren (- b c)) d))"},
+
+		// unless they hold a list
+		{"a in (1, 2) && c", "(&& (in a (list 1 2)) c)"},
+		{"a in ()", "(in a list)"},
+		{"a in (1)", "(in a (paren 1))"},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokens(test.expression, nil)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+		tree, err := NewParser(tokens).Parse()
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if got := sexpr(tree); got != test.want {
+			t.Errorf("%q parses into %s, want %s", test.expression, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"context"
+	"strings"
+)
+
+/*
+ParseProgram tokenizes several expressions separated by semicolons, returning one token stream per statement.
+Only top-level semicolons split statements; those inside string literals, escaped variables or parenthesis do not.
+Empty statements (such as the one after a trailing semicolon) are skipped.
+Token and error positions, including lines and columns, are relative to the whole [expression], not to the statement.
+The limits in ParserOptions apply to the whole program: MaxLength to the whole [expression] and MaxTokens to the
+tokens of all of its statements together, while MaxDepth applies to each statement, since they can't nest.
+*/
+func ParseProgram(expression string, functions map[string]ExpressionFunction) ([][]ExpressionToken, error) {
+	return ParseProgramWithOptions(expression, ParserOptions{Functions: functions})
+}
+
+/*
+ParseProgramWithOptions is ParseProgram, tokenizing every statement with the given [options].
+*/
+func ParseProgramWithOptions(expression string, options ParserOptions) ([][]ExpressionToken, error) {
+
+	var ret [][]ExpressionToken
+
+	// the whole program, for working out lines and columns
+	program := newLexerStream(expression)
+
+	if err := checkLength(program, 0, options); err != nil {
+		return nil, err
+	}
+
+	// tokens are counted across all of the statements
+	var limits limitCounter
+
+	for _, statement := range splitStatements(program.source) {
+
+		source := string(statement.source)
+		if strings.TrimSpace(source) == "" {
+			continue
+		}
+
+		tokens, err := lexTokens(context.Background(), newLexerStream(source), options, &limits)
+		if err != nil {
+			if parseErr := parseErrorOf(err); parseErr != nil {
+				parseErr.Start += statement.offset
+				parseErr.End += statement.offset
+				parseErr.locate(program)
+			}
+			return ret, err
+		}
+
+		shiftTokens(tokens, statement.offset)
+		locateTokens(tokens, program)
+		ret = append(ret, tokens)
+	}
+
+	return ret, nil
+}
+
+type statement struct {
+	source []rune
+	offset int
+}
+
+/*
+Splits the [source] on semicolons which are not nested inside quotes, brackets or parenthesis.
+*/
+func splitStatements(source []rune) []statement {
+
+	var ret []statement
+	var quote rune
+	var depth int
+	var start int
+
+	for i := 0; i < len(source); i++ {
+
+		character := source[i]
+
+		// skip over escaped characters, the same as readUntilFalse does
+		if character == '\\' {
+			i++
+			continue
+		}
+
+		// skip over comments, which may contain quotes and semicolons of their own
+		if quote == 0 && character == '/' && i+1 < len(source) && (source[i+1] == '/' || source[i+1] == '*') {
+			i = skipComment(source, i)
+			continue
+		}
+
+		if quote != 0 {
+			if character == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch character {
+		case '\'', '"':
+			quote = character
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ';':
+			if depth == 0 {
+				ret = append(ret, statement{source: source[start:i], offset: start})
+				start = i + 1
+			}
+		}
+	}
+
+	return append(ret, statement{source: source[start:], offset: start})
+}
+
+/*
+Returns the index of the last character of the comment starting at [start].
+*/
+func skipComment(source []rune, start int) int {
+
+	block := source[start+1] == '*'
+
+	for i := start + 2; i < len(source); i++ {
+		if !block && source[i] == '\n' {
+			return i - 1
+		}
+		if block && source[i] == '/' && source[i-1] == '*' && i > start+2 {
+			return i
+		}
+	}
+
+	return len(source) - 1
+}
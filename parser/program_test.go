@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseProgramLimits(t *testing.T) {
+
+	tests := []struct {
+		program string
+		options ParserOptions
+		limit   string
+		start   int
+	}{
+		// each statement is within the limits, but the program as a whole isn't
+		{"[a] + 1; [b] + 2", ParserOptions{MaxLength: 10}, LIMIT_LENGTH, 10},
+		{"[a] + 1; [b] + 2", ParserOptions{MaxTokens: 4}, LIMIT_TOKENS, 13},
+		{"[a] + 1; [b] + 2; [c]", ParserOptions{MaxTokens: 6}, LIMIT_TOKENS, 18},
+		{"([a]); (([b]))", ParserOptions{MaxDepth: 1}, LIMIT_DEPTH, 8},
+
+		{"[a] + 1; [b] + 2", ParserOptions{MaxLength: 16, MaxTokens: 6, MaxDepth: 1}, "", 0},
+		{"([a]); ([b])", ParserOptions{MaxDepth: 1}, "", 0},
+	}
+
+	for _, test := range tests {
+		_, err := ParseProgramWithOptions(test.program, test.options)
+
+		if test.limit == "" {
+			if err != nil {
+				t.Errorf("%q: %v", test.program, err)
+			}
+			continue
+		}
+
+		var limitErr *LimitExceededError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("%q: got %v, want a %s limit", test.program, err, test.limit)
+			continue
+		}
+		if limitErr.Limit != test.limit || limitErr.Start != test.start {
+			t.Errorf("%q: got the %s limit at %d, want %s at %d",
+				test.program, limitErr.Limit, limitErr.Start, test.limit, test.start)
+		}
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+
+	tests := []struct {
+		program    string
+		statements [][]string
+	}{
+		{"[a] + 1; [b] > 2", [][]string{{"a", "+", "1"}, {"b", ">", "2"}}},
+		{"[a] + 1;", [][]string{{"a", "+", "1"}}},
+		{"[a];;[b]", [][]string{{"a"}, {"b"}}},
+		{"", nil},
+
+		// a ';' inside a string or comment doesn't end the statement
+		{"'a;b' == [c]", [][]string{{"a;b", "==", "c"}}},
+		{"[a] == 'x;y'; [b]", [][]string{{"a", "==", "x;y"}, {"b"}}},
+		{"[a] // x; y\n; [b]", [][]string{{"a"}, {"b"}}},
+	}
+
+	for _, test := range tests {
+		statements, err := ParseProgram(test.program, nil)
+		if err != nil {
+			t.Errorf("%q: %v", test.program, err)
+			continue
+		}
+
+		var got [][]string
+		for _, statement := range statements {
+			var raws []string
+			for _, token := range statement {
+				raws = append(raws, token.Raw)
+			}
+			got = append(got, raws)
+		}
+		if !reflect.DeepEqual(got, test.statements) {
+			t.Errorf("%q parses into %q, want %q", test.program, got, test.statements)
+		}
+	}
+
+	// positions are offsets within the whole program
+	statements, err := ParseProgram("[a] + 1; [b] > 2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start := statements[1][0].Start; start != 9 {
+		t.Errorf("the second statement starts at %d, want 9", start)
+	}
+
+	// a ';' inside parentheses doesn't split the program, and is an error within its statement
+	if _, err := ParseProgram("(a; b)", nil); err == nil {
+		t.Error("'(a; b)': got no error")
+	}
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"unicode"
+)
+
+/*
+ParseTokensWithRecovery tokenizes the expression like ParseTokensWithOptions, but doesn't stop at the first error.
+After each invalid token it skips ahead to the next plausible token boundary (whitespace, a bracket or a separator)
+and carries on, so that every syntax error in the expression is reported in one pass.
+
+Returns the tokens which could be read, and all errors in the order they were found; the errors are nil if there were none.
+*/
+func ParseTokensWithRecovery(expression string, options ParserOptions) ([]ExpressionToken, []ParseError) {
+
+	var ret []ExpressionToken
+	var errs []ParseError
+
+	stream := newLexerStream(expression)
+	state := validLexerStates[0]
+
+	// nothing more is read from an expression that is too long
+	if err := checkLength(stream, 0, options); err != nil {
+		return nil, []ParseError{*parseErrorOf(err)}
+	}
+
+	var limits limitCounter
+
+	for stream.canRead() {
+
+		start := stream.position
+		token, err, found := readToken(stream, state, options)
+
+		if err != nil {
+			parseErr := parseErrorOf(toParseError(err, token.Start, token.End, stream))
+			errs = append(errs, *parseErr)
+
+			// an error inside a string literal (such as a bad escape) skips the rest of the string
+			resume := max(parseErr.End, start+1)
+			if quote := stream.source[token.Start]; !isNotQuote(quote) {
+				resume = skipPastQuote(stream, resume, quote)
+			}
+
+			skipToTokenBoundary(stream, resume)
+			continue
+		}
+
+		if !found {
+			break
+		}
+
+		stream.locate(&token)
+
+		if token.Kind == COMMENT {
+			if options.KeepComments {
+				ret = append(ret, token)
+			}
+			continue
+		}
+
+		state, err = getLexerStateForToken(token)
+		if err != nil {
+			errs = append(errs, *parseErrorOf(toParseError(err, token.Start, token.End, stream)))
+			continue
+		}
+
+		// nor from one with too many tokens, or nested too deeply
+		if err = limits.add(token, stream, options); err != nil {
+			errs = append(errs, *parseErrorOf(err))
+			return ret, errs
+		}
+
+		ret = append(ret, token)
+	}
+
+	if err := checkBalance(ret); err != nil {
+		errs = append(errs, *parseErrorOf(toParseError(err, 0, 0, stream)))
+	}
+
+	if err := compilePatterns(ret); err != nil {
+		errs = append(errs, *parseErrorOf(toParseError(err, 0, stream.length, stream)))
+	}
+
+	if options.FoldNegativeNumbers {
+		ret = foldNegativeNumbers(ret)
+	}
+
+	return ret, errs
+}
+
+/*
+Moves the stream to [position], and then on past the rest of whatever word it landed in.
+*/
+func skipToTokenBoundary(stream *lexerStream, position int) {
+
+	stream.position = min(position, stream.length)
+
+	for stream.canRead() && !isTokenBoundary(stream.source[stream.position]) {
+		stream.position++
+	}
+}
+
+/*
+Returns the position just after the first unescaped [quote] at or after [position], or the end of the stream.
+*/
+func skipPastQuote(stream *lexerStream, position int, quote rune) int {
+
+	for i := position; i < stream.length; i++ {
+		switch stream.source[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return stream.length
+}
+
+func isTokenBoundary(character rune) bool {
+
+	switch character {
+	case '(', ')', '[', ']', '{', '}', ',':
+		return true
+	}
+	return unicode.IsSpace(character)
+}
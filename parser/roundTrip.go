@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"fmt"
+)
+
+/*
+Returned by CheckRoundTrip when the code generated for an expression doesn't parse back into the same tree.
+*/
+type RoundTripError struct {
+
+	// the expression which was checked, and the code generated for it
+	Expression string
+	Generated  string
+
+	// the error from tokenizing or parsing the generated code, or nil if it parsed into a different tree
+	Err error
+}
+
+func (err *RoundTripError) Error() string {
+
+	if err.Err != nil {
+		return fmt.Sprintf("Generated code '%s' for '%s' doesn't parse: %v", err.Generated, err.Expression, err.Err)
+	}
+	return fmt.Sprintf("Generated code '%s' for '%s' parses into a different tree", err.Generated, err.Expression)
+}
+
+func (err *RoundTripError) Unwrap() error {
+	return err.Err
+}
+
+/*
+CheckRoundTrip parses [expression] with the given [options], generates code for it with [generate],
+and checks that the generated code parses back into an equal tree, as compared by Equal.
+Generate must uphold this for every expression which parses, so that formatting an expression never changes its meaning.
+An argument passed by name to the parameter in its position is the same as one passed by position,
+and ARGUMENTS_POSITIONAL and ARGUMENTS_NAMED write named arguments in the order of the parameters,
+so trees which differ only in that are equal, as are trees which differ only in parentheses their grouping doesn't need
+when Minify or a Parentheses style other than PARENTHESES_AS_WRITTEN is set; but a TimeFormat which leaves out part of a time,
+such as "2006-01-02", or time.RFC3339 for a time with fractional seconds, does change the tree.
+
+Returns the error from parsing [expression] if it doesn't parse, or a *RoundTripError if the round trip fails.
+*/
+func CheckRoundTrip(expression string, options ParserOptions, generate GenerateOptions) error {
+
+	ast, err := parseAST(expression, options)
+	if err != nil {
+		return err
+	}
+
+	generated := ast.GenerateWithOptions(generate)
+
+	reparsed, err := parseAST(generated, options)
+	if err != nil {
+		return &RoundTripError{Expression: expression, Generated: generated, Err: err}
+	}
+
+	if generate.ArgumentStyle != ARGUMENTS_AS_WRITTEN {
+		ast = withBoundArguments(ast)
+	}
+	equal := Equal
+	if generate.Parentheses != PARENTHESES_AS_WRITTEN || generate.Minify {
+		equal = equalIgnoringParentheses
+	}
+	if !equal(positionalArguments(ast), positionalArguments(reparsed)) {
+		return &RoundTripError{Expression: expression, Generated: generated}
+	}
+	return nil
+}
+
+func parseAST(expression string, options ParserOptions) (*ASTNode, error) {
+
+	tokens, err := ParseTokensWithOptions(expression, options)
+	if err != nil {
+		return nil, err
+	}
+	return NewParser(tokens).Parse()
+}
+
+/*
+Replaces the named arguments in the [ast] which are passed in the position of their parameter with their values,
+as ARGUMENTS_POSITIONAL outputs them.
+*/
+func positionalArguments(ast *ASTNode) *ASTNode {
+
+	if ast.Token != nil && ast.Token.Kind == FUNCTION {
+		parameters := functionParameters(ast.Token)
+		for i, child := range ast.Children {
+			if child.Token.Kind == NAMED_ARGUMENT && ast.isInPosition(i, parameters) {
+				ast.Children[i] = child.Children[0]
+			}
+		}
+	}
+
+	for _, child := range ast.Children {
+		positionalArguments(child)
+	}
+	return ast
+}
@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func FuzzCheckRoundTrip(f *testing.F) {
+
+	for _, expression := range readCorpus(f, "harden.txt") {
+		f.Add(expression)
+	}
+	f.Add("'2024-01-02T10:00:00.5Z' > [t]")
+	f.Add("[t] between '2024-01-02T10:00:00.123456789+02:00' and '2024-01-03'")
+
+	f.Fuzz(func(t *testing.T, expression string) {
+
+		for _, options := range []GenerateOptions{{}, {KeepPipelines: true}, {OperatorStyle: OPERATORS_TEXTUAL}} {
+			err := CheckRoundTrip(expression, ParserOptions{}, options)
+			var roundTrip *RoundTripError
+			if errors.As(err, &roundTrip) {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+
+	tests := []string{
+		"[a] ? 'b' : 3",
+		"[a] + [b] * 2 - -[c]",
+		"order.Total > 100",
+		"[t] > '2024-01-02'",
+		"[t] > '2024-01-02T10:00:00.5Z'",
+		"[t] < '2024-01-02T10:00:00.000000001+05:30'",
+		"[d] > 1h30m",
+		"[a] ?? [b] ?: [c]",
+		"[xs] |> filter(x -> x > 1)",
+		"([a] && [b]) || ([c])",
+	}
+
+	options := ParserOptions{Functions: map[string]ExpressionFunction{"filter": {Name: "filter"}}}
+	for _, expression := range tests {
+		for _, generate := range []GenerateOptions{{}, {KeepPipelines: true}, {Minify: true}, {Parentheses: PARENTHESES_MINIMAL}, {Parentheses: PARENTHESES_EXPLICIT}} {
+			if err := CheckRoundTrip(expression, options, generate); err != nil {
+				t.Errorf("%q with %+v: %v", expression, generate, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+Maps the span of a token in generated code back to the span of the token it was generated from.
+Both spans are offsets in characters (runes), as Start and End of an ExpressionToken are.
+*/
+type SourceMapping struct {
+
+	// the span of the token in the generated code
+	GeneratedStart int
+	GeneratedEnd   int
+
+	// the span of the token in the expression the tree was parsed from
+	Start int
+	End   int
+}
+
+func (mapping SourceMapping) String() string {
+	return fmt.Sprintf("[%d, %d) -> [%d, %d)", mapping.GeneratedStart, mapping.GeneratedEnd, mapping.Start, mapping.End)
+}
+
+/*
+A SourceMap maps generated code back to the expression it was generated from, one token at a time,
+in the order of the tokens in the generated code.
+*/
+type SourceMap []SourceMapping
+
+/*
+Source returns the span of the original expression which the span [start, end) of the generated code was generated from,
+so that a diagnostic reported on formatted code by another tool can be shown on the expression as the user wrote it.
+It is the smallest span covering each token the generated span overlaps, or that containing [start] if the span is empty.
+Returns false if the span only covers code with no token of its own in the original expression,
+such as whitespace, a closing parenthesis, or the name added to an argument by ARGUMENTS_NAMED.
+*/
+func (sourceMap SourceMap) Source(start, end int) (int, int, bool) {
+
+	retStart, retEnd, found := 0, 0, false
+
+	for _, mapping := range sourceMap {
+
+		overlaps := mapping.GeneratedStart < end && start < mapping.GeneratedEnd
+		if start == end {
+			overlaps = mapping.GeneratedStart <= start && start < mapping.GeneratedEnd
+		}
+		if !overlaps {
+			continue
+		}
+
+		if !found || mapping.Start < retStart {
+			retStart = mapping.Start
+		}
+		if !found || mapping.End > retEnd {
+			retEnd = mapping.End
+		}
+		found = true
+	}
+
+	return retStart, retEnd, found
+}
+
+/*
+GenerateWithSourceMap generates code for the tree as GenerateWithOptions does,
+along with a SourceMap from the tokens of the generated code back to those of the tree.
+
+The map is built by parsing the generated code, which Generate guarantees gives back the same tree (see CheckRoundTrip),
+and pairing each of its tokens with the token of the tree in the same place. The functions the tree calls are
+parsed as such again; tokens of the tree which have no position, such as those of a tree built by hand, aren't mapped.
+Returns an error, along with the code, if the generated code doesn't parse back into the same tree.
+*/
+func (ast *ASTNode) GenerateWithSourceMap(options GenerateOptions) (string, SourceMap, error) {
+
+	generated := ast.GenerateWithOptions(options)
+
+	functions := map[string]ExpressionFunction{}
+	collectFunctions(ast, functions)
+
+	reparsed, err := parseAST(generated, ParserOptions{Functions: functions})
+	if err != nil {
+		return generated, nil, &RoundTripError{Expression: ast.Generate(), Generated: generated, Err: err}
+	}
+
+	// ARGUMENTS_POSITIONAL and ARGUMENTS_NAMED write named arguments in the order of the parameters
+	source := ast
+	if options.ArgumentStyle != ARGUMENTS_AS_WRITTEN {
+		source = withBoundArguments(ast.Clone())
+	}
+
+	var ret SourceMap
+	if !mapTokens(source, reparsed, &ret) {
+		return generated, nil, &RoundTripError{Expression: ast.Generate(), Generated: generated}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].GeneratedStart < ret[j].GeneratedStart
+	})
+	return generated, ret, nil
+}
+
+/*
+Adds to [sourceMap] the span of each token of the [generated] tree, paired with the token in the same place in [source].
+Reports false if the trees don't have the same shape.
+*/
+func mapTokens(source *ASTNode, generated *ASTNode, sourceMap *SourceMap) bool {
+
+	if source == nil || generated == nil || source.Token == nil || generated.Token == nil {
+		return source == generated
+	}
+
+	// ARGUMENTS_POSITIONAL and ARGUMENTS_NAMED add or remove the name of an argument, which has nothing to map to
+	if source.Token.Kind == NAMED_ARGUMENT && generated.Token.Kind != NAMED_ARGUMENT {
+		return mapTokens(source.Children[0], generated, sourceMap)
+	}
+	if generated.Token.Kind == NAMED_ARGUMENT && source.Token.Kind != NAMED_ARGUMENT {
+		return mapTokens(source, generated.Children[0], sourceMap)
+	}
+
+	if source.Token.Kind != generated.Token.Kind || len(source.Children) != len(generated.Children) {
+		return false
+	}
+
+	if source.Token.End > source.Token.Start && generated.Token.End > generated.Token.Start {
+		*sourceMap = append(*sourceMap, SourceMapping{
+			GeneratedStart: generated.Token.Start,
+			GeneratedEnd:   generated.Token.End,
+			Start:          source.Token.Start,
+			End:            source.Token.End,
+		})
+	}
+
+	for i := range source.Children {
+		if !mapTokens(source.Children[i], generated.Children[i], sourceMap) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Adds the functions called within the tree to [functions], so that code generated for it can be parsed with them.
+*/
+func collectFunctions(ast *ASTNode, functions map[string]ExpressionFunction) {
+
+	if ast.Token != nil && ast.Token.Kind == FUNCTION {
+		function, ok := ast.Token.Value.(ExpressionFunction)
+		if !ok {
+			function = ExpressionFunction{Name: ast.Token.Raw}
+		}
+		functions[ast.Token.Raw] = function
+	}
+
+	for _, child := range ast.Children {
+		if child != nil {
+			collectFunctions(child, functions)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateWithSourceMap(t *testing.T) {
+
+	tests := []string{
+		"[a]>1   &&   [bb]=='x'",
+		"(  [a]  +  2 )*3",
+		"'é' ==\n\t[日本] || !  [c]",
+		"f( [x] , 1 )   ?? -2",
+	}
+	options := ParserOptions{Functions: map[string]ExpressionFunction{"f": {Name: "f"}}}
+
+	for _, expression := range tests {
+		ast, err := parseAST(expression, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		generated, sourceMap, err := ast.GenerateWithSourceMap(GenerateOptions{flat: true, maxWidth: -1})
+		if err != nil {
+			t.Fatalf("%q: %v", expression, err)
+		}
+		if want := ast.GenerateWithOptions(GenerateOptions{flat: true, maxWidth: -1}); generated != want {
+			t.Errorf("%q generates %q with a source map, and %q without", expression, generated, want)
+		}
+
+		// each token is written as it was, at a position in the runes of both
+		original, output := []rune(expression), []rune(generated)
+		for i, mapping := range sourceMap {
+			from, to := string(original[mapping.Start:mapping.End]), string(output[mapping.GeneratedStart:mapping.GeneratedEnd])
+			if from != to {
+				t.Errorf("%q: %v maps %q to %q", expression, mapping, to, from)
+			}
+			if i > 0 && mapping.GeneratedStart < sourceMap[i-1].GeneratedStart {
+				t.Errorf("%q: the source map isn't in the order of the generated code", expression)
+			}
+		}
+	}
+}
+
+func TestSourceMapSource(t *testing.T) {
+
+	expression := "[a]>1   &&   [bb]=='x'"
+	ast, err := parseAST(expression, ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated, sourceMap, err := ast.GenerateWithSourceMap(GenerateOptions{flat: true, maxWidth: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated != "[a] > 1 && [bb] == 'x'" {
+		t.Fatalf("generates %q", generated)
+	}
+
+	tests := []struct {
+		start, end int
+		want       string
+		found      bool
+	}{
+		{11, 22, "[bb]=='x'", true},
+		{0, 7, "[a]>1", true},
+		{12, 14, "[bb]", true},
+		{12, 12, "[bb]", true},
+		{4, 5, ">", true},
+		{3, 4, "", false},
+		{3, 3, "", false},
+	}
+
+	for _, test := range tests {
+		start, end, found := sourceMap.Source(test.start, test.end)
+		if found != test.found || (found && expression[start:end] != test.want) {
+			t.Errorf("Source(%d, %d) of %q gives %q, %v; want %q, %v",
+				test.start, test.end, generated[test.start:test.end], expression[start:end], found, test.want, test.found)
+		}
+	}
+}
+
+func TestGenerateWithSourceMapNamedArguments(t *testing.T) {
+
+	functions := map[string]ExpressionFunction{"clamp": {Name: "clamp", Parameters: []string{"value", "low", "high"}}}
+	expression := "clamp(high: 10, value: [x], low: 0)"
+	ast, err := parseAST(expression, ParserOptions{Functions: functions})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated, sourceMap, err := ast.GenerateWithSourceMap(GenerateOptions{flat: true, maxWidth: -1, ArgumentStyle: ARGUMENTS_POSITIONAL})
+	if err != nil {
+		t.Fatalf("%q: %v", generated, err)
+	}
+
+	// the names of the arguments, which ARGUMENTS_POSITIONAL leaves out, map to nothing
+	want := SourceMap{
+		{GeneratedStart: 0, GeneratedEnd: 5, Start: 0, End: 5},
+		{GeneratedStart: 7, GeneratedEnd: 10, Start: 23, End: 26},
+		{GeneratedStart: 12, GeneratedEnd: 13, Start: 33, End: 34},
+		{GeneratedStart: 15, GeneratedEnd: 17, Start: 12, End: 14},
+	}
+	if generated != "clamp( [x], 0, 10 )" || !reflect.DeepEqual(sourceMap, want) {
+		t.Errorf("%q generates %q with the source map %v, want %v", expression, generated, sourceMap, want)
+	}
+}
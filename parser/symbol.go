@@ -41,6 +41,9 @@ const (
 	TERNARY_TRUE
 	TERNARY_FALSE
 	COALESCE
+	ELVIS_OR
+	PIPE
+	CUSTOM
 
 	FUNCTIONAL
 	ACCESS
@@ -75,6 +78,30 @@ var logicalSymbols = map[string]OperatorSymbol{
 	"||": OR,
 }
 
+/*
+Textual spellings of the logical operators, and the symbols they are normalized to.
+*/
+var textualLogicalSymbols = map[string]string{
+	"and": "&&",
+	"AND": "&&",
+	"or":  "||",
+	"OR":  "||",
+	"not": "!",
+	"NOT": "!",
+}
+
+/*
+Symbol returns the normalized symbol of an operator token, such as "&&" for a textual 'and', or "in" for 'IN'.
+For other tokens it is their Raw text, or their value where that is a string.
+*/
+func (token ExpressionToken) Symbol() string {
+
+	if symbol, ok := token.Value.(string); ok {
+		return symbol
+	}
+	return token.Raw
+}
+
 var bitwiseSymbols = map[string]OperatorSymbol{
 	"^": BITWISE_XOR,
 	"&": BITWISE_AND,
@@ -102,11 +129,22 @@ var exponentialSymbolsS = map[string]OperatorSymbol{
 }
 
 var ternarySymbols = map[string]OperatorSymbol{
-	"?":  TERNARY_TRUE,
-	":":  TERNARY_FALSE,
+	"?": TERNARY_TRUE,
+	":": TERNARY_FALSE,
+}
+
+var coalesceSymbols = map[string]OperatorSymbol{
 	"??": COALESCE,
 }
 
+var elvisSymbols = map[string]OperatorSymbol{
+	"?:": ELVIS_OR,
+}
+
+var pipelineSymbols = map[string]OperatorSymbol{
+	"|>": PIPE,
+}
+
 // this is defined separately from additiveSymbols et al because it's needed for parsing, not stage planning.
 var modifierSymbols = map[string]OperatorSymbol{
 	"+":  PLUS,
@@ -1,7 +1,11 @@
 package parser
 
+import "sort"
+
 /*
 Represents a single parsed token.
+Start and End are offsets in characters (runes) into the expression; StartByte and EndByte give the same span
+in bytes of the UTF-8 source, and StartUTF16 and EndUTF16 in UTF-16 code units, as used by LSP clients.
 */
 type ExpressionToken struct {
 	Kind  TokenKind
@@ -9,4 +13,76 @@ type ExpressionToken struct {
 	Raw   string
 	Start int
 	End   int
+
+	// position of Start in a multi-line expression, both counted from 1
+	Line   int
+	Column int
+
+	StartByte  int
+	EndByte    int
+	StartUTF16 int
+	EndUTF16   int
+
+	// whitespace and comments around the token, as TRIVIA tokens, when ParserOptions.KeepTrivia is set.
+	// A token's trailing trivia runs up to and including the end of its line; everything else before
+	// the next token is that token's leading trivia.
+	LeadingTrivia  []ExpressionToken
+	TrailingTrivia []ExpressionToken
+}
+
+/*
+TokenAt returns the token whose [StartByte, EndByte) span contains the given byte [offset] into the expression,
+as a Go string index is, so that an offset taken from the source text finds the right token past non-ASCII characters.
+Returns false if the offset falls in whitespace between tokens, or outside of the expression.
+Expects [tokens] in the order ParseTokens produces them.
+*/
+func TokenAt(tokens []ExpressionToken, offset int) (ExpressionToken, bool) {
+
+	index := sort.Search(len(tokens), func(i int) bool {
+		return tokens[i].EndByte > offset
+	})
+
+	if index < len(tokens) && tokens[index].StartByte <= offset {
+		return tokens[index], true
+	}
+	return ExpressionToken{}, false
+}
+
+/*
+Sets the Line, Column, and byte and UTF-16 offsets of all [tokens] from their span within the [stream], including
+the tokens embedded in interpolated strings. Used once spans are relative to the whole source expression.
+*/
+func locateTokens(tokens []ExpressionToken, stream *lexerStream) {
+
+	for i := range tokens {
+		stream.locate(&tokens[i])
+		locateTokens(tokens[i].LeadingTrivia, stream)
+		locateTokens(tokens[i].TrailingTrivia, stream)
+
+		if value, ok := tokens[i].Value.(InterpolatedString); ok {
+			for _, expression := range value.Expressions {
+				locateTokens(expression, stream)
+			}
+		}
+	}
+}
+
+/*
+Moves the spans of all [tokens] by [offset] characters, including the tokens embedded in interpolated strings.
+Used when a part of a larger expression is tokenized on its own.
+*/
+func shiftTokens(tokens []ExpressionToken, offset int) {
+
+	for i := range tokens {
+		tokens[i].Start += offset
+		tokens[i].End += offset
+		shiftTokens(tokens[i].LeadingTrivia, offset)
+		shiftTokens(tokens[i].TrailingTrivia, offset)
+
+		if value, ok := tokens[i].Value.(InterpolatedString); ok {
+			for _, expression := range value.Expressions {
+				shiftTokens(expression, offset)
+			}
+		}
+	}
 }
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"github.com/piex/govaluate-tool/parser/internal/lcs"
+)
+
+/*
+Represents the kind of change a TokenDiff describes.
+*/
+type TokenDiffOp int
+
+const (
+	DIFF_EQUAL TokenDiffOp = iota
+	DIFF_DELETE
+	DIFF_INSERT
+)
+
+func (op TokenDiffOp) String() string {
+
+	switch op {
+	case DIFF_EQUAL:
+		return "EQUAL"
+	case DIFF_DELETE:
+		return "DELETE"
+	case DIFF_INSERT:
+		return "INSERT"
+	}
+
+	return "UNKNOWN"
+}
+
+/*
+Represents a single step in the edit script between two token streams.
+Old is set for DIFF_EQUAL and DIFF_DELETE, New is set for DIFF_EQUAL and DIFF_INSERT.
+*/
+type TokenDiff struct {
+	Op  TokenDiffOp
+	Old ExpressionToken
+	New ExpressionToken
+}
+
+/*
+DiffTokens returns a minimal edit script turning the tokens of [a] into those of [b].
+Tokens are compared by kind and value, ignoring positions, and unchanged runs are aligned
+using the longest common subsequence, so that a single insertion doesn't mark everything after it as changed.
+Where both a deletion and an insertion happen at the same place, the deletion comes first.
+*/
+func DiffTokens(a, b []ExpressionToken) []TokenDiff {
+
+	var ret []TokenDiff
+
+	i, j := 0, 0
+	for _, op := range lcs.Align(len(a), len(b), func(i, j int) bool { return diffTokensEqual(a[i], b[j]) }) {
+
+		switch op {
+		case lcs.EQUAL:
+			ret = append(ret, TokenDiff{Op: DIFF_EQUAL, Old: a[i], New: b[j]})
+			i++
+			j++
+		case lcs.DELETE:
+			ret = append(ret, TokenDiff{Op: DIFF_DELETE, Old: a[i]})
+			i++
+		case lcs.INSERT:
+			ret = append(ret, TokenDiff{Op: DIFF_INSERT, New: b[j]})
+			j++
+		}
+	}
+
+	return ret
+}
+
+func diffTokensEqual(a, b ExpressionToken) bool {
+	return a.Kind == b.Kind && tokenValuesEqual(a.Value, b.Value)
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffTokens(t *testing.T) {
+
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		// a comparator inserted mid-stream leaves everything after it unchanged
+		{"[x] && [y] && [z]", "[x] && [y] > 1 && [z]", "= = = +> +1 = ="},
+		{"[x] && [y] > 1 && [z]", "[x] && [y] && [z]", "= = = -> -1 = ="},
+		{"[a] > 1", "[a] >= 1", "= -> +>= ="},
+		{"[a]  >  1", "[a] > 1", "= = ="},
+		{"", "[a]", "+[a]"},
+		{"[a]", "", "-[a]"},
+	}
+
+	for _, test := range tests {
+		a, err := ParseTokens(test.a, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseTokens(test.b, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var steps []string
+		for _, diff := range DiffTokens(a, b) {
+			switch diff.Op {
+			case DIFF_EQUAL:
+				steps = append(steps, "=")
+			case DIFF_DELETE:
+				steps = append(steps, "-"+tokenText(diff.Old))
+			case DIFF_INSERT:
+				steps = append(steps, "+"+tokenText(diff.New))
+			}
+		}
+
+		if got := strings.Join(steps, " "); got != test.want {
+			t.Errorf("DiffTokens(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"time"
+)
+
+/*
+The JSON form of an ExpressionToken. Value is encoded according to the token's kind, so that it can be decoded back
+into the same Go type; ValueType tells apart the numeric types which JSON alone can't.
+*/
+type tokenJSON struct {
+	Kind      TokenKind
+	Value     json.RawMessage
+	ValueType string `json:",omitempty"`
+	Raw       string
+	Start     int
+	End       int
+
+	Line   int
+	Column int
+
+	StartByte  int
+	EndByte    int
+	StartUTF16 int
+	EndUTF16   int
+
+	LeadingTrivia  []ExpressionToken `json:",omitempty"`
+	TrailingTrivia []ExpressionToken `json:",omitempty"`
+}
+
+// the ValueType of NUMERIC tokens which don't hold a float64
+const (
+	valueTypeInt64   = "int64"
+	valueTypeBigInt  = "bigint"
+	valueTypeDecimal = "decimal"
+)
+
+/*
+MarshalJSON encodes the token as an object with the same fields as ExpressionToken, with Kind as its name.
+Values which JSON has no type for are written as strings: bracket characters, durations (as in "1h30m0s"),
+patterns (as their regular expression), big integers (in decimal) and decimals (as a fraction, such as "1/10").
+*/
+func (token ExpressionToken) MarshalJSON() ([]byte, error) {
+
+	ret := tokenJSON{
+		Kind:           token.Kind,
+		Raw:            token.Raw,
+		Start:          token.Start,
+		End:            token.End,
+		Line:           token.Line,
+		Column:         token.Column,
+		StartByte:      token.StartByte,
+		EndByte:        token.EndByte,
+		StartUTF16:     token.StartUTF16,
+		EndUTF16:       token.EndUTF16,
+		LeadingTrivia:  token.LeadingTrivia,
+		TrailingTrivia: token.TrailingTrivia,
+	}
+
+	var value interface{}
+
+	switch typed := token.Value.(type) {
+	case rune:
+		value = string(typed)
+	case int64:
+		value = typed
+		ret.ValueType = valueTypeInt64
+	case *big.Int:
+		value = typed.String()
+		ret.ValueType = valueTypeBigInt
+	case *big.Rat:
+		value = typed.RatString()
+		ret.ValueType = valueTypeDecimal
+	case time.Duration:
+		value = typed.String()
+	case *regexp.Regexp:
+		value = typed.String()
+	default:
+		value = typed
+	}
+
+	var err error
+	ret.Value, err = json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ret)
+}
+
+/*
+UnmarshalJSON decodes a token written by MarshalJSON, restoring its Value to the type the lexer gives it for its kind.
+*/
+func (token *ExpressionToken) UnmarshalJSON(data []byte) error {
+
+	var decoded tokenJSON
+
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	value, err := decodeTokenValue(decoded)
+	if err != nil {
+		return err
+	}
+
+	*token = ExpressionToken{
+		Kind:           decoded.Kind,
+		Value:          value,
+		Raw:            decoded.Raw,
+		Start:          decoded.Start,
+		End:            decoded.End,
+		Line:           decoded.Line,
+		Column:         decoded.Column,
+		StartByte:      decoded.StartByte,
+		EndByte:        decoded.EndByte,
+		StartUTF16:     decoded.StartUTF16,
+		EndUTF16:       decoded.EndUTF16,
+		LeadingTrivia:  decoded.LeadingTrivia,
+		TrailingTrivia: decoded.TrailingTrivia,
+	}
+	return nil
+}
+
+func decodeTokenValue(decoded tokenJSON) (interface{}, error) {
+
+	data := decoded.Value
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	switch decoded.Kind {
+
+	case NUMERIC:
+		switch decoded.ValueType {
+		case valueTypeInt64:
+			var value int64
+			err := json.Unmarshal(data, &value)
+			return value, err
+
+		case valueTypeBigInt:
+			var text string
+			if err := json.Unmarshal(data, &text); err != nil {
+				return nil, err
+			}
+			value, ok := new(big.Int).SetString(text, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid integer value '%s'", text)
+			}
+			return value, nil
+
+		case valueTypeDecimal:
+			var text string
+			if err := json.Unmarshal(data, &text); err != nil {
+				return nil, err
+			}
+			value, ok := new(big.Rat).SetString(text)
+			if !ok {
+				return nil, fmt.Errorf("invalid decimal value '%s'", text)
+			}
+			return value, nil
+		}
+
+		var value float64
+		err := json.Unmarshal(data, &value)
+		return value, err
+
+	case CLAUSE, CLAUSE_CLOSE, INDEX, INDEX_CLOSE, ARRAY, ARRAY_CLOSE, MAP, MAP_CLOSE:
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return nil, err
+		}
+		return getFirstRune(text), nil
+
+	case DURATION:
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return nil, err
+		}
+		return time.ParseDuration(text)
+
+	case PATTERN:
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return nil, err
+		}
+		return regexp.Compile(text)
+
+	case TIME:
+		var value time.Time
+		err := json.Unmarshal(data, &value)
+		return value, err
+
+	case FUNCTION:
+		var value ExpressionFunction
+		err := json.Unmarshal(data, &value)
+		return value, err
+
+	case INTERPOLATED_STRING:
+		var value InterpolatedString
+		err := json.Unmarshal(data, &value)
+		return value, err
+
+	case LAMBDA:
+		// the names of the lambda's parameters
+		var value []string
+		err := json.Unmarshal(data, &value)
+		return value, err
+
+	case ACCESSOR, METHOD:
+		// a plain accessor is a list of segments, an optional chain an object
+		if data[0] == '{' {
+			var value OptionalAccessor
+			err := json.Unmarshal(data, &value)
+			return value, err
+		}
+		var value []string
+		err := json.Unmarshal(data, &value)
+		return value, err
+	}
+
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
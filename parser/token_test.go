@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenAt(t *testing.T) {
+
+	expression := "[名前] == 'café' && [b] > 1"
+
+	tokens, err := ParseTokens(expression, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text  string
+		found bool
+		raw   string
+	}{
+		{"[名前]", true, "名前"},
+		{"前]", true, "名前"},
+		{"== ", true, "=="},
+		{" == ", false, ""},
+		{"'café'", true, "café"},
+		{"é'", true, "café"},
+		{"&&", true, "&&"},
+		{"[b]", true, "b"},
+		{"1", true, "1"},
+	}
+
+	for _, test := range tests {
+		offset := strings.Index(expression, test.text)
+		token, found := TokenAt(tokens, offset)
+		if found != test.found || token.Raw != test.raw {
+			t.Errorf("TokenAt(%d), at %q, = %q, %v, want %q, %v", offset, test.text, token.Raw, found, test.raw, test.found)
+		}
+	}
+
+	if _, found := TokenAt(tokens, len(expression)); found {
+		t.Errorf("TokenAt(%d), past the end of the expression, found a token", len(expression))
+	}
+}
+
+func TestSymbol(t *testing.T) {
+
+	tests := map[string]string{
+		"[a] and [b]": "&&",
+		"[a] OR [b]":  "||",
+		"[a] IN (1)":  "in",
+		"[a] + 1":     "+",
+		"[a] == 1":    "==",
+	}
+
+	for expression, want := range tests {
+		tokens, err := ParseTokens(expression, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tokens[1].Symbol(); got != want {
+			t.Errorf("the operator of %q has the symbol %q, want %q", expression, got, want)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"unicode"
+)
+
+/*
+Tokenizer reads tokens from an io.Reader one at a time, for expressions too large to hold as a single string.
+It produces the same tokens as ParseTokensWithOptions, with positions relative to the start of the input,
+but only keeps the lines it is still reading in memory.
+
+Since the input is buffered a line at a time, a single very long line is still read in whole.
+*/
+type Tokenizer struct {
+	reader  *bufio.Reader
+	options ParserOptions
+
+	stream   *lexerStream
+	state    lexerState
+	patterns patternCompiler
+	balance  bracketBalance
+	limits   limitCounter
+
+	// number of characters already dropped from the front of the stream
+	offset int
+
+	// how far the stream has been scanned for unfinished strings and comments, and what was left open
+	scanned int
+	quote   rune
+	comment rune
+	star    bool
+
+	started bool
+	atEOF   bool
+	err     error
+
+	// with KeepTrivia or FoldNegativeNumbers, the last token read, held back until the one after it is read,
+	// since it may still take trailing trivia or be folded into it
+	held    ExpressionToken
+	holding bool
+
+	// the trivia for KeepTrivia, and whether it took a comment since the last token, which keeps a '-' from being folded
+	trivia       triviaAttacher
+	afterComment bool
+}
+
+/*
+NewTokenizer returns a Tokenizer reading the expression from [reader], with no functions.
+*/
+func NewTokenizer(reader io.Reader) *Tokenizer {
+	return NewTokenizerWithOptions(reader, ParserOptions{})
+}
+
+/*
+NewTokenizerWithOptions returns a Tokenizer reading the expression from [reader], with the given [options].
+*/
+func NewTokenizerWithOptions(reader io.Reader, options ParserOptions) *Tokenizer {
+
+	ret := &Tokenizer{
+		reader:  bufio.NewReader(reader),
+		options: options,
+		stream:  newLexerStream(""),
+		state:   validLexerStates[0],
+	}
+	ret.trivia.stream = ret.stream
+	return ret
+}
+
+/*
+Next returns the next token of the expression, or io.EOF once every token has been read.
+Syntax errors are returned as a *ParseError; after any error, Next keeps returning that same error.
+With KeepTrivia or FoldNegativeNumbers, each token is returned once the token after it has been read,
+as it may still take the whitespace and comments up to the end of its line, or be folded into the number after it.
+*/
+func (t *Tokenizer) Next() (ExpressionToken, error) {
+
+	if !t.options.KeepTrivia && !t.options.FoldNegativeNumbers {
+		return t.read()
+	}
+
+	for {
+		token, err := t.read()
+		if err != nil {
+			if !t.holding {
+				return ExpressionToken{}, err
+			}
+			t.holding = false
+			t.trivia.finish()
+			return t.held, nil
+		}
+
+		if !t.holding {
+			t.hold(token)
+			continue
+		}
+
+		// a '-' is folded into the number right after it, the same as foldNegativeNumbers does
+		if t.options.FoldNegativeNumbers && t.held.Kind == PREFIX && t.held.Raw == "-" && token.Kind == NUMERIC && !t.afterComment {
+			if value, ok := negateNumber(token.Value); ok {
+				t.held.Kind = NUMERIC
+				t.held.Value = value
+				t.held.Raw = "-" + token.Raw
+				t.held.End = token.End
+				t.held.EndByte = token.EndByte
+				t.held.EndUTF16 = token.EndUTF16
+				if t.options.KeepTrivia {
+					t.trivia.drop()
+				}
+				continue
+			}
+		}
+
+		ret := t.held
+		t.hold(token)
+		return ret, nil
+	}
+}
+
+/*
+Holds back [token] until the one after it is read.
+*/
+func (t *Tokenizer) hold(token ExpressionToken) {
+
+	t.held = token
+	t.holding = true
+	if t.options.KeepTrivia {
+		t.trivia.take(&t.held)
+	}
+}
+
+/*
+Reads the next token from the input, with its position within the whole input.
+With KeepTrivia, the whitespace and comments before it are given to the trivia instead of being returned.
+*/
+func (t *Tokenizer) read() (ExpressionToken, error) {
+
+	if t.err != nil {
+		return ExpressionToken{}, t.err
+	}
+
+	t.afterComment = false
+	for {
+		// keep the character before the current position, since index access looks back at it
+		if t.stream.position > 0 {
+			dropped := t.stream.discardLinesBefore(t.stream.position - 1)
+			t.offset += dropped
+			t.scanned -= dropped
+		}
+
+		if err := t.fill(); err != nil {
+			t.err = err
+			return ExpressionToken{}, err
+		}
+
+		if !t.stream.canRead() {
+			if err := t.balance.finish(); err != nil {
+				return ExpressionToken{}, t.failBalance(err)
+			}
+			t.err = io.EOF
+			return ExpressionToken{}, io.EOF
+		}
+
+		position := t.stream.position
+		token, err, found := readToken(t.stream, t.state, t.options)
+		if err != nil {
+			return ExpressionToken{}, t.fail(toParseError(err, token.Start, token.End, t.stream))
+		}
+
+		if !found {
+			t.addTrivia(position, t.stream.position)
+			continue
+		}
+
+		t.stream.locate(&token)
+		t.addTrivia(position, token.Start)
+
+		// comments are trivia, and don't change what may legally come next
+		if token.Kind == COMMENT {
+			if t.options.KeepTrivia {
+				t.afterComment = true
+				t.trivia.offset = t.offset
+				t.trivia.add(token.Start, token.End)
+				continue
+			}
+			if !t.options.KeepComments {
+				continue
+			}
+			return t.shift(token), nil
+		}
+
+		t.state, err = getLexerStateForToken(token)
+		if err != nil {
+			return ExpressionToken{}, t.fail(toParseError(err, token.Start, token.End, t.stream))
+		}
+
+		if err = t.patterns.next(&token); err != nil {
+			return ExpressionToken{}, t.fail(toParseError(err, token.Start, token.End, t.stream))
+		}
+
+		if err = t.limits.add(token, t.stream, t.options); err != nil {
+			return ExpressionToken{}, t.fail(err)
+		}
+
+		token = t.shift(token)
+		if err = t.balance.next(token); err != nil {
+			return ExpressionToken{}, t.failBalance(err)
+		}
+
+		return token, nil
+	}
+}
+
+/*
+Reads lines from the input until the stream holds at least the whole of the next token,
+and enough after it for the lexer to look ahead.
+*/
+func (t *Tokenizer) fill() error {
+
+	for !t.atEOF && !t.canReadToken() {
+
+		line, err := t.reader.ReadString('\n')
+		t.stream.append(line)
+
+		// skip a leading byte order mark, the same as newLexerStream does
+		if !t.started && t.stream.length > 0 {
+			t.started = true
+			if t.stream.source[0] == '\uFEFF' {
+				t.stream.position = 1
+			}
+		}
+
+		t.scan()
+
+		if limitErr := checkLength(t.stream, t.offset, t.options); limitErr != nil {
+			return t.fail(limitErr)
+		}
+
+		if err == io.EOF {
+			t.atEOF = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Reports whether the stream ends outside of any string or block comment, with at least two
+non-space characters left to read; the second of them covers the lexer peeking past a token.
+*/
+func (t *Tokenizer) canReadToken() bool {
+
+	if t.quote != 0 || t.comment == '*' {
+		return false
+	}
+
+	var count int
+	for _, character := range t.stream.source[t.stream.position:] {
+		if !unicode.IsSpace(character) {
+			count++
+			if count == 2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Scans what has been appended to the stream since the last call, keeping track of unfinished strings and comments
+with the same rules as splitStatements.
+*/
+func (t *Tokenizer) scan() {
+
+	source := t.stream.source
+	i := t.scanned
+
+	for ; i < len(source); i++ {
+
+		character := source[i]
+
+		if t.comment == '/' {
+			if character == '\n' {
+				t.comment = 0
+			}
+			continue
+		}
+		if t.comment == '*' {
+			if character == '/' && t.star {
+				t.comment = 0
+			}
+			t.star = character == '*'
+			continue
+		}
+
+		if character == '\\' {
+			i++
+			continue
+		}
+
+		if t.quote != 0 {
+			if character == t.quote {
+				t.quote = 0
+			}
+			continue
+		}
+
+		switch character {
+		case '\'', '"':
+			t.quote = character
+		case '/':
+			if i+1 < len(source) && (source[i+1] == '/' || source[i+1] == '*') {
+				t.comment = source[i+1]
+				t.star = false
+				i++
+			}
+		}
+	}
+
+	t.scanned = i
+}
+
+/*
+Adds the whitespace between [start] and [end] in the stream to the trivia, with KeepTrivia.
+*/
+func (t *Tokenizer) addTrivia(start int, end int) {
+
+	if t.options.KeepTrivia {
+		t.trivia.offset = t.offset
+		t.trivia.whitespace(start, end)
+	}
+}
+
+/*
+Moves a token read from the stream to its position within the whole input.
+*/
+func (t *Tokenizer) shift(token ExpressionToken) ExpressionToken {
+
+	tokens := []ExpressionToken{token}
+	shiftTokens(tokens, t.offset)
+	return tokens[0]
+}
+
+/*
+Fails with an error from the bracket balance, which is positioned within the whole input already.
+An opening bracket on a line which has been dropped from the stream keeps the line and column
+it was read with, but has no snippet.
+*/
+func (t *Tokenizer) failBalance(err error) error {
+
+	parseErr := parseErrorOf(err)
+	if parseErr.Start < t.offset {
+		t.err = err
+		return err
+	}
+
+	parseErr.Start -= t.offset
+	parseErr.End -= t.offset
+	return t.fail(toParseError(err, 0, 0, t.stream))
+}
+
+func (t *Tokenizer) fail(err error) error {
+
+	parseErr := parseErrorOf(err)
+	parseErr.Start += t.offset
+	parseErr.End += t.offset
+	t.err = err
+	return err
+}
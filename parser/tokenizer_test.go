@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+/*
+Reads from a string [size] bytes at a time, so that reads end inside strings, comments and operators.
+*/
+type chunkReader struct {
+	source string
+	size   int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+
+	if r.source == "" {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(len(p), r.size)], r.source)
+	r.source = r.source[n:]
+	return n, nil
+}
+
+/*
+Reads every token of [expression] with a Tokenizer, reading [size] bytes at a time.
+*/
+func streamTokens(expression string, size int, options ParserOptions) ([]ExpressionToken, error) {
+
+	tokenizer := NewTokenizerWithOptions(&chunkReader{source: expression, size: size}, options)
+
+	var ret []ExpressionToken
+	for {
+		token, err := tokenizer.Next()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, token)
+	}
+}
+
+/*
+Checks that the Tokenizer reads the same tokens from [expression] as ParseTokensWithOptions,
+or fails as well, whichever size the reads are. The Tokenizer reports unbalanced brackets as soon as
+it reads them, where ParseTokensWithOptions finishes lexing first, so with more than one error
+they may report different ones; [sameError] checks that they report the same.
+*/
+func checkStreamTokens(t *testing.T, expression string, options ParserOptions, sameError bool) {
+	t.Helper()
+
+	want, wantErr := ParseTokensWithOptions(expression, options)
+
+	for _, size := range []int{1, 2, 3, 7, len(expression) + 1} {
+		got, err := streamTokens(expression, size, options)
+
+		if (err == nil) != (wantErr == nil) {
+			t.Fatalf("%q read %d bytes at a time: got error %v, want %v", expression, size, err, wantErr)
+		}
+		if err != nil && sameError {
+			got, want := parseErrorOf(err), parseErrorOf(wantErr)
+			if got.Start != want.Start || got.End != want.End || got.Msg != want.Msg {
+				t.Fatalf("%q read %d bytes at a time: got error %q at [%d, %d), want %q at [%d, %d)",
+					expression, size, got.Msg, got.Start, got.End, want.Msg, want.Start, want.End)
+			}
+		}
+		if err == nil && !reflect.DeepEqual(got, want) {
+			t.Fatalf("%q read %d bytes at a time:\n got %v\nwant %v", expression, size, got, want)
+		}
+	}
+}
+
+func TestTokenizerMatchesParseTokens(t *testing.T) {
+
+	tests := []string{
+		"",
+		"[a] >= 1 && [b] != 'x'",
+		"'a string\nspanning lines' == [s]",
+		"\"an \\\"escaped\\\" quote\" + 'it''s'",
+		"[a]\n>=\n1\n&&\n[b]\n<=\n2",
+		"[a] // a comment\n|| /* a block\ncomment */ [b]",
+		"f(1,\n  2,\n  3) ?? [x]?.y",
+		"x[0]\n[1] == 'q'",
+		"0x1F +\n1_000_000 * 2.5e-3",
+		"\uFEFF[a] == 'é'\n&& [日本] == 1",
+		"[a] == 'unterminated\n",
+		"(([a] + 1)\n",
+		"[a] + ]",
+		"-5 + - 3 * -[a] - -0x1F",
+		"- /* not folded */ 5 // trailing\n\n  // leading\n- 1",
+		"[a] -\n  1 >= -2.5e3  \n",
+		"\uFEFF  -1  ",
+	}
+
+	for _, expression := range tests {
+		for _, options := range streamOptions {
+			checkStreamTokens(t, expression, options, true)
+		}
+	}
+}
+
+// the options which change what the Tokenizer returns, alone and together
+var streamOptions = []ParserOptions{
+	{},
+	{KeepComments: true},
+	{KeepTrivia: true},
+	{FoldNegativeNumbers: true},
+	{KeepComments: true, FoldNegativeNumbers: true},
+	{KeepTrivia: true, FoldNegativeNumbers: true, PreserveIntegers: true},
+}
+
+func FuzzTokenizer(f *testing.F) {
+
+	for _, expression := range readCorpus(f, "harden.txt") {
+		f.Add(expression)
+	}
+	f.Add("'a\nb' // c\n/* d\ne */ [f]")
+
+	f.Fuzz(func(t *testing.T, expression string) {
+		for _, options := range streamOptions {
+			checkStreamTokens(t, expression, options, false)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+/*
+TokensToString reconstructs an expression string from the given tokens,
+such that tokenizing the result produces an equivalent token stream (ignoring positions).
+STRING and TIME tokens are re-quoted, and VARIABLE tokens are always re-bracketed so that
+names which are not plain identifiers (or collide with keywords) survive the round trip.
+*/
+func TokensToString(tokens []ExpressionToken) string {
+
+	var sb strings.Builder
+
+	for i, token := range tokens {
+
+		// a line comment runs to the end of the line, so whatever follows it needs a new one
+		if i > 0 && tokens[i-1].Kind == COMMENT && strings.HasPrefix(tokens[i-1].Raw, "//") {
+			sb.WriteString("\n")
+		} else if i > 0 && needsSpaceBetween(tokens[i-1], token) {
+			sb.WriteString(" ")
+		}
+
+		sb.WriteString(tokenText(token))
+	}
+
+	return sb.String()
+}
+
+/*
+Returns the source text of [token], re-quoting STRING and TIME tokens and re-bracketing VARIABLE tokens.
+*/
+func tokenText(token ExpressionToken) string {
+
+	switch token.Kind {
+	case STRING:
+		return "'" + encodeString(token.Value.(string), "'\"") + "'"
+	case TIME, PATTERN:
+		return "'" + encodeString(token.Raw, "'\"") + "'"
+	case INTERPOLATED_STRING:
+		var sb strings.Builder
+		value := token.Value.(InterpolatedString)
+		writeInterpolatedString(&sb, value, func(index int) string {
+			return TokensToString(value.Expressions[index])
+		})
+		return sb.String()
+	case DURATION:
+		return durationLiteral(token.Raw)
+	case VARIABLE:
+		return "[" + escapeString(token.Raw, "]\\") + "]"
+	}
+	return token.Raw
+}
+
+/*
+Writes a duration back out bare (such as 2h30m) where it lexes that way, and quoted otherwise (such as '-5m').
+*/
+func durationLiteral(raw string) string {
+
+	if isNumeric(getFirstRune(raw)) {
+		return raw
+	}
+	return "'" + encodeString(raw, "'\"") + "'"
+}
+
+func needsSpaceBetween(previous ExpressionToken, next ExpressionToken) bool {
+
+	switch previous.Kind {
+	case PREFIX:
+		// a textual 'not' would otherwise run into the name after it
+		return unicode.IsLetter(getFirstRune(previous.Raw))
+	case CLAUSE, INDEX, ARRAY, MAP:
+		return false
+	case FUNCTION, ACCESSOR:
+		if next.Kind == CLAUSE {
+			return false
+		}
+	}
+
+	switch next.Kind {
+	case CLAUSE_CLOSE, SEPARATOR, INDEX, INDEX_CLOSE, ARRAY_CLOSE, MAP_CLOSE:
+		return false
+	}
+
+	return true
+}
+
+/*
+Prefixes every occurrence of the given [special] characters with a backslash,
+so that readUntilFalse reads them back as literal characters.
+*/
+func escapeString(value string, special string) string {
+
+	var sb strings.Builder
+
+	for _, character := range value {
+		if strings.ContainsRune(special, character) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(character)
+	}
+
+	return sb.String()
+}
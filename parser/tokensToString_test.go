@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokensToString(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		// spacing
+		{"[a]+1", "[a] + 1"},
+		{"[a]  >=  1&&[b]", "[a] >= 1 && [b]"},
+		{"f( 1,2 )", "f(1, 2)"},
+		{"!a || not b", "![a] || not [b]"},
+		{"[x][0]", "[x][0]"},
+		{"[ 1 , 2 ]", "[1, 2]"},
+		{"x // c\n+ 1", "[x] // c\n+ 1"},
+
+		// STRING and TIME are re-quoted
+		{"\"dq\"", "'dq'"},
+		{"'it\\'s'", "'it\\'s'"},
+		{"\"say \\\"hi\\\"\"", "'say \\\"hi\\\"'"},
+		{"\"2024-01-02\"", "'2024-01-02'"},
+		{"2h30m", "2h30m"},
+		{"\"x${[y]+1}\"", "\"x${[y] + 1}\""},
+
+		// VARIABLE is re-bracketed, escaping its closing bracket
+		{"a", "[a]"},
+		{"[my var]", "[my var]"},
+		{"[a\\]b]", "[a\\]b]"},
+		{"[in]", "[in]"},
+		{"a.B", "a.B"},
+	}
+
+	options := ParserOptions{
+		KeepComments: true,
+		Functions:    map[string]ExpressionFunction{"f": {Name: "f"}},
+	}
+
+	for _, test := range tests {
+		tokens, err := ParseTokensWithOptions(test.expression, options)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		got := TokensToString(tokens)
+		if got != test.want {
+			t.Errorf("TokensToString(%q) = %q, want %q", test.expression, got, test.want)
+		}
+
+		retokenized, err := ParseTokensWithOptions(got, options)
+		if err != nil {
+			t.Errorf("%q: TokensToString gives %q, which doesn't tokenize: %v", test.expression, got, err)
+			continue
+		}
+		if !sameKindsAndValues(tokens, retokenized) {
+			t.Errorf("%q: TokensToString gives %q, which tokenizes into %v, want %v", test.expression, got, retokenized, tokens)
+		}
+	}
+}
+
+func sameKindsAndValues(a []ExpressionToken, b []ExpressionToken) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Kind != b[i].Kind {
+			return false
+		}
+
+		// the tokens embedded in an interpolated string have positions of their own
+		if value, ok := a[i].Value.(InterpolatedString); ok {
+			other := b[i].Value.(InterpolatedString)
+			if !reflect.DeepEqual(value.Segments, other.Segments) || len(value.Expressions) != len(other.Expressions) {
+				return false
+			}
+			for j := range value.Expressions {
+				if !sameKindsAndValues(value.Expressions[j], other.Expressions[j]) {
+					return false
+				}
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(a[i].Value, b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
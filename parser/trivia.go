@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"strings"
+)
+
+/*
+Attaches the whitespace between [tokens], and their COMMENT tokens, to the tokens around them as TRIVIA tokens.
+A token takes trivia as trailing up to the end of its line, and the next token takes the rest as leading trivia;
+anything after the last token is trailing trivia of the last token.
+*/
+func attachTrivia(tokens []ExpressionToken, stream *lexerStream) []ExpressionToken {
+
+	var ret []ExpressionToken
+	attacher := triviaAttacher{stream: stream}
+
+	// a leading byte order mark isn't trivia
+	position := 0
+	if stream.length > 0 && stream.source[0] == '\uFEFF' {
+		position = 1
+	}
+
+	for _, token := range tokens {
+
+		attacher.whitespace(position, token.Start)
+		position = token.End
+
+		if token.Kind == COMMENT {
+			attacher.add(token.Start, token.End)
+			continue
+		}
+
+		ret = append(ret, token)
+		attacher.take(&ret[len(ret)-1])
+	}
+
+	attacher.whitespace(position, stream.length)
+	attacher.finish()
+
+	return ret
+}
+
+/*
+Does the work of attachTrivia as the tokens are read, for the Tokenizer as well.
+Positions given to it are within the [stream], and the trivia made from them are moved by [offset],
+as the Tokenizer moves its tokens to their position within the whole input.
+*/
+type triviaAttacher struct {
+	stream *lexerStream
+	offset int
+
+	// the trivia read since the last token, for the next token to take as leading trivia
+	leading []ExpressionToken
+
+	// the last token taken, and whether it still takes trivia as trailing
+	last     *ExpressionToken
+	trailing bool
+}
+
+/*
+Adds the text between [start] and [end] as a single TRIVIA token.
+*/
+func (a *triviaAttacher) add(start int, end int) {
+
+	trivia := newTriviaToken(a.stream, start, end)
+	trivia.Start += a.offset
+	trivia.End += a.offset
+
+	if a.trailing {
+		a.last.TrailingTrivia = append(a.last.TrailingTrivia, trivia)
+		a.trailing = !strings.Contains(trivia.Raw, "\n")
+		return
+	}
+	a.leading = append(a.leading, trivia)
+}
+
+/*
+Adds the whitespace between [start] and [end], split after the line break which ends the trailing trivia.
+*/
+func (a *triviaAttacher) whitespace(start int, end int) {
+
+	if start >= end {
+		return
+	}
+
+	// the first line break ends the trailing trivia
+	if a.trailing {
+		for i := start; i < end; i++ {
+			if a.stream.source[i] == '\n' {
+				a.add(start, i+1)
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	if start < end {
+		a.add(start, end)
+	}
+}
+
+/*
+Gives the trivia read since the last token to [token], and has it take what follows as trailing trivia.
+*/
+func (a *triviaAttacher) take(token *ExpressionToken) {
+
+	token.LeadingTrivia = a.leading
+	a.leading = nil
+	a.last = token
+	a.trailing = true
+}
+
+/*
+Drops the trivia read since the last token, for a token read next which is folded into it,
+as a negative number is folded from a '-' and the number after it.
+*/
+func (a *triviaAttacher) drop() {
+
+	a.last.TrailingTrivia = nil
+	a.leading = nil
+	a.trailing = true
+}
+
+/*
+Gives the trivia after the last token to it as trailing trivia.
+*/
+func (a *triviaAttacher) finish() {
+
+	if a.last != nil {
+		a.last.TrailingTrivia = append(a.last.TrailingTrivia, a.leading...)
+	}
+	a.leading = nil
+}
+
+func newTriviaToken(stream *lexerStream, start int, end int) ExpressionToken {
+
+	text := string(stream.source[start:end])
+
+	ret := ExpressionToken{Kind: TRIVIA, Value: text, Raw: text, Start: start, End: end}
+	stream.locate(&ret)
+	return ret
+}
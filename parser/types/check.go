@@ -0,0 +1,191 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+type checker struct {
+	config Config
+	info   *Info
+	errors []Error
+}
+
+/*
+Infers the type of [node] and of everything below it, where [bound] holds the parameters of the lambdas enclosing it.
+*/
+func (c *checker) check(node ast.Node, bound map[string]bool) Type {
+
+	if node.Kind() == parser.LAMBDA {
+		parameters, _ := node.Token().Value.([]string)
+		inner := make(map[string]bool, len(bound)+len(parameters))
+		for name := range bound {
+			inner[name] = true
+		}
+		for _, name := range parameters {
+			inner[name] = true
+		}
+		bound = inner
+	}
+
+	children := node.Children()
+	operands := make([]Type, len(children))
+	for i, child := range children {
+		operands[i] = c.check(child, bound)
+	}
+
+	ret := c.infer(node, operands, bound)
+	c.info.Types[node] = ret
+	return ret
+}
+
+/*
+Infers the type of [node] from those of its [operands]. Variables, accessors and calls are typed from the Config;
+everything else follows the rules of parser.OperationType, the same as parser.InferType.
+*/
+func (c *checker) infer(node ast.Node, operands []Type, bound map[string]bool) Type {
+
+	token := node.Token()
+
+	switch node.Kind() {
+	case parser.VARIABLE:
+		if bound[token.Raw] {
+			return Unknown
+		}
+		return c.param(token.Raw)
+
+	case parser.ACCESSOR:
+		segments := accessorSegments(token)
+		if len(segments) == 0 || bound[segments[0]] {
+			return Unknown
+		}
+		return c.param(strings.Join(segments, "."))
+
+	case parser.FUNCTION:
+		return c.call(node, operands)
+	}
+
+	names := make([]string, len(operands))
+	for i, operand := range operands {
+		names[i] = string(operand)
+		if !isKnown(operand) {
+			names[i] = string(Unknown)
+		}
+	}
+
+	ret, err := parser.OperationType(token, names)
+	if err != nil {
+		c.errorf(node, "%v", err)
+	}
+	return Type(ret)
+}
+
+func (c *checker) param(name string) Type {
+
+	if t, found := c.config.Params[name]; found && t != "" {
+		return t
+	}
+	return Unknown
+}
+
+/*
+Checks the arguments of a call against the signature of the function, and returns the type of its result.
+*/
+func (c *checker) call(node ast.Node, arguments []Type) Type {
+
+	token := node.Token()
+	function, _ := token.Value.(parser.ExpressionFunction)
+
+	signature, found := c.config.Functions[token.Raw]
+	if !found {
+		return returnType(Signature{}, function)
+	}
+
+	if len(arguments) > len(signature.Parameters) && !signature.Variadic {
+		c.errorf(node, "'%s' takes %d arguments, got %d", token.Raw, len(signature.Parameters), len(arguments))
+		return returnType(signature, function)
+	}
+
+	for i, child := range node.Children() {
+
+		index := i
+		if child.Kind() == parser.NAMED_ARGUMENT {
+			index = indexOf(function.Parameters, child.Token().Raw)
+			if index < 0 {
+				continue
+			}
+		}
+
+		expected := parameterType(signature, index)
+		if isKnown(arguments[i]) && isKnown(expected) && arguments[i] != expected && arguments[i] != Null {
+			c.errorf(child, "argument %d of '%s' must be a %s, got %s", index+1, token.Raw, expected, arguments[i])
+		}
+	}
+
+	return returnType(signature, function)
+}
+
+func returnType(signature Signature, function parser.ExpressionFunction) Type {
+
+	switch {
+	case signature.ReturnType != "":
+		return signature.ReturnType
+	case function.ReturnType != "":
+		return Type(function.ReturnType)
+	}
+	return Unknown
+}
+
+func parameterType(signature Signature, index int) Type {
+
+	switch {
+	case index < len(signature.Parameters):
+		return signature.Parameters[index]
+	case signature.Variadic && len(signature.Parameters) > 0:
+		return signature.Parameters[len(signature.Parameters)-1]
+	}
+	return Unknown
+}
+
+func (c *checker) errorf(node ast.Node, format string, arguments ...interface{}) {
+	c.errors = append(c.errors, Error{Node: node, Msg: fmt.Sprintf(format, arguments...)})
+}
+
+/*
+Sorts [errors] by the position of their nodes; Check finds them bottom-up, so an operand's comes before its operator's.
+*/
+func sortErrors(errors []Error) {
+
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Node.Token().Start < errors[j].Node.Token().Start
+	})
+}
+
+func accessorSegments(token parser.ExpressionToken) []string {
+
+	switch value := token.Value.(type) {
+	case []string:
+		return value
+	case parser.OptionalAccessor:
+		return value.Segments
+	}
+	return nil
+}
+
+func isKnown(t Type) bool {
+	return t != Unknown && t != ""
+}
+
+func indexOf(names []string, name string) int {
+
+	for i, candidate := range names {
+		if candidate == name {
+			return i
+		}
+	}
+	return -1
+}
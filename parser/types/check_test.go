@@ -0,0 +1,78 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+func TestCheckMatchesInferType(t *testing.T) {
+
+	tests := []string{
+		"1 + 2 * 3",
+		"'a' + 1",
+		"'a' > 5",
+		"-'a'",
+		"!1",
+		"1 && true",
+		"1 ? 2 : 3",
+		"true ? 'a' : 'b'",
+		"true ? 'a' : 1",
+		"null ?? 5",
+		"'2024-01-02' - '2024-01-01'",
+		"'2024-01-02' + 5m",
+		"5m * 2",
+		"2 / 5m",
+		"'abc' =~ 1",
+		"1 between 'a' and 'z'",
+		"5 like 'a%'",
+		"[x] > 1 && [y] == 'a'",
+		"(1 + 2) == null",
+	}
+
+	for _, expression := range tests {
+		tree, err := ast.Parse(expression, parser.ParserOptions{})
+		if err != nil {
+			t.Fatalf("%q: %v", expression, err)
+		}
+
+		want, wantErr := parser.InferType(ast.ToParser(tree), nil)
+		info, errors := Check(tree, Config{})
+
+		if got := info.TypeOf(tree); (wantErr == nil) && string(got) != want {
+			t.Errorf("%q: Check infers %s, InferType %s", expression, got, want)
+		}
+		if (len(errors) == 0) != (wantErr == nil) {
+			t.Errorf("%q: Check reports %v, InferType %v", expression, errors, wantErr)
+			continue
+		}
+		if wantErr != nil && !strings.Contains(wantErr.Error(), errors[0].Msg) {
+			t.Errorf("%q: Check reports %q, InferType %q", expression, errors[0].Msg, wantErr)
+		}
+	}
+}
+
+func TestCheckReportsEveryMismatch(t *testing.T) {
+
+	tree, err := ast.Parse("[age] > 'x' || [name] + 1 > 2 || !'y'", parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, errors := Check(tree, Config{Params: map[string]Type{"age": Number, "name": Bool}})
+
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Msg)
+	}
+	want := []string{
+		"cannot compare number with string using '>'",
+		"'+' expects number operands, got bool",
+		"'!' expects a bool operand, got string",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Check reports\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,284 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+An access into a value which may be nil, found by NilAccesses, which fails when the expression is evaluated with it nil.
+*/
+type NilAccess struct {
+
+	// the ACCESSOR or METHOD node making the access
+	Node ast.Node
+
+	// the part of the chain which may be nil, such as "user.Address" for user.Address.City
+	Path string
+
+	// the accessor written with '?.' after each part which may be nil, such as "user.Address?.City"
+	Guarded string
+}
+
+func (access NilAccess) Error() string {
+	return fmt.Sprintf("'%s' may be nil when accessed by '%s' at %d; use '%s'", access.Path, access.Node.Token().Raw, access.Node.Pos(), access.Guarded)
+}
+
+/*
+NilAccesses returns the accessors within the tree rooted at [node] which access into a value that the [schema] says may be nil,
+in source order. govaluate fails on such an access when the value is nil, rather than evaluating it to nil.
+
+A value may be nil if its schema is Nullable, or if it is a field which isn't Required, and so may be missing;
+a value reached with '?.' may be nil too, as that makes the access nil rather than fail.
+An access is safe where it is guarded by a check of the value against nil, as in:
+
+	user.Address != nil && user.Address.City == 'Paris'
+	user.Address == nil || user.Address.City == 'Paris'
+	user.Address != nil ? user.Address.City : ''
+
+Only checks which are operands of the same && (or ||) chain, or the condition of the ternary, count as guards.
+*/
+func NilAccesses(node ast.Node, schema *Schema) []NilAccess {
+
+	if node == nil || schema == nil {
+		return nil
+	}
+
+	var ret []NilAccess
+
+	var walk func(node ast.Node, bound map[string]bool)
+	walk = func(node ast.Node, bound map[string]bool) {
+
+		switch node.Kind() {
+		case parser.ACCESSOR, parser.METHOD:
+			segments, nilSafe := accessorChain(node.Token())
+			if len(segments) > 0 && !bound[segments[0]] {
+				if access, found := nilAccess(node, schema, segments, nilSafe); found {
+					ret = append(ret, access)
+				}
+			}
+
+		case parser.LAMBDA:
+			parameters, _ := node.Token().Value.([]string)
+			inner := make(map[string]bool, len(bound)+len(parameters))
+			for name := range bound {
+				inner[name] = true
+			}
+			for _, name := range parameters {
+				inner[name] = true
+			}
+			bound = inner
+		}
+
+		for _, child := range node.Children() {
+			walk(child, bound)
+		}
+	}
+	walk(node, nil)
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Node.Pos() < ret[j].Node.Pos()
+	})
+	return ret
+}
+
+/*
+GuardNilAccesses returns a copy of the tree rooted at [node] with each accessor found by NilAccesses
+written with '?.' after each part which may be nil, as in their Guarded form.
+*/
+func GuardNilAccesses(node ast.Node, schema *Schema) (ast.Node, error) {
+
+	guarded := map[ast.Node]string{}
+	for _, access := range NilAccesses(node, schema) {
+		guarded[access.Node] = access.Guarded
+	}
+	if len(guarded) == 0 {
+		return node, nil
+	}
+
+	return ast.Rewrite(node, func(node ast.Node) (ast.Node, bool) {
+
+		if _, found := guarded[node]; !found {
+			return node, false
+		}
+
+		segments, nilSafe := accessorChain(node.Token())
+		markNilSafe(schema, segments, nilSafe)
+
+		token := node.Token()
+		accessor := parser.OptionalAccessor{Segments: segments, NilSafe: nilSafe}
+		token.Value = accessor
+		token.Raw = accessor.String()
+
+		ret, err := ast.New(token, node.Children()...)
+		if err != nil {
+			return node, false
+		}
+		return ret, true
+	})
+}
+
+/*
+Returns the first access of the chain [segments] made on a value which may be nil, unless it's guarded.
+*/
+func nilAccess(node ast.Node, schema *Schema, segments []string, nilSafe []bool) (NilAccess, bool) {
+
+	guards := nilGuards(node)
+	current := schema
+	mayBeNil := false
+
+	for i, segment := range segments {
+
+		// accessing segment i needs the value before it not to be nil
+		if i > 0 && mayBeNil && !nilSafe[i] && !isGuarded(guards, segments[:i]) {
+			guarded := append([]bool(nil), nilSafe...)
+			markNilSafe(schema, segments, guarded)
+			return NilAccess{
+				Node:    node,
+				Path:    strings.Join(segments[:i], "."),
+				Guarded: parser.OptionalAccessor{Segments: segments, NilSafe: guarded}.String(),
+			}, true
+		}
+
+		field, found := current.Field(segment)
+		if !found {
+			// nothing is known about a field the schema doesn't describe, as with a map
+			return NilAccess{}, false
+		}
+
+		mayBeNil = field.Nullable || !current.IsRequired(segment) || nilSafe[i]
+		current = field
+	}
+
+	return NilAccess{}, false
+}
+
+/*
+Sets [nilSafe] for each access of the chain [segments] made on a value which the [schema] says may be nil.
+*/
+func markNilSafe(schema *Schema, segments []string, nilSafe []bool) {
+
+	current := schema
+	for i, segment := range segments[:len(segments)-1] {
+		field, found := current.Field(segment)
+		if !found {
+			return
+		}
+		if field.Nullable || !current.IsRequired(segment) {
+			nilSafe[i+1] = true
+		}
+		current = field
+	}
+}
+
+/*
+Returns the paths checked against nil by the conditions under which [node] is evaluated.
+*/
+func nilGuards(node ast.Node) map[string]bool {
+
+	ret := map[string]bool{}
+
+	child := node
+	for parent := node.Parent(); parent != nil; child, parent = parent, parent.Parent() {
+
+		children := parent.Children()
+		switch parent.Kind() {
+		case parser.LOGICALOP:
+			if children[1] != child {
+				continue
+			}
+			// the right operand of && is only evaluated if the left is true, and that of || if it's false
+			switch parent.Token().Symbol() {
+			case "&&":
+				collectGuards(children[0], "&&", "!=", ret)
+			case "||":
+				collectGuards(children[0], "||", "==", ret)
+			}
+
+		case parser.TERNARY:
+			switch child {
+			case children[1]:
+				collectGuards(children[0], "&&", "!=", ret)
+			case children[2]:
+				collectGuards(children[0], "||", "==", ret)
+			}
+		}
+	}
+	return ret
+}
+
+/*
+Adds to [guards] the paths compared against nil with [comparator] by the operands of the [chain] of && or || rooted at [node].
+*/
+func collectGuards(node ast.Node, chain string, comparator string, guards map[string]bool) {
+
+	node = unparenthesized(node)
+
+	switch node.Kind() {
+	case parser.LOGICALOP:
+		if node.Token().Symbol() == chain {
+			for _, child := range node.Children() {
+				collectGuards(child, chain, comparator, guards)
+			}
+		}
+
+	case parser.COMPARATOR:
+		if node.Token().Symbol() != comparator {
+			return
+		}
+		children := node.Children()
+		for i, operand := range children {
+			operand = unparenthesized(operand)
+			if unparenthesized(children[1-i]).Kind() != parser.NULL {
+				continue
+			}
+			switch operand.Kind() {
+			case parser.VARIABLE:
+				guards[operand.Token().Raw] = true
+			case parser.ACCESSOR:
+				segments, _ := accessorChain(operand.Token())
+				guards[strings.Join(segments, ".")] = true
+			}
+		}
+	}
+}
+
+/*
+Reports whether the value at [path] is checked by one of the [guards], which also holds for a check of anything reached through it.
+*/
+func isGuarded(guards map[string]bool, path []string) bool {
+
+	prefix := strings.Join(path, ".")
+	for guard := range guards {
+		if guard == prefix || strings.HasPrefix(guard, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns the segments of an accessor, along with which of them are reached with '?.'.
+*/
+func accessorChain(token parser.ExpressionToken) ([]string, []bool) {
+
+	switch value := token.Value.(type) {
+	case []string:
+		return append([]string(nil), value...), make([]bool, len(value))
+	case parser.OptionalAccessor:
+		return append([]string(nil), value.Segments...), append([]bool(nil), value.NilSafe...)
+	}
+	return nil, nil
+}
+
+func unparenthesized(node ast.Node) ast.Node {
+
+	for node.Kind() == parser.CLAUSE && len(node.Children()) == 1 {
+		node = node.Children()[0]
+	}
+	return node
+}
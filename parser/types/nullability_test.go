@@ -0,0 +1,114 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+const accountSchema = `{
+	"type": "object",
+	"properties": {
+		"user": {
+			"type": "object",
+			"properties": {
+				"Name": {"type": "string"},
+				"Address": {"type": "object", "properties": {"City": {"type": "string"}}, "required": ["City"]},
+				"Manager": {"type": ["object", "null"], "properties": {"Name": {"type": "string"}}, "required": ["Name"]}
+			},
+			"required": ["Name", "Manager"]
+		},
+		"settings": {"type": "object"}
+	},
+	"required": ["user", "settings"]
+}`
+
+func TestNilAccesses(t *testing.T) {
+
+	schema, err := ParseSchema([]byte(accountSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{"any": {Name: "any"}}}
+
+	tests := []struct {
+		expression string
+		want       []string // each as "path: guarded"
+	}{
+		{"user.Name == 'x'", nil},
+		{"user.Address.City == 'Paris'", []string{"user.Address: user.Address?.City"}},
+		{"user.Manager.Name == 'x' || user.Address.City == 'y'", []string{"user.Manager: user.Manager?.Name", "user.Address: user.Address?.City"}},
+		{"user.Address?.City == 'Paris'", nil},
+		{"settings.Theme.Color == 'dark'", nil},
+
+		// guarded by a check against nil
+		{"user.Address != nil && user.Address.City == 'Paris'", nil},
+		{"user.Address == nil || user.Address.City == 'Paris'", nil},
+		{"user.Address != nil ? user.Address.City : ''", nil},
+		{"user.Address == nil ? '' : user.Address.City", nil},
+		{"user.Address != nil && [a] && user.Address.City == 'Paris'", nil},
+		{"user.Address.City != nil && user.Address.City == 'Paris'", []string{"user.Address: user.Address?.City"}},
+
+		// not guarded
+		{"user.Address.City == 'Paris' && user.Address != nil", []string{"user.Address: user.Address?.City"}},
+		{"user.Address == nil && user.Address.City == 'Paris'", []string{"user.Address: user.Address?.City"}},
+		{"user.Address != nil || user.Address.City == 'Paris'", []string{"user.Address: user.Address?.City"}},
+
+		// the parameter of a lambda isn't a parameter of the expression
+		{"any([xs], user -> user.Address.City == 'x')", nil},
+	}
+
+	for _, test := range tests {
+		tree, err := ast.Parse(test.expression, options)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		var got []string
+		for _, access := range NilAccesses(tree, schema) {
+			got = append(got, access.Path+": "+access.Guarded)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestGuardNilAccesses(t *testing.T) {
+
+	schema, err := ParseSchema([]byte(accountSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := ast.Parse("user.Address.City == 'Paris' && user.Manager.Name != user.Name", parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guarded, err := GuardNilAccesses(tree, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := parser.Formatter{MaxWidth: -1}.Format(ast.ToParser(guarded))
+	if want := "user.Address?.City == 'Paris' && user.Manager?.Name != user.Name"; got != want {
+		t.Errorf("GuardNilAccesses gives %q, want %q", got, want)
+	}
+	if accesses := NilAccesses(guarded, schema); len(accesses) != 0 {
+		t.Errorf("the guarded tree still has the nil accesses %v", accesses)
+	}
+	if reparsed, err := ast.Parse(got, parser.ParserOptions{}); err != nil || !parser.Equal(ast.ToParser(reparsed), ast.ToParser(guarded)) {
+		t.Errorf("%q doesn't parse back into the guarded tree: %v", got, err)
+	}
+
+	unchanged, err := ast.Parse("user.Name == 'x'", parser.ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, err := GuardNilAccesses(unchanged, schema); same != unchanged || err != nil {
+		t.Error("a tree without nil accesses should be returned as it is")
+	}
+}
@@ -0,0 +1,313 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+Schema describes the parameters an expression may be evaluated with, or one of their fields: its type, and for an object, its fields.
+The root of a schema is an object whose properties are the parameters.
+
+A Schema is read from a JSON Schema with ParseSchema, or built from a Go type with SchemaOf.
+*/
+type Schema struct {
+	Type Type
+
+	// whether the value may be nil
+	Nullable bool
+
+	// the fields of an object, keyed by name
+	Properties map[string]*Schema
+
+	// the names of the fields of an object which are always present; the others may be missing, and so nil
+	Required []string
+
+	// whether an object may have fields other than its Properties, whose types aren't known
+	AdditionalProperties bool
+
+	// the type of the elements of an array, if known
+	Items *Schema
+}
+
+/*
+ParseSchema reads the subset of JSON Schema which describes the shape of parameters:
+"type" (a name, or a list of names such as ["string", "null"]), "properties", "required", "additionalProperties" and "items".
+A string with a "format" of "date-time", "date" or "time" is a time, and one with a "format" of "duration" a duration.
+Objects without "properties" are maps, whose fields are unknown; others only allow other fields when "additionalProperties" isn't false.
+*/
+func ParseSchema(data []byte) (*Schema, error) {
+
+	var document jsonSchema
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return document.schema("")
+}
+
+type jsonSchema struct {
+	Type                 json.RawMessage        `json:"type"`
+	Format               string                 `json:"format"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *json.RawMessage       `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+}
+
+func (document *jsonSchema) schema(path string) (*Schema, error) {
+
+	var names []string
+	if len(document.Type) > 0 {
+		var name string
+		if err := json.Unmarshal(document.Type, &name); err == nil {
+			names = []string{name}
+		} else if err := json.Unmarshal(document.Type, &names); err != nil {
+			return nil, fmt.Errorf("invalid schema: 'type' of '%s' must be a string or a list of strings", schemaPath(path))
+		}
+	}
+
+	ret := &Schema{Type: Unknown, Required: document.Required}
+
+	for _, name := range names {
+		switch name {
+		case "null":
+			ret.Nullable = true
+			continue
+		case "string":
+			ret.Type = formatType(document.Format)
+		case "number", "integer":
+			ret.Type = Number
+		case "boolean":
+			ret.Type = Bool
+		case "array":
+			ret.Type = Array
+		case "object":
+			ret.Type = Map
+		default:
+			return nil, fmt.Errorf("invalid schema: unknown type '%s' of '%s'", name, schemaPath(path))
+		}
+	}
+	if len(names) == 1 && names[0] == "null" {
+		ret.Type = Null
+	}
+
+	if ret.Type == Unknown && document.Properties != nil {
+		ret.Type = Map
+	}
+
+	if ret.Type == Map {
+		ret.AdditionalProperties = document.Properties == nil
+		if document.AdditionalProperties != nil {
+			// either false, or a schema for the other fields, which are then allowed
+			ret.AdditionalProperties = string(*document.AdditionalProperties) != "false"
+		}
+
+		ret.Properties = make(map[string]*Schema, len(document.Properties))
+		for name, property := range document.Properties {
+			if property == nil {
+				return nil, fmt.Errorf("invalid schema: property '%s' of '%s' is null", name, schemaPath(path))
+			}
+			schema, err := property.schema(joinPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+			ret.Properties[name] = schema
+		}
+	}
+
+	if ret.Type == Array && document.Items != nil {
+		items, err := document.Items.schema(path + "[]")
+		if err != nil {
+			return nil, err
+		}
+		ret.Items = items
+	}
+
+	return ret, nil
+}
+
+func formatType(format string) Type {
+
+	switch format {
+	case "date-time", "date", "time":
+		return Time
+	case "duration":
+		return Duration
+	}
+	return String
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+/*
+SchemaOf returns the schema of the Go value [v], or of the type it points to, as a struct whose fields are the parameters.
+The parameters are named by the json tags of the fields which have one, as the parameters are often decoded from JSON,
+and fields of any other struct as they are declared, since that is how accessors such as user.Name reach them.
+Unexported fields, which accessors can't reach, and fields tagged json:"-" are left out.
+Fields which are pointers, interfaces, maps or slices may be nil.
+*/
+func SchemaOf(v interface{}) *Schema {
+
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return &Schema{Type: Unknown, AdditionalProperties: true}
+	}
+
+	ret := schemaOfType(t, map[reflect.Type]bool{})
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ret
+	}
+
+	// the parameters are keys of a map, rather than fields
+	parameters := &Schema{Type: Map, Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		schema, found := ret.Properties[field.Name]
+		if !found {
+			continue
+		}
+
+		name := field.Name
+		if tag, found := field.Tag.Lookup("json"); found {
+			name, _, _ = strings.Cut(tag, ",")
+			switch name {
+			case "-":
+				continue
+			case "":
+				name = field.Name
+			}
+		}
+		parameters.Properties[name] = schema
+		parameters.Required = append(parameters.Required, name)
+	}
+	return parameters
+}
+
+/*
+Returns the schema of [t], where [visiting] holds the struct types being built, whose recursive fields are left unknown.
+*/
+func schemaOfType(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: Time, Nullable: nullable}
+	case durationType:
+		return &Schema{Type: Duration, Nullable: nullable}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Bool, Nullable: nullable}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return &Schema{Type: Number, Nullable: nullable}
+
+	case reflect.String:
+		return &Schema{Type: String, Nullable: nullable}
+
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: Array, Nullable: nullable || t.Kind() == reflect.Slice, Items: schemaOfType(t.Elem(), visiting)}
+
+	case reflect.Map:
+		return &Schema{Type: Map, Nullable: true, AdditionalProperties: true}
+
+	case reflect.Struct:
+		if visiting[t] {
+			return &Schema{Type: Map, Nullable: nullable, AdditionalProperties: true}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		ret := &Schema{Type: Map, Nullable: nullable, Properties: map[string]*Schema{}}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			ret.Properties[field.Name] = schemaOfType(field.Type, visiting)
+			ret.Required = append(ret.Required, field.Name)
+		}
+		return ret
+	}
+
+	// interfaces, and anything else which can hold any value
+	return &Schema{Type: Unknown, Nullable: true, AdditionalProperties: true}
+}
+
+/*
+Field returns the schema of the field [name] of an object, or false if the schema doesn't describe it.
+*/
+func (schema *Schema) Field(name string) (*Schema, bool) {
+
+	if schema == nil || schema.Properties == nil {
+		return nil, false
+	}
+	field, found := schema.Properties[name]
+	return field, found
+}
+
+/*
+IsRequired reports whether the field [name] of an object is always present.
+*/
+func (schema *Schema) IsRequired(name string) bool {
+
+	for _, required := range schema.Required {
+		if required == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns the types of every parameter and field described by the schema, keyed by path as Config.Params is.
+*/
+func (schema *Schema) params() map[string]Type {
+
+	ret := map[string]Type{}
+
+	var walk func(schema *Schema, path string)
+	walk = func(schema *Schema, path string) {
+		for name, field := range schema.Properties {
+			fieldPath := joinPath(path, name)
+			ret[fieldPath] = field.Type
+			walk(field, fieldPath)
+		}
+	}
+	walk(schema, "")
+
+	return ret
+}
+
+func joinPath(path string, name string) string {
+
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func schemaPath(path string) string {
+
+	if path == "" {
+		return "the root"
+	}
+	return path
+}
@@ -0,0 +1,178 @@
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+const userSchema = `{
+	"type": "object",
+	"properties": {
+		"age": {"type": "integer"},
+		"name": {"type": ["string", "null"]},
+		"joined": {"type": "string", "format": "date-time"},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"user": {
+			"type": "object",
+			"properties": {
+				"Name": {"type": "string"},
+				"Address": {"type": "object", "properties": {"City": {"type": "string"}}, "additionalProperties": false}
+			},
+			"required": ["Name"]
+		},
+		"extra": {"type": "object"}
+	},
+	"additionalProperties": false
+}`
+
+func TestParseSchema(t *testing.T) {
+
+	schema, err := ParseSchema([]byte(userSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Type{
+		"age":               Number,
+		"name":              String,
+		"joined":            Time,
+		"tags":              Array,
+		"user":              Map,
+		"user.Name":         String,
+		"user.Address":      Map,
+		"user.Address.City": String,
+		"extra":             Map,
+	}
+	if got := schema.params(); !reflect.DeepEqual(got, want) {
+		t.Errorf("the schema has the params %v, want %v", got, want)
+	}
+
+	name, _ := schema.Field("name")
+	user, _ := schema.Field("user")
+	extra, _ := schema.Field("extra")
+	address, _ := user.Field("Address")
+	switch {
+	case !name.Nullable:
+		t.Error(`a "type" of ["string", "null"] should be nullable`)
+	case !user.IsRequired("Name") || user.IsRequired("Address"):
+		t.Error("only Name of user is required")
+	case schema.AdditionalProperties || address.AdditionalProperties || user.AdditionalProperties:
+		t.Error("objects with properties only allow others when additionalProperties isn't false")
+	case !extra.AdditionalProperties:
+		t.Error("an object without properties is a map, whose fields are unknown")
+	}
+
+	for _, invalid := range []string{
+		`{`,
+		`{"type": 1}`,
+		`{"properties": {"a": {"type": "thing"}}}`,
+		`{"properties": {"a": null}}`,
+	} {
+		if _, err := ParseSchema([]byte(invalid)); err == nil || !strings.HasPrefix(err.Error(), "invalid schema") {
+			t.Errorf("ParseSchema(%s): got %v, want an invalid schema", invalid, err)
+		}
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+
+	type address struct {
+		City string
+	}
+	type user struct {
+		Name    string
+		Address *address
+		Friends []user
+		secret  string
+	}
+	type parameters struct {
+		Age     int           `json:"age"`
+		Joined  time.Time     `json:"joined,omitempty"`
+		Timeout time.Duration `json:"-"`
+		User    user
+		Extra   map[string]interface{}
+	}
+
+	schema := SchemaOf(&parameters{})
+
+	want := map[string]Type{
+		"age":               Number,
+		"joined":            Time,
+		"User":              Map,
+		"User.Name":         String,
+		"User.Address":      Map,
+		"User.Address.City": String,
+		"User.Friends":      Array,
+		"Extra":             Map,
+	}
+	if got := schema.params(); !reflect.DeepEqual(got, want) {
+		t.Errorf("the schema has the params %v, want %v", got, want)
+	}
+
+	u, _ := schema.Field("User")
+	location, _ := u.Field("Address")
+	friends, _ := u.Field("Friends")
+	if !location.Nullable || !friends.Nullable || u.Nullable {
+		t.Error("pointers and slices may be nil, and structs can't")
+	}
+	if friend := friends.Items; friend == nil || friend.Type != Map || !friend.AdditionalProperties {
+		t.Errorf("a recursive field should be left unknown, got %+v", friend)
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	schema, err := ParseSchema([]byte(userSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := parser.ParserOptions{Functions: map[string]parser.ExpressionFunction{"any": {Name: "any"}}}
+
+	tests := []struct {
+		expression string
+		want       []string // each as "source: message"
+	}{
+		{"[age] > 18 && user.Name == 'x' && user.Address.City == [name]", nil},
+		{"[agee] > 18", []string{"[agee]: unknown parameter 'agee'"}},
+		{"user.Nmae == 'x'", []string{"user.Nmae: unknown field 'Nmae' of 'user'"}},
+		{"user.Address.Zip == 1", []string{"user.Address.Zip: unknown field 'Zip' of 'user.Address'"}},
+		{"user.Name.First == 'x'", []string{"user.Name.First: 'user.Name' is a string, which has no field 'First'"}},
+		{"extra.Anything == 1", nil},
+		{"[age] > 'x' || !user.Name", []string{"[age] > 'x': type mismatch: ", "!user.Name: type mismatch: "}},
+		{"any([tags], t -> t.Length > 0)", nil},
+	}
+
+	for _, test := range tests {
+		tree, err := ast.Parse(test.expression, options)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expression, err)
+		}
+
+		var got []string
+		for _, diagnostic := range Validate(tree, schema, nil) {
+			if diagnostic.Pos != diagnostic.Node.Pos() || diagnostic.End != diagnostic.Node.End() {
+				t.Errorf("%q: %q is at [%d, %d), not at its node", test.expression, diagnostic.Msg, diagnostic.Pos, diagnostic.End)
+			}
+			got = append(got, test.expression[diagnostic.Pos:diagnostic.End]+": "+diagnostic.Msg)
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %q, want %q", test.expression, got, test.want)
+			continue
+		}
+		for i := range got {
+			if !strings.HasPrefix(got[i], test.want[i]) {
+				t.Errorf("%q: got %q, want %q", test.expression, got[i], test.want[i])
+			}
+		}
+	}
+
+	if Validate(nil, schema, nil) != nil {
+		t.Error("Validate(nil) should find nothing")
+	}
+}
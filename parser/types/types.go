@@ -0,0 +1,111 @@
+/*
+Package types infers the type of every node of a syntax tree and reports the operations whose operands can't have the types they need,
+such as 'abc' > 5, or a string passed to a function which wants a number.
+
+Types are inferred bottom-up from literals, from the declared types of the parameters an expression is evaluated with,
+and from the signatures of the functions it calls. Anything whose type isn't known, such as an undeclared variable,
+has the type Unknown, which never makes a mismatch: only operands whose types are both known and clearly incompatible are reported.
+The rules are those of parser.InferType, both being built on parser.OperationType; but where InferType stops
+at the first mismatch, Check goes on to report every one.
+*/
+package types
+
+import (
+	"fmt"
+
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+The type of a value, named as parser.InferType and ExpressionFunction.ReturnType name them.
+*/
+type Type string
+
+const (
+	Number   Type = "number"
+	String   Type = "string"
+	Bool     Type = "bool"
+	Time     Type = "time"
+	Duration Type = "duration"
+	Array    Type = "array"
+	Map      Type = "map"
+	Null     Type = "null"
+	Unknown  Type = "unknown"
+)
+
+/*
+The types of the parameters a function takes and of the value it returns.
+*/
+type Signature struct {
+
+	// the type of each parameter, in the order of ExpressionFunction.Parameters, which gives their names for named arguments;
+	// Unknown, or the empty string, for a parameter which takes any type
+	Parameters []Type
+
+	// whether the last parameter may be passed any number of times, including none
+	Variadic bool
+
+	// the type of the value returned; if empty, the ReturnType of the function's ExpressionFunction is used
+	ReturnType Type
+}
+
+/*
+Config declares the types Check infers from.
+*/
+type Config struct {
+
+	// the types of the parameters the expression is evaluated with, keyed by variable name,
+	// or by the whole path of an accessor, such as "user.Age"
+	Params map[string]Type
+
+	// the signatures of functions, keyed by name; the arguments of calls of other functions aren't checked
+	Functions map[string]Signature
+}
+
+/*
+Info holds the types inferred by Check.
+*/
+type Info struct {
+	Types map[ast.Node]Type
+}
+
+/*
+TypeOf returns the type inferred for [node], which is Unknown for a node not in the checked tree.
+*/
+func (info *Info) TypeOf(node ast.Node) Type {
+
+	if t, found := info.Types[node]; found {
+		return t
+	}
+	return Unknown
+}
+
+/*
+A type mismatch found by Check, at the node whose operands or arguments don't have the types it needs.
+*/
+type Error struct {
+	Node ast.Node
+	Msg  string
+}
+
+func (err Error) Error() string {
+	return fmt.Sprintf("type mismatch: %s at %d", err.Msg, err.Node.Token().Start)
+}
+
+/*
+Check infers the type of every node of the tree rooted at [node] with the types declared in [config],
+and returns them along with every type mismatch found, in source order.
+
+A node whose operands don't have the types it needs has the type of its result where that doesn't depend on them,
+as Bool for a comparison, and Unknown otherwise, so that one mistake isn't reported again by every node above it.
+*/
+func Check(node ast.Node, config Config) (*Info, []Error) {
+
+	checker := checker{config: config, info: &Info{Types: map[ast.Node]Type{}}}
+	if node != nil {
+		checker.check(node, nil)
+	}
+
+	sortErrors(checker.errors)
+	return checker.info, checker.errors
+}
@@ -0,0 +1,128 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/piex/govaluate-tool/parser"
+	"github.com/piex/govaluate-tool/parser/ast"
+)
+
+/*
+A problem with an expression found by Validate, at the node it concerns,
+with the span of source to highlight.
+*/
+type Diagnostic struct {
+	Node ast.Node
+	Pos  int
+	End  int
+	Msg  string
+}
+
+func (diagnostic Diagnostic) Error() string {
+	return fmt.Sprintf("%s at %d", diagnostic.Msg, diagnostic.Pos)
+}
+
+/*
+Validate checks the tree rooted at [node] against the [schema] of the parameters it is evaluated with,
+and the signatures of the [functions] it calls, returning a diagnostic for each problem found, in source order:
+
+  - a variable which isn't a parameter, unless the schema allows other parameters
+  - an accessor into a field which the object doesn't have, or into a value which isn't an object, such as user.Name.First with Name a string
+  - every type mismatch Check finds, with the types of the parameters and fields taken from the schema
+
+The parameters of a lambda aren't checked within its body.
+*/
+func Validate(node ast.Node, schema *Schema, functions map[string]Signature) []Diagnostic {
+
+	if node == nil || schema == nil {
+		return nil
+	}
+
+	var ret []Diagnostic
+	report := func(node ast.Node, format string, arguments ...interface{}) {
+		ret = append(ret, Diagnostic{Node: node, Pos: node.Pos(), End: node.End(), Msg: fmt.Sprintf(format, arguments...)})
+	}
+
+	var walk func(node ast.Node, bound map[string]bool)
+	walk = func(node ast.Node, bound map[string]bool) {
+
+		switch node.Kind() {
+		case parser.VARIABLE:
+			if name := node.Token().Raw; !bound[name] {
+				validatePath(schema, []string{name}, func(format string, arguments ...interface{}) {
+					report(node, format, arguments...)
+				})
+			}
+
+		case parser.ACCESSOR, parser.METHOD:
+			segments := accessorSegments(node.Token())
+			if node.Kind() == parser.METHOD && len(segments) > 0 {
+				// the method itself isn't a field
+				segments = segments[:len(segments)-1]
+			}
+			if len(segments) > 0 && !bound[segments[0]] {
+				validatePath(schema, segments, func(format string, arguments ...interface{}) {
+					report(node, format, arguments...)
+				})
+			}
+
+		case parser.LAMBDA:
+			parameters, _ := node.Token().Value.([]string)
+			inner := make(map[string]bool, len(bound)+len(parameters))
+			for name := range bound {
+				inner[name] = true
+			}
+			for _, name := range parameters {
+				inner[name] = true
+			}
+			bound = inner
+		}
+
+		for _, child := range node.Children() {
+			walk(child, bound)
+		}
+	}
+	walk(node, nil)
+
+	_, mismatches := Check(node, Config{Params: schema.params(), Functions: functions})
+	for _, mismatch := range mismatches {
+		report(mismatch.Node, "type mismatch: %s", mismatch.Msg)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Pos < ret[j].Pos
+	})
+	return ret
+}
+
+/*
+Follows the [segments] of an accessor through the [schema], reporting the first which the schema doesn't allow.
+*/
+func validatePath(schema *Schema, segments []string, report func(format string, arguments ...interface{})) {
+
+	current := schema
+	for i, segment := range segments {
+
+		if current.Type != Map {
+			if isKnown(current.Type) {
+				report("'%s' is a %s, which has no field '%s'", strings.Join(segments[:i], "."), current.Type, segment)
+			}
+			return
+		}
+
+		field, found := current.Field(segment)
+		if !found {
+			switch {
+			case current.AdditionalProperties:
+			case i == 0:
+				report("unknown parameter '%s'", segment)
+			default:
+				report("unknown field '%s' of '%s'", segment, strings.Join(segments[:i], "."))
+			}
+			return
+		}
+		current = field
+	}
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"sort"
+)
+
+/*
+A variable referenced by an expression, along with the tokens of every reference to it.
+Name is the root of the reference: "order" for both order and order.Customer?.Name.
+*/
+type Variable struct {
+	Name string
+
+	// the VARIABLE, ACCESSOR and METHOD tokens referring to the variable, in source order
+	References []ExpressionToken
+}
+
+/*
+Variables parses [expression] and returns the distinct variables it references, in the order they are first referenced,
+so that callers can check each of them exists before accepting the expression.
+The parameters of a lambda, such as x in filter(items, x -> x.Price > 10), are not variables within its body.
+*/
+func Variables(expression string, options ParserOptions) ([]Variable, error) {
+
+	ast, err := parseAST(expression, options)
+	if err != nil {
+		return nil, err
+	}
+	return ast.Variables(), nil
+}
+
+/*
+Variables returns the distinct variables referenced within the node, as the Variables function does for an expression.
+*/
+func (ast *ASTNode) Variables() []Variable {
+
+	var ret []Variable
+	index := map[string]int{}
+
+	ast.walkReferences(nil, func(name string, token *ExpressionToken) {
+
+		i, found := index[name]
+		if !found {
+			i = len(ret)
+			index[name] = i
+			ret = append(ret, Variable{Name: name})
+		}
+		ret[i].References = append(ret[i].References, *token)
+	})
+
+	sortReferences(ret)
+	return ret
+}
+
+/*
+Calls [found] for each reference to a variable within the node, other than to the [bound] lambda parameters.
+*/
+func (ast *ASTNode) walkReferences(bound map[string]bool, found func(name string, token *ExpressionToken)) {
+
+	if ast == nil || ast.Token == nil {
+		return
+	}
+
+	switch ast.Token.Kind {
+	case VARIABLE, ACCESSOR, METHOD:
+		if name, ok := RootName(*ast.Token); ok && !bound[name] {
+			found(name, ast.Token)
+		}
+
+	case LAMBDA:
+		parameters, _ := ast.Token.Value.([]string)
+		if len(parameters) > 0 {
+			inner := make(map[string]bool, len(bound)+len(parameters))
+			for name := range bound {
+				inner[name] = true
+			}
+			for _, name := range parameters {
+				inner[name] = true
+			}
+			bound = inner
+		}
+	}
+
+	for _, child := range ast.Children {
+		child.walkReferences(bound, found)
+	}
+}
+
+/*
+RootName returns the name of the variable a VARIABLE, ACCESSOR or METHOD token refers to:
+the whole name of a variable, or the first segment of an accessor.
+*/
+func RootName(token ExpressionToken) (string, bool) {
+
+	switch token.Kind {
+	case VARIABLE:
+		return token.Raw, true
+
+	case ACCESSOR, METHOD:
+		switch value := token.Value.(type) {
+		case []string:
+			if len(value) > 0 {
+				return value[0], true
+			}
+		case OptionalAccessor:
+			if len(value.Segments) > 0 {
+				return value.Segments[0], true
+			}
+		}
+	}
+	return "", false
+}
+
+/*
+Sorts the references to each variable, and then the variables, by position,
+since the operands of a tree aren't always in source order, as with a call whose named arguments were reordered.
+*/
+func sortReferences(variables []Variable) {
+
+	for _, variable := range variables {
+		references := variable.References
+		sort.SliceStable(references, func(i, j int) bool {
+			return references[i].Start < references[j].Start
+		})
+	}
+
+	sort.SliceStable(variables, func(i, j int) bool {
+		return variables[i].References[0].Start < variables[j].References[0].Start
+	})
+}